@@ -0,0 +1,165 @@
+package analytics
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+const (
+	// maxPatterns bounds the distinct prefixes and patterns tracked, the others are counted as otherPattern
+	maxPatterns  = 1000
+	otherPattern = "<other>"
+	// topN is the number of prefixes and patterns in the summary
+	topN             = 10
+	prefixWords      = 3
+	maxPatternLength = 80
+)
+
+// sizeBuckets are the upper bounds in bytes of the record size histogram, the last bucket is unbounded
+var sizeBuckets = []int{128, 256, 512, 1024, 2048, 4096, 8192, 16384, 65536, 262144}
+
+var (
+	uuidPattern   = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	hexPattern    = regexp.MustCompile(`\b0x[0-9a-fA-F]+\b|\b[0-9a-fA-F]{16,}\b`)
+	numberPattern = regexp.MustCompile(`\d+(\.\d+)?`)
+)
+
+// Count is the number of records and bytes of a prefix or pattern
+type Count struct {
+	Value   string `json:"value"`
+	Records int64  `json:"records"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// Summary describes the records shipped by the container
+type Summary struct {
+	Records     int64            `json:"records"`
+	Bytes       int64            `json:"bytes"`
+	SizeBuckets map[string]int64 `json:"sizeHistogram"`
+	TopPrefixes []Count          `json:"topPrefixes"`
+	TopPatterns []Count          `json:"topBytePatterns"`
+	RecordTypes map[string]int64 `json:"recordTypes"`
+}
+
+var (
+	mu          sync.Mutex
+	records     int64
+	bytes       int64
+	histogram   = make([]int64, len(sizeBuckets)+1)
+	recordTypes = map[string]int64{}
+	prefixes    = map[string]*Count{}
+	patterns    = map[string]*Count{}
+)
+
+// Observe accounts a shipped record of size bytes. message is the log line for function and extension
+// records and empty for the platform records, which are grouped by type.
+func Observe(recordType, message string, size int) {
+	pattern := recordType
+	prefix := recordType
+	if message != "" {
+		pattern = normalize(message)
+		prefix = firstWords(pattern, prefixWords)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	records++
+	bytes += int64(size)
+	histogram[bucket(size)]++
+	recordTypes[recordType]++
+	add(prefixes, prefix, size)
+	add(patterns, pattern, size)
+}
+
+// Snapshot returns the summary of the records observed so far
+func Snapshot() Summary {
+	mu.Lock()
+	defer mu.Unlock()
+	summary := Summary{
+		Records:     records,
+		Bytes:       bytes,
+		SizeBuckets: map[string]int64{},
+		TopPrefixes: top(prefixes, func(c *Count) int64 { return c.Records }),
+		TopPatterns: top(patterns, func(c *Count) int64 { return c.Bytes }),
+		RecordTypes: map[string]int64{},
+	}
+	for i, count := range histogram {
+		summary.SizeBuckets[bucketName(i)] = count
+	}
+	for recordType, count := range recordTypes {
+		summary.RecordTypes[recordType] = count
+	}
+	return summary
+}
+
+// normalize replaces the variable parts of a line so that lines logged by the same statement match
+func normalize(message string) string {
+	pattern := uuidPattern.ReplaceAllString(message, "<uuid>")
+	pattern = hexPattern.ReplaceAllString(pattern, "<hex>")
+	pattern = numberPattern.ReplaceAllString(pattern, "<n>")
+	pattern = strings.Join(strings.Fields(pattern), " ")
+	pattern, _ = utils.TruncateUTF8(pattern, maxPatternLength)
+	return pattern
+}
+
+func firstWords(pattern string, n int) string {
+	words := strings.Fields(pattern)
+	if len(words) > n {
+		words = words[:n]
+	}
+	return strings.Join(words, " ")
+}
+
+func add(counts map[string]*Count, value string, size int) {
+	count, found := counts[value]
+	if !found {
+		if len(counts) >= maxPatterns {
+			value = otherPattern
+			count, found = counts[value]
+		}
+		if !found {
+			count = &Count{Value: value}
+			counts[value] = count
+		}
+	}
+	count.Records++
+	count.Bytes += int64(size)
+}
+
+func top(counts map[string]*Count, by func(*Count) int64) []Count {
+	all := make([]Count, 0, len(counts))
+	for _, count := range counts {
+		all = append(all, *count)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if by(&all[i]) != by(&all[j]) {
+			return by(&all[i]) > by(&all[j])
+		}
+		return all[i].Value < all[j].Value
+	})
+	if len(all) > topN {
+		all = all[:topN]
+	}
+	return all
+}
+
+func bucket(size int) int {
+	for i, bound := range sizeBuckets {
+		if size <= bound {
+			return i
+		}
+	}
+	return len(sizeBuckets)
+}
+
+func bucketName(i int) string {
+	if i == len(sizeBuckets) {
+		return ">" + strconv.Itoa(sizeBuckets[len(sizeBuckets)-1])
+	}
+	return "<=" + strconv.Itoa(sizeBuckets[i])
+}
@@ -0,0 +1,29 @@
+package analytics
+
+import (
+	"testing"
+)
+
+func TestObserve(t *testing.T) {
+	Observe("function", "Processed order 1234 in 56ms", 100)
+	Observe("function", "Processed order 98 in 7ms", 300)
+	Observe("function", "request 123e4567-e89b-12d3-a456-426614174000 failed", 5000)
+	Observe("platform.report", "", 200)
+
+	summary := Snapshot()
+	if summary.Records != 4 || summary.Bytes != 5600 {
+		t.Errorf("Expected 4 records and 5600 bytes, got %d records and %d bytes", summary.Records, summary.Bytes)
+	}
+	if summary.SizeBuckets["<=128"] != 1 || summary.SizeBuckets["<=256"] != 1 || summary.SizeBuckets["<=512"] != 1 || summary.SizeBuckets["<=8192"] != 1 {
+		t.Errorf("Unexpected size histogram %v", summary.SizeBuckets)
+	}
+	if top := summary.TopPrefixes[0]; top.Value != "Processed order <n>" || top.Records != 2 {
+		t.Errorf("Unexpected top prefix %+v", top)
+	}
+	if top := summary.TopPatterns[0]; top.Value != "request <uuid> failed" || top.Bytes != 5000 {
+		t.Errorf("Unexpected top pattern %+v", top)
+	}
+	if summary.RecordTypes["function"] != 3 || summary.RecordTypes["platform.report"] != 1 {
+		t.Errorf("Unexpected record types %v", summary.RecordTypes)
+	}
+}
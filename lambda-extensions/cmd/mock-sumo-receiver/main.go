@@ -0,0 +1,202 @@
+// Command mock-sumo-receiver is a fake Sumo Logic HTTP source for the integration environments. It accepts
+// the posts of the extension, validates their headers and compression as the collector does, and records
+// the payloads to disk. The query parameters of the endpoint simulate the failures of the collector, so that
+// SUMO_HTTP_ENDPOINT selects the scenario of a test run:
+//
+//	status=429     the status of the responses
+//	failures=2     only the first 2 posts of the endpoint get status, the next ones 200
+//	delay=1500ms   the time before responding, a slow collector
+//
+// e.g. SUMO_HTTP_ENDPOINT=http://localhost:8080/receiver/v1/http/token?status=503&failures=2 tests that a
+// batch is delivered after two retries, with SUMO_ALLOW_INSECURE=true as the receiver is plain http.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/fields"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// maxRequestBytes is the largest body the collector accepts
+const maxRequestBytes = 10 * 1024 * 1024
+
+// recordedRequest is the line of requests.jsonl describing a post, its payload is in the file of Payload
+type recordedRequest struct {
+	Sequence int               `json:"sequence"`
+	Time     string            `json:"time"`
+	Path     string            `json:"path"`
+	Query    string            `json:"query,omitempty"`
+	Status   int               `json:"status"`
+	Error    string            `json:"error,omitempty"`
+	Headers  map[string]string `json:"headers"`
+	Bytes    int               `json:"bytes"`
+	Payload  string            `json:"payload,omitempty"`
+}
+
+// receiver records the posts in dir and counts the posts of every endpoint for the failures parameter
+type receiver struct {
+	dir      string
+	mu       sync.Mutex
+	sequence int
+	posts    map[string]int
+	journal  *os.File
+}
+
+// scenario returns the status and the delay of a post from the query parameters of its endpoint
+func (r *receiver) scenario(request *http.Request) (int, time.Duration, error) {
+	query := request.URL.Query()
+	status, delay := http.StatusOK, time.Duration(0)
+	var err error
+	if value := query.Get("status"); value != "" {
+		if status, err = strconv.Atoi(value); err != nil || status < 100 || status > 599 {
+			return 0, 0, fmt.Errorf("status %q is not an HTTP status", value)
+		}
+	}
+	if value := query.Get("delay"); value != "" {
+		if delay, err = time.ParseDuration(value); err != nil {
+			return 0, 0, fmt.Errorf("delay %q is not a duration: %v", value, err)
+		}
+	}
+	if value := query.Get("failures"); value != "" {
+		failures, err := strconv.Atoi(value)
+		if err != nil || failures < 0 {
+			return 0, 0, fmt.Errorf("failures %q is not a count", value)
+		}
+		r.mu.Lock()
+		r.posts[request.URL.String()]++
+		posts := r.posts[request.URL.String()]
+		r.mu.Unlock()
+		if posts > failures {
+			status = http.StatusOK
+		}
+	}
+	return status, delay, nil
+}
+
+// validate checks the headers and the body of a post as the collector does and returns the payload
+// decompressed
+func validate(request *http.Request, body []byte) ([]byte, error) {
+	if len(body) > maxRequestBytes {
+		return nil, fmt.Errorf("body of %d bytes is larger than %d bytes", len(body), maxRequestBytes)
+	}
+	metadata := fields.Metadata{
+		Category: request.Header.Get(fields.CategoryHeader),
+		Host:     request.Header.Get(fields.HostHeader),
+		Name:     request.Header.Get(fields.NameHeader),
+	}
+	if err := metadata.Validate(); err != nil {
+		return nil, err
+	}
+	if encoded := request.Header.Get(fields.FieldsHeader); encoded != "" {
+		if _, err := fields.Parse(encoded); err != nil {
+			return nil, fmt.Errorf("%s is not valid: %v", fields.FieldsHeader, err)
+		}
+	}
+	switch encoding := request.Header.Get("Content-Encoding"); encoding {
+	case "":
+		return body, nil
+	case "gzip":
+		payload, err := utils.Decompress(body)
+		if err != nil {
+			return nil, fmt.Errorf("body is not gzipped: %v", err)
+		}
+		return payload, nil
+	default:
+		return nil, fmt.Errorf("Content-Encoding %s is not supported", encoding)
+	}
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(w, "only POST is accepted", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, request.Body, maxRequestBytes+1))
+	request.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	status, delay, err := r.scenario(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payload, err := validate(request, body)
+	if err != nil {
+		status = http.StatusBadRequest
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if recordErr := r.record(request, status, err, payload); recordErr != nil {
+		log.Printf("Unable to record the post: %v", recordErr)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+// record writes the payload of an accepted post to its own file and appends the post to requests.jsonl
+func (r *receiver) record(request *http.Request, status int, validationErr error, payload []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sequence++
+	recorded := recordedRequest{
+		Sequence: r.sequence,
+		Time:     time.Now().UTC().Format(time.RFC3339Nano),
+		Path:     request.URL.Path,
+		Query:    request.URL.RawQuery,
+		Status:   status,
+		Headers:  map[string]string{},
+		Bytes:    len(payload),
+	}
+	for key := range request.Header {
+		recorded.Headers[key] = request.Header.Get(key)
+	}
+	if validationErr != nil {
+		recorded.Error = validationErr.Error()
+	} else if status == http.StatusOK {
+		recorded.Payload = fmt.Sprintf("%06d.log", r.sequence)
+		if err := ioutil.WriteFile(filepath.Join(r.dir, recorded.Payload), payload, 0644); err != nil {
+			return err
+		}
+	}
+	line, err := json.Marshal(recorded)
+	if err != nil {
+		return err
+	}
+	_, err = r.journal.Write(append(line, '\n'))
+	return err
+}
+
+func main() {
+	address := flag.String("addr", "localhost:8080", "address the receiver listens on")
+	dir := flag.String("dir", "mock-sumo-payloads", "directory the payloads and requests.jsonl are recorded in")
+	flag.Parse()
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		log.Fatalf("Unable to create %s: %v", *dir, err)
+	}
+	journal, err := os.OpenFile(filepath.Join(*dir, "requests.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatalf("Unable to open requests.jsonl: %v", err)
+	}
+
+	log.Printf("Receiving on http://%s/receiver/v1/http/<token>, recording to %s", *address, *dir)
+	err = http.ListenAndServe(*address, &receiver{dir: *dir, posts: map[string]int{}, journal: journal})
+	log.Fatal(err)
+}
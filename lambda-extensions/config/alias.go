@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// invokedQualifier is the alias or version of the last invocation, it is only known from the INVOKE events
+var invokedQualifier atomic.Value
+
+// SetInvokedFunctionArn records the qualifier of the invoked function arn
+// arn:aws:lambda:region:account:function:name[:qualifier], which selects the endpoint of the alias.
+func SetInvokedFunctionArn(arn string) {
+	parts := strings.Split(arn, ":")
+	if len(parts) == 8 {
+		invokedQualifier.Store(parts[7])
+	} else {
+		invokedQualifier.Store("")
+	}
+}
+
+// InvokedQualifier returns the alias or version of the last invocation, empty until the first INVOKE event
+func InvokedQualifier() string {
+	qualifier, _ := invokedQualifier.Load().(string)
+	return qualifier
+}
+
+// Endpoint returns the endpoint for the alias of the last invocation, see EndpointFor
+func (cfg *LambdaExtensionConfig) Endpoint() string {
+	return cfg.EndpointFor(InvokedQualifier())
+}
+
+// EndpointFor returns the endpoint from SUMO_ALIAS_ENDPOINT_MAP for qualifier and SUMO_HTTP_ENDPOINT, or its
+// rotated secret, otherwise. It is empty when the alias has no endpoint and SUMO_HTTP_ENDPOINT is not set.
+func (cfg *LambdaExtensionConfig) EndpointFor(qualifier string) string {
+	if endpoint, found := cfg.AliasEndpoints[qualifier]; found && qualifier != "" {
+		return endpoint
+	}
+	if cfg.endpointFromSecret {
+		return endpointSecret.currentEndpoint()
+	}
+	return cfg.SumoHTTPEndpoint
+}
+
+// parseAliasEndpointMap reads the alias=endpoint pairs of SUMO_ALIAS_ENDPOINT_MAP separated by ;
+func parseAliasEndpointMap(value string) (map[string]string, error) {
+	aliasEndpoints := map[string]string{}
+	var allErrors []string
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			allErrors = append(allErrors, fmt.Sprintf("entry %q is not in alias=endpoint format", entry))
+			continue
+		}
+		alias, endpoint := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if _, err := url.ParseRequestURI(endpoint); err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("endpoint of alias %s is not Valid", alias))
+			continue
+		}
+		aliasEndpoints[alias] = endpoint
+	}
+	if len(allErrors) > 0 {
+		return aliasEndpoints, errors.New(strings.Join(allErrors, ", "))
+	}
+	return aliasEndpoints, nil
+}
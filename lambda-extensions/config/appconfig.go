@@ -0,0 +1,64 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// appConfigClientID identifies the environment to AppConfig when the log stream is unknown
+const appConfigClientID = "sumologic-extension"
+
+// appConfig is the state of the polling of SUMO_APPCONFIG_PROFILE, kept across config reloads
+var appConfig struct {
+	lastPoll time.Time
+	version  string
+}
+
+// PollAppConfig fetches the AppConfig profile of SUMO_APPCONFIG_PROFILE once AppConfigPollInterval elapsed
+// since the last poll, and sets the config env vars of a new version. The profile is in the format of
+// SUMO_CONFIG_JSON or of the config file. It overrides the config blob and file but not the env vars set on
+// the function, see sharedSources. It returns true when the env vars changed, the config then has to be
+// reloaded.
+func (cfg *LambdaExtensionConfig) PollAppConfig() (bool, error) {
+	if cfg.AppConfigProfile == "" || (!appConfig.lastPoll.IsZero() && utils.Since(appConfig.lastPoll) < cfg.AppConfigPollInterval) {
+		return false, nil
+	}
+	appConfig.lastPoll = time.Now()
+	clientID := os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME")
+	if clientID == "" {
+		clientID = appConfigClientID
+	}
+	parts := strings.SplitN(cfg.AppConfigProfile, "/", 3)
+	ctx, cancel := context.WithTimeout(context.Background(), awsAPITimeout)
+	defer cancel()
+	content, version, err := utils.GetAppConfiguration(ctx, parts[0], parts[1], parts[2], clientID, appConfig.version, awsAPINumRetry)
+	if err != nil {
+		return false, err
+	}
+	if len(content) == 0 || version == appConfig.version {
+		return false, nil
+	}
+	values, err := parseProfile(string(content))
+	if err != nil {
+		// none of the values of an invalid version are applied, the next poll fetches it again
+		return false, fmt.Errorf("Unable to parse version %s of SUMO_APPCONFIG_PROFILE: %v", version, err)
+	}
+	appConfig.version = version
+	return setLayer(SourceAppConfig, values), nil
+}
+
+func parseProfile(content string) (map[string]string, error) {
+	if strings.HasPrefix(strings.TrimSpace(content), "{") {
+		return parseConfigJSON(content)
+	}
+	file, err := parseConfigFile(content)
+	if err != nil {
+		return nil, err
+	}
+	return file.values(currentEnv()["SUMO_PROFILE"].value)
+}
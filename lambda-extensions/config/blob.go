@@ -0,0 +1,120 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// knownConfigEnv are the env vars the config is read from, which are the keys accepted in SUMO_CONFIG_JSON
+var knownConfigEnv = []string{
+	"SOURCE_CATEGORY_OVERRIDE", "SOURCE_HOST_OVERRIDE", "SOURCE_NAME_OVERRIDE", "SUMO_ACCOUNT_ALIAS",
+	"SUMO_ALIAS_ENDPOINT_MAP", "SUMO_ALLOW_INSECURE", "SUMO_ANALYTICS", "SUMO_APPCONFIG_POLL_SEC",
+	"SUMO_APPCONFIG_PROFILE", "SUMO_AUTOTUNE", "SUMO_AUTOTUNE_MAX_BATCH_AGE_MS",
+	"SUMO_AUTOTUNE_MAX_CONCURRENT_REQUESTS", "SUMO_BREAKER_COOLDOWN_MS", "SUMO_BREAKER_THRESHOLD",
+	"SUMO_CATCHUP_MAX_AGE_SEC", "SUMO_CATCHUP_MAX_BYTES", "SUMO_CLOUDWATCH_FORMAT",
+	"SUMO_COALESCE_MAX_AGE_SEC", "SUMO_COALESCE_MAX_KB", "SUMO_COMMIT_WEBHOOK_URL", "SUMO_CONFIG_FILE",
+	"SUMO_CONFIG_REFRESH_INTERVAL", "SUMO_CONFIG_STRICT", "SUMO_DEBUG_CAPTURE", "SUMO_DEBUG_CAPTURE_FILE",
+	"SUMO_DEBUG_CAPTURE_MINUTES", "SUMO_DEDUP_FILE", "SUMO_DEDUP_WINDOW", "SUMO_DIAL_TIMEOUT_MS", "SUMO_DISABLE",
+	"SUMO_ENABLED", "SUMO_ENABLE_CATCHUP", "SUMO_ENABLE_FAILOVER", "SUMO_ENDPOINT_PROBE_SEC", "SUMO_END_OF_STREAM",
+	"SUMO_ERROR_FINGERPRINT", "SUMO_EXCLUDE_EXTENSION_LOGS", "SUMO_EXPERIMENT_GROUPS", "SUMO_FAULT_CONTEXT_LINES",
+	"SUMO_FIELDS", "SUMO_FIELD_MAPPING_PRESET", "SUMO_FLEET_ID", "SUMO_FLUSH_INTERVAL_SEC",
+	"SUMO_HEARTBEAT_INTERVAL_MIN", "SUMO_HEARTBEAT_RECORD", "SUMO_HTTP_ENDPOINT", "SUMO_HTTP_ENDPOINTS",
+	"SUMO_HTTP_ENDPOINT_ENCRYPTED", "SUMO_HTTP_ENDPOINT_FILE", "SUMO_HTTP_ENDPOINT_SECRET_ARN",
+	"SUMO_HTTP_ENDPOINT_SECRET_TTL_SEC", "SUMO_LOG_LEVEL", "SUMO_LOG_TYPES", "SUMO_LOG_TYPE_CONFIG",
+	"SUMO_MAX_CONCURRENT_REQUESTS", "SUMO_MAX_DATAQUEUE_LENGTH", "SUMO_MAX_MEMORY_MB", "SUMO_MAX_PAYLOAD_KB_BY_TYPE",
+	"SUMO_MAX_RECORD_AGE_SEC", "SUMO_METRICS_ADDRESS", "SUMO_NUM_CONNECTION_RETRIES", "SUMO_NUM_RETRIES",
+	"SUMO_OUTCOME_METADATA", "SUMO_OUTPUT_FORMAT", "SUMO_OVERFLOW_BUFFER_MB", "SUMO_PAYLOAD_SIZE_ACCOUNTING",
+	"SUMO_PREFLIGHT_MODE", "SUMO_PROCESSING_SLEEP_TIME_MS", "SUMO_PROFILE", "SUMO_REGISTRATION_EVENTS",
+	"SUMO_RELOAD_ON_DRIFT", "SUMO_REQUEST_TIMEOUT_MS", "SUMO_RESOLVE_ACCOUNT_ALIAS", "SUMO_RESPONSE_TIMEOUT_MS",
+	"SUMO_RETRY_MAX_ELAPSED_TIME_MS", "SUMO_RETRY_SLEEP_TIME", "SUMO_RING_BUFFER_MB", "SUMO_S3_BUCKET_NAME",
+	"SUMO_S3_BUCKET_REGION", "SUMO_SECRET_SCAN", "SUMO_SELF_TELEMETRY", "SUMO_SHIP_SCHEDULE", "SUMO_SIGNING_KEY",
+	"SUMO_SLOW_INVOCATION_TAG", "SUMO_SPILL_TTL_MIN", "SUMO_STARTUP_WAIT_FILE", "SUMO_STARTUP_WAIT_TIMEOUT_MS",
+	"SUMO_STREAMING_THRESHOLD_KB", "SUMO_STRICT_SUBSCRIPTION", "SUMO_TIMESTAMP_SOURCE",
+	"SUMO_TLS_HANDSHAKE_TIMEOUT_MS", "SUMO_XRAY",
+}
+
+// applyConfigJSON sets the layer of the config env vars of SUMO_CONFIG_JSON and returns them, so that many
+// functions can share one env var while a function can still override a single setting. The blob is a JSON
+// object of the config env vars to strings, numbers, booleans or lists, e.g.
+// {"SUMO_HTTP_ENDPOINT": "ssm:///sumo/endpoint", "SUMO_LOG_TYPES": ["platform", "function"]}
+func applyConfigJSON() (map[string]string, error) {
+	blob := os.Getenv("SUMO_CONFIG_JSON")
+	if blob == "" {
+		return nil, nil
+	}
+	values, err := parseConfigJSON(blob)
+	setLayer(SourceConfigJSON, values)
+	if err != nil {
+		return values, fmt.Errorf("Unable to parse SUMO_CONFIG_JSON: %v", err)
+	}
+	return values, nil
+}
+
+// parseConfigJSON returns the values of the known keys of the blob along with the problems found
+func parseConfigJSON(blob string) (map[string]string, error) {
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(blob))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	var allErrors []string
+	var unknownKeys []string
+	for key, value := range raw {
+		if !utils.StringInSlice(key, knownConfigEnv) {
+			unknownKeys = append(unknownKeys, key)
+			continue
+		}
+		encoded, err := configJSONValue(value)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("%s %v", key, err))
+			continue
+		}
+		values[key] = encoded
+	}
+	// sorted as the map order is random
+	sort.Strings(allErrors)
+	if len(unknownKeys) > 0 {
+		sort.Strings(unknownKeys)
+		allErrors = append(allErrors, fmt.Sprintf("unknown keys %s", strings.Join(unknownKeys, " ")))
+	}
+	if len(allErrors) > 0 {
+		return values, errors.New(strings.Join(allErrors, ", "))
+	}
+	return values, nil
+}
+
+// configJSONValue converts a value to its env var format, lists are joined with commas
+func configJSONValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, isList := item.([]interface{}); isList {
+				return "", errors.New("can not be a nested list")
+			}
+			encoded, err := configJSONValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, encoded)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", errors.New("must be a string, a number, a boolean or a list of them")
+	}
+}
@@ -1,14 +1,17 @@
 package config
 
 import (
+	"compress/gzip"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/fields"
 	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
 
 	"github.com/sirupsen/logrus"
@@ -17,75 +20,307 @@ import (
 // LambdaExtensionConfig config for storing all configurable parameters
 type LambdaExtensionConfig struct {
 	SumoHTTPEndpoint       string
+	AliasEndpoints         map[string]string
+	EndpointCandidates     []EndpointCandidate
+	EndpointProbeInterval  time.Duration
 	EnableFailover         bool
 	S3BucketName           string
 	S3BucketRegion         string
 	NumRetry               int
+	NumConnectionRetries   int
 	AWSLambdaRuntimeAPI    string
 	LogTypes               []string
 	FunctionName           string
 	FunctionVersion        string
+	ExecutionEnv           string
+	LogFormat              string
+	FunctionMemorySize     int
 	LogLevel               logrus.Level
 	MaxDataQueueLength     int
+	RingBufferSize         int
+	OverflowBufferSize     int
+	MaxMemory              int
 	MaxConcurrentRequests  int
 	ProcessingSleepTime    time.Duration
-	MaxRetryAttempts       int
 	RetrySleepTime         time.Duration
-	ConnectionTimeoutValue time.Duration
+	DialTimeout            time.Duration
+	TLSHandshakeTimeout    time.Duration
+	ResponseTimeout        time.Duration
+	RequestTimeout         time.Duration
 	MaxDataPayloadSize     int
+	PayloadSizeByType      map[string]int
+	LogTypeConfig          map[string]LogTypeSettings
+	ShipSchedule           *ShipSchedule
+	StreamingThreshold     int
+	MaxRecordAge           time.Duration
+	EnableCatchUp          bool
+	CatchUpMaxAge          time.Duration
+	CatchUpMaxBytes        int64
+	EnableEndOfStream      bool
+	FlushInterval          time.Duration
+	ExcludeExtensionLogs   bool
+	EnableErrorFingerprint bool
+	CloudWatchFormat       bool
+	ExperimentGroups       string
+	ExperimentGroup        string
+	FleetID                string
+	AccountAlias           string
+	ResolveAccountAlias    bool
+	StrictSubscription     bool
+	StrictConfig           bool
+	PreflightMode          string
+	RegistrationEvents     []string
+	SpillTTL               time.Duration
+	DedupWindow            int
+	DedupFile              string
+	AppConfigProfile       string
+	AppConfigPollInterval  time.Duration
+	ConfigRefreshInterval  time.Duration
+	EndpointSecretTTL      time.Duration
+	EnableXRay             bool
+	XRayDaemonAddress      string
+	EnableHeartbeat        bool
+	HeartbeatInterval      time.Duration
+	BreakerThreshold       int
+	BreakerCooldown        time.Duration
+	OutcomeMetadataMap     map[string]fields.Metadata
+	TimestampSource        string
+	EnableDebugCapture     bool
+	DebugCaptureFile       string
+	DebugCaptureDuration   time.Duration
+	SigningKey             string
+	FieldMappingPreset     string
+	OutputFormat           string
+	CommitWebhookURL       string
+	FaultContextLines      int
+	ReloadOnDrift          bool
+	EnableAnalytics        bool
+	MetricsAddress         string
 	LambdaRegion           string
 	SourceCategoryOverride string
+	StartupWaitFile        string
+	StartupWaitTimeout     time.Duration
+	EnableSelfTelemetry    bool
+	CompressionLevel       int
+	EnableAutotune         bool
+	AutotuneMaxConcurrency int
+	AutotuneMaxBatchAge    time.Duration
+	SecretScan             string
+	CoalesceMaxAge         time.Duration
+	CoalesceMaxBytes       int
+	PayloadSizeAccounting  string
+	AllowInsecure          bool
+	SlowInvocationTag      bool
+	RetryMaxElapsedTime    time.Duration
+	SourceHostOverride     string
+	SourceNameOverride     string
+	SumoFields             *fields.Fields
+
+	// loadedEnv is the config env the config was read from, to detect drift
+	loadedEnv map[string]string
+	// sources are the sources of the config env vars
+	sources map[string]string
+	// endpointFromSecret is set when the endpoint is the one of SUMO_HTTP_ENDPOINT_SECRET_ARN, which can rotate
+	endpointFromSecret bool
 }
 
 var validLogTypes = []string{"platform", "function", "extension"}
 
+var (
+	localSourcesOnce sync.Once
+	localSourcesErr  error
+)
+
+// Output formats of SUMO_OUTPUT_FORMAT, jsonLines sends the source metadata as headers of every request and
+// bulk as keys of every line too
+const (
+	OutputFormatJSONLines = "jsonLines"
+	OutputFormatBulk      = "bulk"
+)
+
+var validOutputFormats = []string{OutputFormatJSONLines, OutputFormatBulk}
+
+// Sources of SUMO_TIMESTAMP_SOURCE, the time the @timestamp key of the records is set to: record is the time
+// of the Logs API record and received the time the extension received it. Sumo Logic parses the first
+// timestamp of the lines, so both take precedence over the timestamps embedded in the messages. No header
+// selects the receipt time of Sumo Logic itself, it is used once timestamp parsing is disabled on the source.
+const (
+	TimestampSourceRecord   = "record"
+	TimestampSourceReceived = "received"
+)
+
+var validTimestampSources = []string{TimestampSourceRecord, TimestampSourceReceived}
+
+// Modes of SUMO_SECRET_SCAN, flag marks the records which look like they contain credentials with a security
+// event and redact also replaces the credentials
+const (
+	SecretScanFlag   = "flag"
+	SecretScanRedact = "redact"
+)
+
+var validSecretScanModes = []string{SecretScanFlag, SecretScanRedact}
+
+// Log formats of AWS_LAMBDA_LOG_FORMAT set by Lambda, the function records of the JSON format are objects
+const (
+	LogFormatText = "Text"
+	LogFormatJSON = "JSON"
+)
+
+// Modes of SUMO_PREFLIGHT_MODE, the probe of the endpoint at init is skipped when off, logged when failing
+// in warn and fails the init in fail. The probe of the failover bucket fails the init in fail only.
+const (
+	PreflightOff  = "off"
+	PreflightWarn = "warn"
+	PreflightFail = "fail"
+)
+
+var validPreflightModes = []string{PreflightOff, PreflightWarn, PreflightFail}
+
 // GetConfig to get config instance
 func GetConfig() (*LambdaExtensionConfig, error) {
+	return New()
+}
+
+// New builds the config from the env vars of the options, of the process and of the other sources, resolved
+// in their order of precedence, see sharedSources, so that custom runtimes and tests can build a config
+// without setting process env vars:
+//
+//	config.New(config.WithoutProcessEnv(), config.WithEndpoint(endpoint), config.WithLogTypes("function"))
+func New(opts ...Option) (*LambdaExtensionConfig, error) {
+	env := &envSource{values: map[string]string{}, processEnv: true}
+	for _, opt := range opts {
+		opt(env)
+	}
+
+	var sourcesErr, resolveErr error
+	if env.processEnv {
+		sourcesErr = applyLocalSources()
+		// resolving parameter and secret references first so that the values below are the resolved ones
+		env.settings, resolveErr = resolveLayers(processLayers(env.values), resolveCachedReference)
+	} else {
+		env.settings, _ = resolveLayers(map[string]map[string]string{SourceOption: env.values}, nil)
+	}
 
 	config := &LambdaExtensionConfig{
-		SumoHTTPEndpoint:       os.Getenv("SUMO_HTTP_ENDPOINT"),
-		S3BucketName:           os.Getenv("SUMO_S3_BUCKET_NAME"),
-		S3BucketRegion:         os.Getenv("SUMO_S3_BUCKET_REGION"),
-		AWSLambdaRuntimeAPI:    os.Getenv("AWS_LAMBDA_RUNTIME_API"),
-		FunctionName:           os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
-		FunctionVersion:        os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"),
-		LambdaRegion:           os.Getenv("AWS_REGION"),
-		SourceCategoryOverride: os.Getenv("SOURCE_CATEGORY_OVERRIDE"),
-		MaxRetryAttempts:       5,
+		SumoHTTPEndpoint:       env.Getenv("SUMO_HTTP_ENDPOINT"),
+		S3BucketName:           env.Getenv("SUMO_S3_BUCKET_NAME"),
+		S3BucketRegion:         env.Getenv("SUMO_S3_BUCKET_REGION"),
+		AWSLambdaRuntimeAPI:    env.Getenv("AWS_LAMBDA_RUNTIME_API"),
+		FunctionName:           env.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		FunctionVersion:        env.Getenv("AWS_LAMBDA_FUNCTION_VERSION"),
+		ExecutionEnv:           env.Getenv("AWS_EXECUTION_ENV"),
+		LogFormat:              env.Getenv("AWS_LAMBDA_LOG_FORMAT"),
+		LambdaRegion:           env.Getenv("AWS_REGION"),
+		SourceCategoryOverride: env.Getenv("SOURCE_CATEGORY_OVERRIDE"),
+		SourceHostOverride:     env.Getenv("SOURCE_HOST_OVERRIDE"),
+		SourceNameOverride:     env.Getenv("SOURCE_NAME_OVERRIDE"),
+		StartupWaitFile:        env.Getenv("SUMO_STARTUP_WAIT_FILE"),
+		SigningKey:             env.Getenv("SUMO_SIGNING_KEY"),
+		FieldMappingPreset:     env.Getenv("SUMO_FIELD_MAPPING_PRESET"),
+		OutputFormat:           env.Getenv("SUMO_OUTPUT_FORMAT"),
+		TimestampSource:        env.Getenv("SUMO_TIMESTAMP_SOURCE"),
+		SecretScan:             env.Getenv("SUMO_SECRET_SCAN"),
+		PayloadSizeAccounting:  env.Getenv("SUMO_PAYLOAD_SIZE_ACCOUNTING"),
+		PreflightMode:          env.Getenv("SUMO_PREFLIGHT_MODE"),
+		CommitWebhookURL:       env.Getenv("SUMO_COMMIT_WEBHOOK_URL"),
+		MetricsAddress:         env.Getenv("SUMO_METRICS_ADDRESS"),
+		ExperimentGroups:       env.Getenv("SUMO_EXPERIMENT_GROUPS"),
+		FleetID:                env.Getenv("SUMO_FLEET_ID"),
+		AccountAlias:           env.Getenv("SUMO_ACCOUNT_ALIAS"),
+		AppConfigProfile:       env.Getenv("SUMO_APPCONFIG_PROFILE"),
+		XRayDaemonAddress:      env.Getenv("AWS_XRAY_DAEMON_ADDRESS"),
 		RetrySleepTime:         300 * time.Millisecond,
-		ConnectionTimeoutValue: 10000 * time.Millisecond,
-		MaxDataPayloadSize:     1024 * 1024, // 1 MB
+		DialTimeout:            2000 * time.Millisecond,
+		TLSHandshakeTimeout:    3000 * time.Millisecond,
+		ResponseTimeout:        10000 * time.Millisecond,
+		RequestTimeout:         30000 * time.Millisecond,
+		CompressionLevel:       gzip.DefaultCompression,
 	}
 
-	(*config).setDefaults()
+	config.loadedEnv = configEnv()
+	secretErr := (*config).applyEndpointSecret(env)
+	config.sources = configSources(env)
+	(*config).setDefaults(env)
 
-	err := (*config).validateConfig()
+	err := (*config).validateConfig(env)
+	if sourcesErr != nil || resolveErr != nil || secretErr != nil {
+		err = joinErrors(sourcesErr, resolveErr, secretErr, err)
+	}
 
 	if err != nil {
 		return config, err
 	}
 	return config, nil
 }
-func (cfg *LambdaExtensionConfig) setDefaults() {
-	numRetry := os.Getenv("SUMO_NUM_RETRIES")
-	processingSleepTime := os.Getenv("SUMO_PROCESSING_SLEEP_TIME_MS")
-	logLevel := os.Getenv("SUMO_LOG_LEVEL")
-	maxDataQueueLength := os.Getenv("SUMO_MAX_DATAQUEUE_LENGTH")
-	maxConcurrentRequests := os.Getenv("SUMO_MAX_CONCURRENT_REQUESTS")
-	enableFailover := os.Getenv("SUMO_ENABLE_FAILOVER")
-	logTypes := os.Getenv("SUMO_LOG_TYPES")
+
+// applyLocalSources reads the config blob and then the config file once, whose values can be references as
+// well. The registration reads its env vars before the config is resolved, so it reads them too.
+func applyLocalSources() error {
+	localSourcesOnce.Do(func() {
+		blob, blobErr := applyConfigJSON()
+		localSourcesErr = joinErrors(blobErr, applyConfigFile(blob))
+	})
+	return localSourcesErr
+}
+
+// joinErrors combines the messages of the non nil errors
+func joinErrors(errs ...error) error {
+	var allErrors []string
+	for _, err := range errs {
+		if err != nil {
+			allErrors = append(allErrors, err.Error())
+		}
+	}
+	if len(allErrors) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(allErrors, ", "))
+}
+
+func (cfg *LambdaExtensionConfig) setDefaults(env *envSource) {
+	numRetry := env.Getenv("SUMO_NUM_RETRIES")
+	numConnectionRetries := env.Getenv("SUMO_NUM_CONNECTION_RETRIES")
+	processingSleepTime := env.Getenv("SUMO_PROCESSING_SLEEP_TIME_MS")
+	logLevel := env.Getenv("SUMO_LOG_LEVEL")
+	maxDataQueueLength := env.Getenv("SUMO_MAX_DATAQUEUE_LENGTH")
+	maxConcurrentRequests := env.Getenv("SUMO_MAX_CONCURRENT_REQUESTS")
+	enableFailover := env.Getenv("SUMO_ENABLE_FAILOVER")
+	logTypes, logTypesFound := env.LookupEnv("SUMO_LOG_TYPES")
+	startupWaitTimeout := env.Getenv("SUMO_STARTUP_WAIT_TIMEOUT_MS")
+	autotuneMaxConcurrency := env.Getenv("SUMO_AUTOTUNE_MAX_CONCURRENT_REQUESTS")
+	autotuneMaxBatchAge := env.Getenv("SUMO_AUTOTUNE_MAX_BATCH_AGE_MS")
+	streamingThreshold := env.Getenv("SUMO_STREAMING_THRESHOLD_KB")
+	catchUpMaxAge := env.Getenv("SUMO_CATCHUP_MAX_AGE_SEC")
+	catchUpMaxBytes := env.Getenv("SUMO_CATCHUP_MAX_BYTES")
+	debugCaptureFile, debugCaptureFileFound := env.LookupEnv("SUMO_DEBUG_CAPTURE_FILE")
+	debugCaptureMinutes := env.Getenv("SUMO_DEBUG_CAPTURE_MINUTES")
+	overflowBufferMB := env.Getenv("SUMO_OVERFLOW_BUFFER_MB")
+	faultContextLines := env.Getenv("SUMO_FAULT_CONTEXT_LINES")
+	breakerCooldown := env.Getenv("SUMO_BREAKER_COOLDOWN_MS")
+	dedupFile, dedupFileFound := env.LookupEnv("SUMO_DEDUP_FILE")
+	appConfigPoll := env.Getenv("SUMO_APPCONFIG_POLL_SEC")
+	endpointProbe := env.Getenv("SUMO_ENDPOINT_PROBE_SEC")
+	preflightMode := env.Getenv("SUMO_PREFLIGHT_MODE")
+	payloadSizeAccounting := env.Getenv("SUMO_PAYLOAD_SIZE_ACCOUNTING")
+	coalesceMaxKB := env.Getenv("SUMO_COALESCE_MAX_KB")
+	// a 128 MB function does not get the buffering footprint of a 10 GB one
+	tier := defaultMemoryTier(env)
 	if numRetry == "" {
 		cfg.NumRetry = 3
 	}
+	if numConnectionRetries == "" {
+		cfg.NumConnectionRetries = 3
+	}
 	if logLevel == "" {
 		cfg.LogLevel = logrus.InfoLevel
 	}
 	if maxDataQueueLength == "" {
-		cfg.MaxDataQueueLength = 20
+		cfg.MaxDataQueueLength = tier.maxDataQueueLength
 	}
 	if maxConcurrentRequests == "" {
-		cfg.MaxConcurrentRequests = 3
+		cfg.MaxConcurrentRequests = tier.maxConcurrentRequests
 	}
+	cfg.MaxDataPayloadSize = tier.maxDataPayloadSize
 
 	if enableFailover == "" {
 		cfg.EnableFailover = false
@@ -93,29 +328,157 @@ func (cfg *LambdaExtensionConfig) setDefaults() {
 	if cfg.AWSLambdaRuntimeAPI == "" {
 		cfg.AWSLambdaRuntimeAPI = "127.0.0.1:9001"
 	}
-	if logTypes == "" {
+	if !logTypesFound {
 		cfg.LogTypes = validLogTypes
+	} else if logTypes == "" {
+		// explicitly empty, no logs are subscribed to
+		cfg.LogTypes = nil
 	} else {
 		cfg.LogTypes = strings.Split(logTypes, ",")
 	}
 	if processingSleepTime == "" {
 		cfg.ProcessingSleepTime = 0 * time.Millisecond
 	}
+	if startupWaitTimeout == "" {
+		cfg.StartupWaitTimeout = 2000 * time.Millisecond
+	}
+	if autotuneMaxConcurrency == "" {
+		cfg.AutotuneMaxConcurrency = 10
+	}
+	if autotuneMaxBatchAge == "" {
+		cfg.AutotuneMaxBatchAge = 500 * time.Millisecond
+	}
+	if coalesceMaxKB == "" {
+		cfg.CoalesceMaxBytes = 256 * 1024
+	}
+	// the batches are at most MaxDataPayloadSize, the largest of them are streamed
+	if streamingThreshold == "" {
+		cfg.StreamingThreshold = tier.maxDataPayloadSize / 2
+	}
+	if catchUpMaxAge == "" {
+		cfg.CatchUpMaxAge = 3600 * time.Second
+	}
+	if catchUpMaxBytes == "" {
+		cfg.CatchUpMaxBytes = 10 * 1024 * 1024 // 10 MB
+	}
+	// /tmp is shared with the function, setting SUMO_DEBUG_CAPTURE_FILE empty disables the control file
+	if !debugCaptureFileFound {
+		cfg.DebugCaptureFile = "/tmp/sumo-debug-capture"
+	} else {
+		cfg.DebugCaptureFile = debugCaptureFile
+	}
+	if debugCaptureMinutes == "" {
+		cfg.DebugCaptureDuration = 15 * time.Minute
+	}
+	if appConfigPoll == "" {
+		cfg.AppConfigPollInterval = 45 * time.Second
+	}
+	if endpointProbe == "" {
+		cfg.EndpointProbeInterval = 5 * time.Minute
+	}
+	if preflightMode == "" {
+		cfg.PreflightMode = PreflightOff
+	}
+	if payloadSizeAccounting == "" {
+		cfg.PayloadSizeAccounting = PayloadAccountingRecords
+	}
+	// setting SUMO_DEDUP_FILE empty keeps the sent batches in memory only
+	if !dedupFileFound {
+		cfg.DedupFile = "/tmp/sumo-dedup"
+	} else {
+		cfg.DedupFile = dedupFile
+	}
+	if overflowBufferMB == "" {
+		cfg.OverflowBufferSize = 8 * 1024 * 1024 // 8 MB
+	}
+	if breakerCooldown == "" {
+		cfg.BreakerCooldown = 30000 * time.Millisecond
+	}
+	if faultContextLines == "" {
+		cfg.FaultContextLines = 20
+	}
 
 }
 
-func (cfg *LambdaExtensionConfig) validateConfig() error {
-	numRetry := os.Getenv("SUMO_NUM_RETRIES")
-	logLevel := os.Getenv("SUMO_LOG_LEVEL")
-	maxDataQueueLength := os.Getenv("SUMO_MAX_DATAQUEUE_LENGTH")
-	maxConcurrentRequests := os.Getenv("SUMO_MAX_CONCURRENT_REQUESTS")
-	enableFailover := os.Getenv("SUMO_ENABLE_FAILOVER")
-	processingSleepTime := os.Getenv("SUMO_PROCESSING_SLEEP_TIME_MS")
+func (cfg *LambdaExtensionConfig) validateConfig(env *envSource) error {
+	numRetry := env.Getenv("SUMO_NUM_RETRIES")
+	numConnectionRetries := env.Getenv("SUMO_NUM_CONNECTION_RETRIES")
+	logLevel := env.Getenv("SUMO_LOG_LEVEL")
+	maxDataQueueLength := env.Getenv("SUMO_MAX_DATAQUEUE_LENGTH")
+	maxConcurrentRequests := env.Getenv("SUMO_MAX_CONCURRENT_REQUESTS")
+	ringBufferMB := env.Getenv("SUMO_RING_BUFFER_MB")
+	overflowBufferMB := env.Getenv("SUMO_OVERFLOW_BUFFER_MB")
+	maxMemoryMB := env.Getenv("SUMO_MAX_MEMORY_MB")
+	faultContextLines := env.Getenv("SUMO_FAULT_CONTEXT_LINES")
+	dedupWindow := env.Getenv("SUMO_DEDUP_WINDOW")
+	dialTimeout := env.Getenv("SUMO_DIAL_TIMEOUT_MS")
+	tlsHandshakeTimeout := env.Getenv("SUMO_TLS_HANDSHAKE_TIMEOUT_MS")
+	responseTimeout := env.Getenv("SUMO_RESPONSE_TIMEOUT_MS")
+	requestTimeout := env.Getenv("SUMO_REQUEST_TIMEOUT_MS")
+	retrySleepTime := env.Getenv("SUMO_RETRY_SLEEP_TIME")
+	retryMaxElapsedTime := env.Getenv("SUMO_RETRY_MAX_ELAPSED_TIME_MS")
+	breakerThreshold := env.Getenv("SUMO_BREAKER_THRESHOLD")
+	breakerCooldown := env.Getenv("SUMO_BREAKER_COOLDOWN_MS")
+	enableFailover := env.Getenv("SUMO_ENABLE_FAILOVER")
+	processingSleepTime := env.Getenv("SUMO_PROCESSING_SLEEP_TIME_MS")
+	startupWaitTimeout := env.Getenv("SUMO_STARTUP_WAIT_TIMEOUT_MS")
+	enableSelfTelemetry := env.Getenv("SUMO_SELF_TELEMETRY")
+	enableAutotune := env.Getenv("SUMO_AUTOTUNE")
+	autotuneMaxConcurrency := env.Getenv("SUMO_AUTOTUNE_MAX_CONCURRENT_REQUESTS")
+	autotuneMaxBatchAge := env.Getenv("SUMO_AUTOTUNE_MAX_BATCH_AGE_MS")
+	streamingThreshold := env.Getenv("SUMO_STREAMING_THRESHOLD_KB")
+	maxRecordAge := env.Getenv("SUMO_MAX_RECORD_AGE_SEC")
+	functionMemorySize := env.Getenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE")
+	enableCatchUp := env.Getenv("SUMO_ENABLE_CATCHUP")
+	catchUpMaxAge := env.Getenv("SUMO_CATCHUP_MAX_AGE_SEC")
+	catchUpMaxBytes := env.Getenv("SUMO_CATCHUP_MAX_BYTES")
+	enableEndOfStream := env.Getenv("SUMO_END_OF_STREAM")
+	flushInterval := env.Getenv("SUMO_FLUSH_INTERVAL_SEC")
+	excludeExtensionLogs := env.Getenv("SUMO_EXCLUDE_EXTENSION_LOGS")
+	enableErrorFingerprint := env.Getenv("SUMO_ERROR_FINGERPRINT")
+	cloudWatchFormat := env.Getenv("SUMO_CLOUDWATCH_FORMAT")
+	aliasEndpointMap := env.Getenv("SUMO_ALIAS_ENDPOINT_MAP")
+	payloadSizeByType := env.Getenv("SUMO_MAX_PAYLOAD_KB_BY_TYPE")
+	logTypeConfig := env.Getenv("SUMO_LOG_TYPE_CONFIG")
+	shipSchedule := env.Getenv("SUMO_SHIP_SCHEDULE")
+	endpointCandidates := env.Getenv("SUMO_HTTP_ENDPOINTS")
+	endpointProbe := env.Getenv("SUMO_ENDPOINT_PROBE_SEC")
+	reloadOnDrift := env.Getenv("SUMO_RELOAD_ON_DRIFT")
+	enableAnalytics := env.Getenv("SUMO_ANALYTICS")
+	outcomeMetadata := env.Getenv("SUMO_OUTCOME_METADATA")
+	resolveAccountAlias := env.Getenv("SUMO_RESOLVE_ACCOUNT_ALIAS")
+	strictSubscription := env.Getenv("SUMO_STRICT_SUBSCRIPTION")
+	strictConfig := env.Getenv("SUMO_CONFIG_STRICT")
+	enableXRay := env.Getenv("SUMO_XRAY")
+	enableHeartbeat := env.Getenv("SUMO_HEARTBEAT_RECORD")
+	heartbeatInterval := env.Getenv("SUMO_HEARTBEAT_INTERVAL_MIN")
+	spillTTL := env.Getenv("SUMO_SPILL_TTL_MIN")
+	coalesceMaxAge := env.Getenv("SUMO_COALESCE_MAX_AGE_SEC")
+	coalesceMaxKB := env.Getenv("SUMO_COALESCE_MAX_KB")
+	appConfigPoll := env.Getenv("SUMO_APPCONFIG_POLL_SEC")
+	configRefreshInterval := env.Getenv("SUMO_CONFIG_REFRESH_INTERVAL")
+	endpointSecretTTL := env.Getenv("SUMO_HTTP_ENDPOINT_SECRET_TTL_SEC")
+	enableDebugCapture := env.Getenv("SUMO_DEBUG_CAPTURE")
+	debugCaptureMinutes := env.Getenv("SUMO_DEBUG_CAPTURE_MINUTES")
+	allowInsecure := env.Getenv("SUMO_ALLOW_INSECURE")
+	slowInvocationTag := env.Getenv("SUMO_SLOW_INVOCATION_TAG")
+	sumoFields := env.Getenv("SUMO_FIELDS")
 
 	var allErrors []string
 	var err error
 
-	if cfg.SumoHTTPEndpoint == "" {
+	if aliasEndpointMap != "" {
+		cfg.AliasEndpoints, err = parseAliasEndpointMap(aliasEndpointMap)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_ALIAS_ENDPOINT_MAP: %v", err))
+		}
+	}
+
+	// SUMO_HTTP_ENDPOINT is the default for the aliases missing from the map, errors of the secret and of
+	// the ciphertext are reported by applyEndpointSecret
+	protectedEndpoint := env.Getenv("SUMO_HTTP_ENDPOINT_SECRET_ARN") != "" || env.Getenv("SUMO_HTTP_ENDPOINT_ENCRYPTED") != "" ||
+		env.Getenv("SUMO_HTTP_ENDPOINT_FILE") != ""
+	if cfg.SumoHTTPEndpoint == "" && aliasEndpointMap == "" && !protectedEndpoint {
 		allErrors = append(allErrors, "SUMO_HTTP_ENDPOINT not set in environment variable")
 	}
 
@@ -127,6 +490,24 @@ func (cfg *LambdaExtensionConfig) validateConfig() error {
 		}
 	}
 
+	if endpointCandidates != "" {
+		cfg.EndpointCandidates, err = parseEndpointCandidates(endpointCandidates)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_HTTP_ENDPOINTS: %v", err))
+		}
+	}
+
+	if endpointProbe != "" {
+		customEndpointProbe, err := parseDuration(endpointProbe, time.Second)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_ENDPOINT_PROBE_SEC: %v", err))
+		} else if customEndpointProbe < 0 {
+			allErrors = append(allErrors, "SUMO_ENDPOINT_PROBE_SEC can not be negative")
+		} else {
+			cfg.EndpointProbeInterval = customEndpointProbe
+		}
+	}
+
 	if enableFailover != "" {
 		cfg.EnableFailover, err = strconv.ParseBool(enableFailover)
 		if err != nil {
@@ -134,6 +515,338 @@ func (cfg *LambdaExtensionConfig) validateConfig() error {
 		}
 	}
 
+	if enableSelfTelemetry != "" {
+		cfg.EnableSelfTelemetry, err = strconv.ParseBool(enableSelfTelemetry)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_SELF_TELEMETRY: %v", err))
+		}
+	}
+
+	if enableAutotune != "" {
+		cfg.EnableAutotune, err = strconv.ParseBool(enableAutotune)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_AUTOTUNE: %v", err))
+		}
+	}
+
+	if autotuneMaxConcurrency != "" {
+		customAutotuneMaxConcurrency, err := strconv.ParseInt(autotuneMaxConcurrency, 10, 32)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_AUTOTUNE_MAX_CONCURRENT_REQUESTS: %v", err))
+		} else {
+			cfg.AutotuneMaxConcurrency = int(customAutotuneMaxConcurrency)
+		}
+	}
+
+	if autotuneMaxBatchAge != "" {
+		customAutotuneMaxBatchAge, err := parseDuration(autotuneMaxBatchAge, time.Millisecond)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_AUTOTUNE_MAX_BATCH_AGE_MS: %v", err))
+		} else {
+			cfg.AutotuneMaxBatchAge = customAutotuneMaxBatchAge
+		}
+	}
+
+	if streamingThreshold != "" {
+		customStreamingThreshold, err := strconv.ParseInt(streamingThreshold, 10, 32)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_STREAMING_THRESHOLD_KB: %v", err))
+		} else {
+			cfg.StreamingThreshold = int(customStreamingThreshold) * 1024
+		}
+	}
+
+	if maxRecordAge != "" {
+		customMaxRecordAge, err := parseDuration(maxRecordAge, time.Second)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_MAX_RECORD_AGE_SEC: %v", err))
+		} else {
+			cfg.MaxRecordAge = customMaxRecordAge
+		}
+	}
+
+	if functionMemorySize != "" {
+		customFunctionMemorySize, err := strconv.ParseInt(functionMemorySize, 10, 32)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse AWS_LAMBDA_FUNCTION_MEMORY_SIZE: %v", err))
+		} else {
+			cfg.FunctionMemorySize = int(customFunctionMemorySize)
+		}
+	}
+
+	if enableCatchUp != "" {
+		cfg.EnableCatchUp, err = strconv.ParseBool(enableCatchUp)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_ENABLE_CATCHUP: %v", err))
+		}
+	}
+
+	if catchUpMaxAge != "" {
+		customCatchUpMaxAge, err := parseDuration(catchUpMaxAge, time.Second)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_CATCHUP_MAX_AGE_SEC: %v", err))
+		} else {
+			cfg.CatchUpMaxAge = customCatchUpMaxAge
+		}
+	}
+
+	if catchUpMaxBytes != "" {
+		customCatchUpMaxBytes, err := strconv.ParseInt(catchUpMaxBytes, 10, 64)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_CATCHUP_MAX_BYTES: %v", err))
+		} else {
+			cfg.CatchUpMaxBytes = customCatchUpMaxBytes
+		}
+	}
+
+	if enableEndOfStream != "" {
+		cfg.EnableEndOfStream, err = strconv.ParseBool(enableEndOfStream)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_END_OF_STREAM: %v", err))
+		}
+	}
+
+	if flushInterval != "" {
+		customFlushInterval, err := parseDuration(flushInterval, time.Second)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_FLUSH_INTERVAL_SEC: %v", err))
+		} else {
+			cfg.FlushInterval = customFlushInterval
+		}
+	}
+
+	if excludeExtensionLogs != "" {
+		cfg.ExcludeExtensionLogs, err = strconv.ParseBool(excludeExtensionLogs)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_EXCLUDE_EXTENSION_LOGS: %v", err))
+		}
+	}
+
+	if slowInvocationTag != "" {
+		cfg.SlowInvocationTag, err = strconv.ParseBool(slowInvocationTag)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_SLOW_INVOCATION_TAG: %v", err))
+		}
+	}
+
+	if enableErrorFingerprint != "" {
+		cfg.EnableErrorFingerprint, err = strconv.ParseBool(enableErrorFingerprint)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_ERROR_FINGERPRINT: %v", err))
+		}
+	}
+
+	if cloudWatchFormat != "" {
+		cfg.CloudWatchFormat, err = strconv.ParseBool(cloudWatchFormat)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_CLOUDWATCH_FORMAT: %v", err))
+		}
+	}
+
+	if reloadOnDrift != "" {
+		cfg.ReloadOnDrift, err = strconv.ParseBool(reloadOnDrift)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_RELOAD_ON_DRIFT: %v", err))
+		}
+	}
+
+	if enableHeartbeat != "" {
+		cfg.EnableHeartbeat, err = strconv.ParseBool(enableHeartbeat)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_HEARTBEAT_RECORD: %v", err))
+		}
+	}
+
+	if heartbeatInterval != "" {
+		customHeartbeatInterval, err := parseDuration(heartbeatInterval, time.Minute)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_HEARTBEAT_INTERVAL_MIN: %v", err))
+		} else if customHeartbeatInterval < 0 {
+			allErrors = append(allErrors, "SUMO_HEARTBEAT_INTERVAL_MIN can not be negative")
+		} else {
+			cfg.HeartbeatInterval = customHeartbeatInterval
+		}
+	}
+
+	if spillTTL != "" {
+		customSpillTTL, err := parseDuration(spillTTL, time.Minute)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_SPILL_TTL_MIN: %v", err))
+		} else if customSpillTTL < 0 {
+			allErrors = append(allErrors, "SUMO_SPILL_TTL_MIN can not be negative")
+		} else {
+			cfg.SpillTTL = customSpillTTL
+		}
+	}
+
+	if coalesceMaxAge != "" {
+		customCoalesceMaxAge, err := parseDuration(coalesceMaxAge, time.Second)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_COALESCE_MAX_AGE_SEC: %v", err))
+		} else if customCoalesceMaxAge < 0 {
+			allErrors = append(allErrors, "SUMO_COALESCE_MAX_AGE_SEC can not be negative")
+		} else {
+			cfg.CoalesceMaxAge = customCoalesceMaxAge
+		}
+	}
+
+	if coalesceMaxKB != "" {
+		customCoalesceMaxKB, err := strconv.ParseInt(coalesceMaxKB, 10, 32)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_COALESCE_MAX_KB: %v", err))
+		} else if customCoalesceMaxKB < 0 {
+			allErrors = append(allErrors, "SUMO_COALESCE_MAX_KB can not be negative")
+		} else {
+			cfg.CoalesceMaxBytes = int(customCoalesceMaxKB) * 1024
+		}
+	}
+
+	if cfg.AppConfigProfile != "" {
+		parts := strings.Split(cfg.AppConfigProfile, "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			allErrors = append(allErrors, "SUMO_APPCONFIG_PROFILE is not in application/environment/profile format")
+			cfg.AppConfigProfile = ""
+		}
+	}
+
+	if appConfigPoll != "" {
+		customAppConfigPoll, err := parseDuration(appConfigPoll, time.Second)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_APPCONFIG_POLL_SEC: %v", err))
+		} else if customAppConfigPoll < 0 {
+			allErrors = append(allErrors, "SUMO_APPCONFIG_POLL_SEC can not be negative")
+		} else {
+			cfg.AppConfigPollInterval = customAppConfigPoll
+		}
+	}
+
+	if configRefreshInterval != "" {
+		customConfigRefreshInterval, err := parseDuration(configRefreshInterval, time.Second)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_CONFIG_REFRESH_INTERVAL: %v", err))
+		} else if customConfigRefreshInterval < 0 {
+			allErrors = append(allErrors, "SUMO_CONFIG_REFRESH_INTERVAL can not be negative")
+		} else {
+			cfg.ConfigRefreshInterval = customConfigRefreshInterval
+		}
+	}
+
+	if endpointSecretTTL != "" {
+		customEndpointSecretTTL, err := parseDuration(endpointSecretTTL, time.Second)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_HTTP_ENDPOINT_SECRET_TTL_SEC: %v", err))
+		} else if customEndpointSecretTTL < 0 {
+			allErrors = append(allErrors, "SUMO_HTTP_ENDPOINT_SECRET_TTL_SEC can not be negative")
+		} else {
+			cfg.EndpointSecretTTL = customEndpointSecretTTL
+		}
+	}
+
+	if strictSubscription != "" {
+		cfg.StrictSubscription, err = strconv.ParseBool(strictSubscription)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_STRICT_SUBSCRIPTION: %v", err))
+		}
+	}
+
+	if strictConfig != "" {
+		cfg.StrictConfig, err = strconv.ParseBool(strictConfig)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_CONFIG_STRICT: %v", err))
+		}
+	}
+
+	if enableXRay != "" {
+		cfg.EnableXRay, err = strconv.ParseBool(enableXRay)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_XRAY: %v", err))
+		}
+	}
+
+	if resolveAccountAlias != "" {
+		cfg.ResolveAccountAlias, err = strconv.ParseBool(resolveAccountAlias)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_RESOLVE_ACCOUNT_ALIAS: %v", err))
+		}
+	}
+
+	if outcomeMetadata != "" {
+		cfg.OutcomeMetadataMap, err = parseOutcomeMetadata(outcomeMetadata)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_OUTCOME_METADATA: %v", err))
+		}
+	}
+
+	if enableAnalytics != "" {
+		cfg.EnableAnalytics, err = strconv.ParseBool(enableAnalytics)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_ANALYTICS: %v", err))
+		}
+	}
+
+	if enableDebugCapture != "" {
+		cfg.EnableDebugCapture, err = strconv.ParseBool(enableDebugCapture)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_DEBUG_CAPTURE: %v", err))
+		}
+	}
+
+	if debugCaptureMinutes != "" {
+		customDebugCaptureMinutes, err := parseDuration(debugCaptureMinutes, time.Minute)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_DEBUG_CAPTURE_MINUTES: %v", err))
+		} else {
+			cfg.DebugCaptureDuration = customDebugCaptureMinutes
+		}
+	}
+
+	if cfg.CommitWebhookURL != "" {
+		_, err = url.ParseRequestURI(cfg.CommitWebhookURL)
+		if err != nil {
+			allErrors = append(allErrors, "SUMO_COMMIT_WEBHOOK_URL is not Valid")
+		}
+	}
+
+	if cfg.MetricsAddress != "" {
+		_, _, err = net.SplitHostPort(cfg.MetricsAddress)
+		if err != nil {
+			allErrors = append(allErrors, "SUMO_METRICS_ADDRESS is not Valid")
+		}
+	}
+
+	if cfg.ExperimentGroups != "" {
+		if _, err := parseExperimentGroups(cfg.ExperimentGroups); err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_EXPERIMENT_GROUPS: %v", err))
+		}
+	}
+
+	if cfg.OutputFormat != "" && !utils.StringInSlice(cfg.OutputFormat, validOutputFormats) {
+		allErrors = append(allErrors, fmt.Sprintf("SUMO_OUTPUT_FORMAT %s is not one of %s", cfg.OutputFormat, strings.Join(validOutputFormats, ", ")))
+	}
+
+	if !utils.StringInSlice(cfg.PayloadSizeAccounting, validPayloadAccountings) {
+		allErrors = append(allErrors, fmt.Sprintf("SUMO_PAYLOAD_SIZE_ACCOUNTING %s is not one of %s", cfg.PayloadSizeAccounting, strings.Join(validPayloadAccountings, ", ")))
+	}
+
+	if cfg.SecretScan != "" && !utils.StringInSlice(cfg.SecretScan, validSecretScanModes) {
+		allErrors = append(allErrors, fmt.Sprintf("SUMO_SECRET_SCAN %s is not one of %s", cfg.SecretScan, strings.Join(validSecretScanModes, ", ")))
+	}
+
+	if cfg.PreflightMode != "" && !utils.StringInSlice(cfg.PreflightMode, validPreflightModes) {
+		allErrors = append(allErrors, fmt.Sprintf("SUMO_PREFLIGHT_MODE %s is not one of %s", cfg.PreflightMode, strings.Join(validPreflightModes, ", ")))
+	}
+
+	if cfg.FieldMappingPreset != "" {
+		if _, found := FieldMappingPresets[cfg.FieldMappingPreset]; !found {
+			allErrors = append(allErrors, fmt.Sprintf("SUMO_FIELD_MAPPING_PRESET %s is not one of winston, bunyan, zap, logback-json, python-json", cfg.FieldMappingPreset))
+		}
+	}
+
+	// records are left unchanged when SUMO_TIMESTAMP_SOURCE is not set
+	if cfg.TimestampSource != "" && !utils.StringInSlice(cfg.TimestampSource, validTimestampSources) {
+		allErrors = append(allErrors, fmt.Sprintf("SUMO_TIMESTAMP_SOURCE %s is not one of %s", cfg.TimestampSource, strings.Join(validTimestampSources, ", ")))
+	}
+
 	if cfg.EnableFailover == true {
 		if cfg.S3BucketName == "" {
 			allErrors = append(allErrors, "SUMO_S3_BUCKET_NAME not set in environment variable")
@@ -152,12 +865,30 @@ func (cfg *LambdaExtensionConfig) validateConfig() error {
 		}
 	}
 
+	if numConnectionRetries != "" {
+		customNumConnectionRetries, err := strconv.ParseInt(numConnectionRetries, 10, 32)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_NUM_CONNECTION_RETRIES: %v", err))
+		} else {
+			cfg.NumConnectionRetries = int(customNumConnectionRetries)
+		}
+	}
+
 	if processingSleepTime != "" {
-		customProcessingSleepTime, err := strconv.ParseInt(processingSleepTime, 10, 32)
+		customProcessingSleepTime, err := parseDuration(processingSleepTime, time.Millisecond)
 		if err != nil {
 			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_PROCESSING_SLEEP_TIME_MS: %v", err))
 		} else {
-			cfg.ProcessingSleepTime = time.Duration(customProcessingSleepTime) * time.Millisecond
+			cfg.ProcessingSleepTime = customProcessingSleepTime
+		}
+	}
+
+	if startupWaitTimeout != "" {
+		customStartupWaitTimeout, err := parseDuration(startupWaitTimeout, time.Millisecond)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_STARTUP_WAIT_TIMEOUT_MS: %v", err))
+		} else {
+			cfg.StartupWaitTimeout = customStartupWaitTimeout
 		}
 	}
 
@@ -170,6 +901,136 @@ func (cfg *LambdaExtensionConfig) validateConfig() error {
 		}
 
 	}
+	if ringBufferMB != "" {
+		customRingBufferMB, err := strconv.ParseInt(ringBufferMB, 10, 32)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_RING_BUFFER_MB: %v", err))
+		} else if customRingBufferMB < 0 {
+			allErrors = append(allErrors, "SUMO_RING_BUFFER_MB can not be negative")
+		} else {
+			cfg.RingBufferSize = int(customRingBufferMB) * 1024 * 1024
+		}
+	}
+	if faultContextLines != "" {
+		customFaultContextLines, err := strconv.ParseInt(faultContextLines, 10, 32)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_FAULT_CONTEXT_LINES: %v", err))
+		} else if customFaultContextLines < 0 {
+			allErrors = append(allErrors, "SUMO_FAULT_CONTEXT_LINES can not be negative")
+		} else {
+			cfg.FaultContextLines = int(customFaultContextLines)
+		}
+	}
+	if dedupWindow != "" {
+		customDedupWindow, err := strconv.ParseInt(dedupWindow, 10, 32)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_DEDUP_WINDOW: %v", err))
+		} else if customDedupWindow < 0 {
+			allErrors = append(allErrors, "SUMO_DEDUP_WINDOW can not be negative")
+		} else {
+			cfg.DedupWindow = int(customDedupWindow)
+		}
+	}
+	if dialTimeout != "" {
+		customDialTimeout, err := parseDuration(dialTimeout, time.Millisecond)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_DIAL_TIMEOUT_MS: %v", err))
+		} else if customDialTimeout < 0 {
+			allErrors = append(allErrors, "SUMO_DIAL_TIMEOUT_MS can not be negative")
+		} else {
+			cfg.DialTimeout = customDialTimeout
+		}
+	}
+	if tlsHandshakeTimeout != "" {
+		customTLSHandshakeTimeout, err := parseDuration(tlsHandshakeTimeout, time.Millisecond)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_TLS_HANDSHAKE_TIMEOUT_MS: %v", err))
+		} else if customTLSHandshakeTimeout < 0 {
+			allErrors = append(allErrors, "SUMO_TLS_HANDSHAKE_TIMEOUT_MS can not be negative")
+		} else {
+			cfg.TLSHandshakeTimeout = customTLSHandshakeTimeout
+		}
+	}
+	if breakerThreshold != "" {
+		customBreakerThreshold, err := strconv.ParseInt(breakerThreshold, 10, 32)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_BREAKER_THRESHOLD: %v", err))
+		} else if customBreakerThreshold < 0 {
+			allErrors = append(allErrors, "SUMO_BREAKER_THRESHOLD can not be negative")
+		} else {
+			cfg.BreakerThreshold = int(customBreakerThreshold)
+		}
+	}
+	if breakerCooldown != "" {
+		customBreakerCooldown, err := parseDuration(breakerCooldown, time.Millisecond)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_BREAKER_COOLDOWN_MS: %v", err))
+		} else if customBreakerCooldown < 0 {
+			allErrors = append(allErrors, "SUMO_BREAKER_COOLDOWN_MS can not be negative")
+		} else {
+			cfg.BreakerCooldown = customBreakerCooldown
+		}
+	}
+	if responseTimeout != "" {
+		customResponseTimeout, err := parseDuration(responseTimeout, time.Millisecond)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_RESPONSE_TIMEOUT_MS: %v", err))
+		} else if customResponseTimeout < 0 {
+			allErrors = append(allErrors, "SUMO_RESPONSE_TIMEOUT_MS can not be negative")
+		} else {
+			cfg.ResponseTimeout = customResponseTimeout
+		}
+	}
+	if requestTimeout != "" {
+		customRequestTimeout, err := parseDuration(requestTimeout, time.Millisecond)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_REQUEST_TIMEOUT_MS: %v", err))
+		} else if customRequestTimeout < 0 {
+			allErrors = append(allErrors, "SUMO_REQUEST_TIMEOUT_MS can not be negative")
+		} else {
+			cfg.RequestTimeout = customRequestTimeout
+		}
+	}
+	if retrySleepTime != "" {
+		customRetrySleepTime, err := parseDuration(retrySleepTime, time.Millisecond)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_RETRY_SLEEP_TIME: %v", err))
+		} else if customRetrySleepTime < 0 {
+			allErrors = append(allErrors, "SUMO_RETRY_SLEEP_TIME can not be negative")
+		} else {
+			cfg.RetrySleepTime = customRetrySleepTime
+		}
+	}
+	if retryMaxElapsedTime != "" {
+		customRetryMaxElapsedTime, err := parseDuration(retryMaxElapsedTime, time.Millisecond)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_RETRY_MAX_ELAPSED_TIME_MS: %v", err))
+		} else if customRetryMaxElapsedTime < 0 {
+			allErrors = append(allErrors, "SUMO_RETRY_MAX_ELAPSED_TIME_MS can not be negative")
+		} else {
+			cfg.RetryMaxElapsedTime = customRetryMaxElapsedTime
+		}
+	}
+	if overflowBufferMB != "" {
+		customOverflowBufferMB, err := strconv.ParseInt(overflowBufferMB, 10, 32)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_OVERFLOW_BUFFER_MB: %v", err))
+		} else if customOverflowBufferMB < 0 {
+			allErrors = append(allErrors, "SUMO_OVERFLOW_BUFFER_MB can not be negative")
+		} else {
+			cfg.OverflowBufferSize = int(customOverflowBufferMB) * 1024 * 1024
+		}
+	}
+	if maxMemoryMB != "" {
+		customMaxMemoryMB, err := strconv.ParseInt(maxMemoryMB, 10, 32)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_MAX_MEMORY_MB: %v", err))
+		} else if customMaxMemoryMB < 0 {
+			allErrors = append(allErrors, "SUMO_MAX_MEMORY_MB can not be negative")
+		} else {
+			cfg.MaxMemory = int(customMaxMemoryMB) * 1024 * 1024
+		}
+	}
 	if maxConcurrentRequests != "" {
 		customMaxConcurrentRequests, err := strconv.ParseInt(maxConcurrentRequests, 10, 32)
 		if err != nil {
@@ -189,6 +1050,103 @@ func (cfg *LambdaExtensionConfig) validateConfig() error {
 
 	}
 
+	if cfg.SourceCategoryOverride != "" {
+		metadata := fields.Metadata{Category: cfg.SourceCategoryOverride}
+		if err := metadata.Validate(); err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("SOURCE_CATEGORY_OVERRIDE is not valid: %v", err))
+		}
+	}
+	if cfg.SourceHostOverride != "" {
+		metadata := fields.Metadata{Host: cfg.SourceHostOverride}
+		if err := metadata.Validate(); err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("SOURCE_HOST_OVERRIDE is not valid: %v", err))
+		}
+	}
+	if cfg.SourceNameOverride != "" {
+		metadata := fields.Metadata{Name: cfg.SourceNameOverride}
+		if err := metadata.Validate(); err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("SOURCE_NAME_OVERRIDE is not valid: %v", err))
+		}
+	}
+
+	if sumoFields != "" {
+		cfg.SumoFields, err = fields.Parse(sumoFields)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_FIELDS: %v", err))
+		}
+	}
+
+	if cfg.FleetID != "" {
+		if err := fields.NewFields().Add("fleetId", cfg.FleetID); err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("SUMO_FLEET_ID is not valid: %v", err))
+		}
+	}
+
+	if cfg.AccountAlias != "" {
+		if err := fields.NewFields().Add("accountAlias", cfg.AccountAlias); err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("SUMO_ACCOUNT_ALIAS is not valid: %v", err))
+		}
+	}
+
+	if _, err := parseDisabled(env.Getenv); err != nil {
+		allErrors = append(allErrors, err.Error())
+	}
+
+	cfg.RegistrationEvents, err = parseRegistrationEvents(env.Getenv("SUMO_REGISTRATION_EVENTS"))
+	if err != nil {
+		allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_REGISTRATION_EVENTS: %v", err))
+		cfg.RegistrationEvents = validRegistrationEvents
+	}
+	if !cfg.RegisteredForInvoke() && cfg.FlushInterval == 0 {
+		cfg.FlushInterval = invokelessFlushInterval
+	}
+
+	if payloadSizeByType != "" {
+		cfg.PayloadSizeByType, err = parsePayloadSizeByType(payloadSizeByType)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_MAX_PAYLOAD_KB_BY_TYPE: %v", err))
+		}
+	}
+
+	if logTypeConfig != "" {
+		var sizes map[string]int
+		cfg.LogTypeConfig, sizes, err = parseLogTypeConfig(logTypeConfig)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_LOG_TYPE_CONFIG: %v", err))
+		}
+		// SUMO_MAX_PAYLOAD_KB_BY_TYPE takes precedence over the sizes of the blocks
+		for logType, size := range sizes {
+			if _, found := cfg.PayloadSizeByType[logType]; found {
+				continue
+			}
+			if cfg.PayloadSizeByType == nil {
+				cfg.PayloadSizeByType = map[string]int{}
+			}
+			cfg.PayloadSizeByType[logType] = size
+		}
+	}
+
+	if shipSchedule != "" {
+		cfg.ShipSchedule, err = parseShipSchedule(shipSchedule)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_SHIP_SCHEDULE: %v", err))
+		}
+	}
+
+	if allowInsecure != "" {
+		cfg.AllowInsecure, err = strconv.ParseBool(allowInsecure)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse SUMO_ALLOW_INSECURE: %v", err))
+		}
+	}
+	// checked once all the endpoints are parsed, SUMO_HTTP_ENDPOINT being the one of its secret by now
+	allErrors = append(allErrors, cfg.insecureEndpointErrors()...)
+
+	// the buffers are derived once the payload sizes and the explicit settings are known
+	if err = cfg.applyMemoryBudget(env); err != nil {
+		allErrors = append(allErrors, err.Error())
+	}
+
 	// test valid log format type
 	for _, logType := range cfg.LogTypes {
 		if !utils.StringInSlice(strings.TrimSpace(logType), validLogTypes) {
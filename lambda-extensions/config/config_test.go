@@ -0,0 +1,346 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func assertEqual(t *testing.T, a interface{}, b interface{}, message string) {
+	if a == b {
+		return
+	}
+	if len(message) == 0 {
+		message = fmt.Sprintf("%v != %v", a, b)
+	}
+	t.Error(message)
+}
+
+func TestDetectDrift(t *testing.T) {
+	os.Unsetenv("SUMO_LOG_LEVEL")
+	defer os.Unsetenv("SUMO_LOG_LEVEL")
+	cfg := &LambdaExtensionConfig{loadedEnv: configEnv()}
+	assertEqual(t, len(cfg.DetectDrift()), 0, "unchanged env should not drift")
+
+	os.Setenv("SUMO_LOG_LEVEL", "debug")
+	os.Setenv("UNRELATED_ENV", "value")
+	defer os.Unsetenv("UNRELATED_ENV")
+	changed := cfg.DetectDrift()
+	assertEqual(t, strings.Join(changed, ","), "SUMO_LOG_LEVEL", "added config env var should drift")
+	assertEqual(t, len(cfg.DetectDrift()), 0, "drift should be reported once")
+
+	os.Setenv("SUMO_LOG_LEVEL", "info")
+	assertEqual(t, strings.Join(cfg.DetectDrift(), ","), "SUMO_LOG_LEVEL", "changed config env var should drift")
+
+	os.Unsetenv("SUMO_LOG_LEVEL")
+	assertEqual(t, strings.Join(cfg.DetectDrift(), ","), "SUMO_LOG_LEVEL", "removed config env var should drift")
+}
+
+func TestParseDisabled(t *testing.T) {
+	tests := []struct {
+		disable  string
+		enabled  string
+		disabled bool
+		error    string
+	}{
+		{"", "", false, ""},
+		{"true", "", true, ""},
+		{"false", "", false, ""},
+		{"", "false", true, ""},
+		{"", "true", false, ""},
+		{"yes", "", false, "Unable to parse SUMO_DISABLE"},
+		{"", "off", false, "Unable to parse SUMO_ENABLED"},
+		{"true", "off", false, "Unable to parse SUMO_ENABLED"},
+		{"true", "false", true, ""},
+		{"false", "true", false, ""},
+		{"true", "true", false, "SUMO_DISABLE=true contradicts SUMO_ENABLED=true"},
+		{"0", "0", false, "SUMO_DISABLE=0 contradicts SUMO_ENABLED=0"},
+	}
+	for _, test := range tests {
+		env := map[string]string{"SUMO_DISABLE": test.disable, "SUMO_ENABLED": test.enabled}
+		disabled, err := parseDisabled(func(key string) string { return env[key] })
+		name := fmt.Sprintf("SUMO_DISABLE=%q SUMO_ENABLED=%q", test.disable, test.enabled)
+		assertEqual(t, disabled, test.disabled, name+": unexpected kill switch")
+		if test.error == "" {
+			assertEqual(t, err, nil, name+": kill switch should be valid")
+		} else {
+			assertEqual(t, err != nil && strings.Contains(err.Error(), test.error), true, name+": invalid value should be reported")
+		}
+	}
+
+	_, err := New(WithoutProcessEnv(), WithEndpoint("https://localhost/receiver"), WithEnv(map[string]string{"SUMO_DISABLE": "yes"}))
+	assertEqual(t, err != nil && strings.Contains(err.Error(), "Unable to parse SUMO_DISABLE"), true, "invalid kill switch should fail the validation")
+}
+
+// fakeResolver resolves the references to their name in upper case, the ones containing "missing" fail
+type fakeResolver struct {
+	calls int
+}
+
+func (r *fakeResolver) getParameter(name string) (string, error) {
+	r.calls++
+	if strings.Contains(name, "missing") {
+		return "", fmt.Errorf("parameter %s not found", name)
+	}
+	return strings.ToUpper(name), nil
+}
+
+func (r *fakeResolver) getSecret(secretID string) (string, error) {
+	return r.getParameter(secretID)
+}
+
+func TestResolveLayers(t *testing.T) {
+	resolver := &fakeResolver{}
+	resolve := func(reference string) (string, error) { return resolveReference(resolver, reference) }
+	tests := []struct {
+		name   string
+		layers map[string]map[string]string
+		value  string
+		source string
+	}{
+		{"file", map[string]map[string]string{SourceConfigFile: {"SUMO_LOG_LEVEL": "debug"}}, "debug", SourceConfigFile},
+		{"blob over file", map[string]map[string]string{
+			SourceConfigFile: {"SUMO_LOG_LEVEL": "debug"}, SourceConfigJSON: {"SUMO_LOG_LEVEL": "info"},
+		}, "info", SourceConfigJSON},
+		{"AppConfig over blob", map[string]map[string]string{
+			SourceConfigJSON: {"SUMO_LOG_LEVEL": "info"}, SourceAppConfig: {"SUMO_LOG_LEVEL": "warn"},
+		}, "warn", SourceAppConfig},
+		{"SSM over file and blob", map[string]map[string]string{
+			SourceConfigFile: {"SUMO_LOG_LEVEL": "ssm:///debug"}, SourceConfigJSON: {"SUMO_LOG_LEVEL": "info"},
+		}, "/DEBUG", SourceSSM},
+		{"Secrets Manager over AppConfig", map[string]map[string]string{
+			SourceConfigJSON: {"SUMO_LOG_LEVEL": "secretsmanager://debug"}, SourceAppConfig: {"SUMO_LOG_LEVEL": "warn"},
+		}, "DEBUG", SourceSecretsManager},
+		{"env over SSM", map[string]map[string]string{
+			SourceConfigFile: {"SUMO_LOG_LEVEL": "ssm:///debug"}, SourceEnv: {"SUMO_LOG_LEVEL": "error"},
+		}, "error", SourceEnv},
+		{"env reference", map[string]map[string]string{
+			SourceConfigJSON: {"SUMO_LOG_LEVEL": "info"}, SourceEnv: {"SUMO_LOG_LEVEL": "ssm:///trace"},
+		}, "/TRACE", SourceSSM},
+		{"startup file over SSM", map[string]map[string]string{
+			SourceConfigFile: {"SUMO_LOG_LEVEL": "ssm:///debug"}, SourceStartupFile: {"SUMO_LOG_LEVEL": "info"},
+		}, "info", SourceStartupFile},
+		{"env over startup file", map[string]map[string]string{
+			SourceStartupFile: {"SUMO_LOG_LEVEL": "info"}, SourceEnv: {"SUMO_LOG_LEVEL": "error"},
+		}, "error", SourceEnv},
+		{"experiment over env", map[string]map[string]string{
+			SourceEnv: {"SUMO_LOG_LEVEL": "error"}, SourceExperiment: {"SUMO_LOG_LEVEL": "debug"},
+		}, "debug", SourceExperiment},
+		{"option over experiment", map[string]map[string]string{
+			SourceExperiment: {"SUMO_LOG_LEVEL": "debug"}, SourceOption: {"SUMO_LOG_LEVEL": "warn"},
+		}, "warn", SourceOption},
+		{"failed reference", map[string]map[string]string{
+			SourceConfigFile: {"SUMO_LOG_LEVEL": "ssm:///missing"},
+		}, "ssm:///missing", SourceConfigFile},
+		{"not a config env var", map[string]map[string]string{
+			SourceEnv: {"AWS_REGION": "ssm:///region"},
+		}, "", ""},
+	}
+	for _, test := range tests {
+		settings, err := resolveLayers(test.layers, resolve)
+		key := "SUMO_LOG_LEVEL"
+		if test.name == "not a config env var" {
+			key = "AWS_REGION"
+			test.value, test.source = "ssm:///region", SourceEnv
+		}
+		assertEqual(t, settings[key].value, test.value, fmt.Sprintf("%s: %s != %s", test.name, settings[key].value, test.value))
+		assertEqual(t, settings[key].source, test.source, fmt.Sprintf("%s: source %s != %s", test.name, settings[key].source, test.source))
+		if test.name == "failed reference" {
+			assertEqual(t, err != nil && strings.Contains(err.Error(), "Unable to resolve SUMO_LOG_LEVEL"), true, "failed reference should be reported")
+		} else {
+			assertEqual(t, err, nil, test.name+": layers should be resolved")
+		}
+	}
+
+	resolver.calls = 0
+	settings, _ := resolveLayers(map[string]map[string]string{
+		SourceConfigFile: {"SUMO_LOG_LEVEL": "ssm:///debug"}, SourceEnv: {"SUMO_LOG_LEVEL": "error"},
+	}, resolve)
+	assertEqual(t, settings["SUMO_LOG_LEVEL"].value, "error", "overridden reference should not win")
+	assertEqual(t, resolver.calls, 0, "overridden reference should not be resolved")
+	settings, _ = resolveLayers(map[string]map[string]string{SourceEnv: {"SUMO_LOG_LEVEL": "ssm:///debug"}}, nil)
+	assertEqual(t, settings["SUMO_LOG_LEVEL"].value, "ssm:///debug", "references should be kept without resolver")
+}
+
+func TestNewDoesNotSetProcessEnv(t *testing.T) {
+	os.Unsetenv("SUMO_LOG_LEVEL")
+	os.Setenv("SUMO_HTTP_ENDPOINT", "https://localhost/receiver")
+	defer os.Unsetenv("SUMO_HTTP_ENDPOINT")
+	setLayer(SourceConfigFile, map[string]string{"SUMO_LOG_LEVEL": "debug", "SUMO_HTTP_ENDPOINT": "https://file.localhost/receiver"})
+	defer setLayer(SourceConfigFile, nil)
+
+	config, _ := New()
+	assertEqual(t, config.LogLevel.String(), "debug", "file layer should be read")
+	assertEqual(t, config.SumoHTTPEndpoint, "https://localhost/receiver", "env should override the file layer")
+	assertEqual(t, config.Sources()["SUMO_LOG_LEVEL"], SourceConfigFile, "setting should be sourced from the file")
+	assertEqual(t, config.Sources()["SUMO_HTTP_ENDPOINT"], SourceEnv, "setting should be sourced from the env")
+	_, found := os.LookupEnv("SUMO_LOG_LEVEL")
+	assertEqual(t, found, false, "file layer should not be set in the process env")
+
+	assertEqual(t, setLayer(SourceConfigFile, map[string]string{"SUMO_LOG_LEVEL": "debug", "SUMO_HTTP_ENDPOINT": "https://file.localhost/receiver"}), false, "unchanged layer should not change")
+	assertEqual(t, setLayer(SourceConfigFile, map[string]string{"SUMO_LOG_LEVEL": "info"}), true, "changed layer should change")
+	config, _ = New()
+	assertEqual(t, config.LogLevel.String(), "info", "config should read the layer set last")
+}
+
+func TestRefreshReferences(t *testing.T) {
+	resolver := &fakeResolver{}
+	resolvedReferences.mu.Lock()
+	resolvedReferences.resolver = resolver
+	resolvedReferences.values = map[string]string{}
+	resolvedReferences.mu.Unlock()
+	defer func() {
+		resolvedReferences.mu.Lock()
+		resolvedReferences.resolver, resolvedReferences.values = nil, map[string]string{}
+		resolvedReferences.mu.Unlock()
+	}()
+
+	value, err := resolveCachedReference("ssm:///debug")
+	assertEqual(t, err, nil, "reference should be resolved")
+	assertEqual(t, value, "/DEBUG", "reference should be resolved")
+	resolveCachedReference("ssm:///debug")
+	assertEqual(t, resolver.calls, 1, "resolved reference should be cached")
+	_, err = resolveCachedReference("ssm:///missing")
+	assertEqual(t, err != nil, true, "failed reference should be reported")
+
+	changed, err := refreshReferences()
+	assertEqual(t, err, nil, "references should be refreshed")
+	assertEqual(t, changed, false, "unchanged reference should not change")
+	resolvedReferences.values["ssm:///debug"] = "/OLD"
+	changed, _ = refreshReferences()
+	assertEqual(t, changed, true, "rotated reference should change")
+	assertEqual(t, resolvedReferences.values["ssm:///debug"], "/DEBUG", "rotated value should be cached")
+}
+
+func TestValidationErrors(t *testing.T) {
+	endpointFile, err := ioutil.TempFile("", "endpoint")
+	if err != nil {
+		t.Fatalf("Unable to create the endpoint file: %v", err)
+	}
+	defer os.Remove(endpointFile.Name())
+	endpointFile.WriteString(`{"SUMO_HTTP_ENDPOINT": "https://file.localhost/receiver"}`)
+	endpointFile.Close()
+
+	tests := []struct {
+		name   string
+		values map[string]string
+		err    string
+	}{
+		{"valid", map[string]string{"SUMO_NUM_RETRIES": "5", "SUMO_OUTPUT_FORMAT": "bulk"}, ""},
+		{"number", map[string]string{"SUMO_NUM_RETRIES": "five"}, "Unable to parse SUMO_NUM_RETRIES"},
+		{"enum", map[string]string{"SUMO_OUTPUT_FORMAT": "xml"}, "SUMO_OUTPUT_FORMAT xml is not one of jsonLines, bulk"},
+		{"experiment groups", map[string]string{"SUMO_EXPERIMENT_GROUPS": "small"}, "Unable to parse SUMO_EXPERIMENT_GROUPS"},
+		{"timestamp source", map[string]string{"SUMO_TIMESTAMP_SOURCE": "true"}, "SUMO_TIMESTAMP_SOURCE true is not one of record, received"},
+		{"negative duration", map[string]string{"SUMO_SPILL_TTL_MIN": "-1"}, "SUMO_SPILL_TTL_MIN can not be negative"},
+		{"kill switch", map[string]string{"SUMO_DISABLE": "maybe"}, "SUMO_DISABLE"},
+		{"contradicting kill switch", map[string]string{"SUMO_DISABLE": "true", "SUMO_ENABLED": "true"}, "SUMO_DISABLE=true contradicts SUMO_ENABLED=true"},
+		{"insecure endpoint", map[string]string{"SUMO_HTTP_ENDPOINT": "http://localhost/receiver"}, "SUMO_HTTP_ENDPOINT is not https"},
+		{"several endpoints", map[string]string{"SUMO_HTTP_ENDPOINT_FILE": endpointFile.Name()}, "only one of SUMO_HTTP_ENDPOINT"},
+		{"missing endpoint file", map[string]string{"SUMO_HTTP_ENDPOINT": "", "SUMO_HTTP_ENDPOINT_FILE": "/missing/endpoint"}, "Unable to read SUMO_HTTP_ENDPOINT_FILE"},
+	}
+	for _, test := range tests {
+		_, err := New(WithoutProcessEnv(), WithEndpoint("https://localhost/receiver"), WithEnv(test.values))
+		if test.err == "" {
+			assertEqual(t, err, nil, test.name+": config should be valid")
+		} else {
+			assertEqual(t, err != nil && strings.Contains(err.Error(), test.err), true, fmt.Sprintf("%s: %v should contain %s", test.name, err, test.err))
+		}
+	}
+
+	config, err := New(WithoutProcessEnv(), WithEnv(map[string]string{"SUMO_HTTP_ENDPOINT_FILE": endpointFile.Name()}))
+	assertEqual(t, err, nil, "endpoint file should be read")
+	assertEqual(t, config.SumoHTTPEndpoint, "https://file.localhost/receiver", "endpoint should be the SUMO_HTTP_ENDPOINT key of the file")
+}
+
+func TestParseEndpointValue(t *testing.T) {
+	for value, expected := range map[string]string{
+		" https://localhost/receiver\n":                        "https://localhost/receiver",
+		`{"SUMO_HTTP_ENDPOINT": "https://localhost/receiver"}`: "https://localhost/receiver",
+		`{"OTHER": "value"}`:                                   "",
+		`{"SUMO_HTTP_ENDPOINT": `:                              "",
+		"":                                                     "",
+	} {
+		endpoint, err := parseEndpointValue(value, "secret arn")
+		assertEqual(t, endpoint, expected, fmt.Sprintf("%q should hold the endpoint %q", value, expected))
+		assertEqual(t, err != nil, expected == "", fmt.Sprintf("%q should report the missing endpoint", value))
+	}
+}
+
+func TestEndpointSecretReload(t *testing.T) {
+	endpointSecret.setEndpoint("ciphertext", "https://kms.localhost/receiver")
+	defer endpointSecret.setEndpoint("", "")
+
+	// the reloads read the cached endpoint while it is rotated
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			endpointSecret.setEndpoint("ciphertext", fmt.Sprintf("https://kms.localhost/receiver/%d", i))
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		config, err := New(WithoutProcessEnv(), WithEnv(map[string]string{"SUMO_HTTP_ENDPOINT_ENCRYPTED": "ciphertext"}))
+		assertEqual(t, err, nil, "cached ciphertext should not be decrypted again")
+		assertEqual(t, strings.HasPrefix(config.SumoHTTPEndpoint, "https://kms.localhost/receiver"), true, "endpoint should be the cached one")
+	}
+	<-done
+}
+
+func TestParseConfigJSON(t *testing.T) {
+	values, err := parseConfigJSON(`{"SUMO_LOG_TYPES": ["platform", "function"], "SUMO_NUM_RETRIES": 5, "SUMO_ENABLE_FAILOVER": true}`)
+	assertEqual(t, err, nil, "blob should be parsed")
+	assertEqual(t, values["SUMO_LOG_TYPES"], "platform,function", "lists should be joined with commas")
+	assertEqual(t, values["SUMO_NUM_RETRIES"], "5", "numbers should be kept as written")
+	assertEqual(t, values["SUMO_ENABLE_FAILOVER"], "true", "booleans should be formatted")
+
+	values, err = parseConfigJSON(`{"SUMO_LOG_TYPES": [["platform"]], "SUMO_NUM_RETRY": 5, "SUMO_LOG_LEVEL": "debug"}`)
+	assertEqual(t, err != nil && err.Error() == "SUMO_LOG_TYPES can not be a nested list, unknown keys SUMO_NUM_RETRY", true, fmt.Sprintf("nested lists and unknown keys should be reported: %v", err))
+	assertEqual(t, values["SUMO_LOG_LEVEL"], "debug", "valid keys should be kept")
+
+	_, err = parseConfigJSON(`["SUMO_LOG_LEVEL"]`)
+	assertEqual(t, err != nil, true, "blob which is not an object should be reported")
+}
+
+func TestSourcesPrecedence(t *testing.T) {
+	file, err := ioutil.TempFile("", "sumo-extension.yaml")
+	if err != nil {
+		t.Fatalf("Unable to create the config file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("SUMO_LOG_LEVEL: debug\nSUMO_NUM_RETRIES: 4\nSUMO_MAX_CONCURRENT_REQUESTS: 2\nprofiles:\n  prod:\n    SUMO_NUM_RETRIES: 6\n")
+	file.Close()
+
+	for key, value := range map[string]string{
+		"SUMO_CONFIG_JSON":   fmt.Sprintf(`{"SUMO_CONFIG_FILE": %q, "SUMO_PROFILE": "prod", "SUMO_MAX_CONCURRENT_REQUESTS": 3}`, file.Name()),
+		"SUMO_HTTP_ENDPOINT": "https://localhost/receiver",
+	} {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+	defer setLayer(SourceConfigJSON, nil)
+	defer setLayer(SourceConfigFile, nil)
+	blob, err := applyConfigJSON()
+	assertEqual(t, err, nil, "blob should be applied")
+	assertEqual(t, applyConfigFile(blob), nil, "file named in the blob should be applied")
+
+	config, err := New()
+	assertEqual(t, err, nil, "config should be valid")
+	assertEqual(t, config.LogLevel.String(), "debug", "file should set the settings of no other source")
+	assertEqual(t, config.NumRetry, 6, "profile selected by the blob should override the file")
+	assertEqual(t, config.MaxConcurrentRequests, 3, "blob should override the file")
+	assertEqual(t, config.Sources()["SUMO_NUM_RETRIES"], SourceConfigFile, "setting should be sourced from the file")
+	assertEqual(t, config.Sources()["SUMO_MAX_CONCURRENT_REQUESTS"], SourceConfigJSON, "setting should be sourced from the blob")
+
+	// the experiment groups are resolved as any other setting
+	setLayer(SourceConfigFile, map[string]string{"SUMO_EXPERIMENT_GROUPS": "small:SUMO_MAX_CONCURRENT_REQUESTS=1"})
+	config, err = New()
+	assertEqual(t, err, nil, "config should be valid")
+	assertEqual(t, config.ExperimentGroups, "small:SUMO_MAX_CONCURRENT_REQUESTS=1", "experiment groups should be read from the file")
+
+	config, err = New(WithEnv(map[string]string{"SUMO_NUM_RETRIES": "1"}))
+	assertEqual(t, err, nil, "config should be valid")
+	assertEqual(t, config.NumRetry, 1, "options should override every source")
+	assertEqual(t, config.Sources()["SUMO_NUM_RETRIES"], SourceOption, "setting should be sourced from the options")
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// debugCaptureUntil is the end of the debug capture in unix nanoseconds, 0 when none was started
+var debugCaptureUntil int64
+
+// StartDebugCapture starts a debug capture of duration
+func StartDebugCapture(duration time.Duration) {
+	atomic.StoreInt64(&debugCaptureUntil, time.Now().Add(duration).UnixNano())
+}
+
+// UpdateDebugCapture starts a debug capture when the function wrote the DebugCaptureFile. The capture lasts
+// DebugCaptureDuration from the last modification of the file, so touching it again extends the capture.
+func (cfg *LambdaExtensionConfig) UpdateDebugCapture() bool {
+	if cfg.DebugCaptureFile != "" {
+		if info, err := os.Stat(cfg.DebugCaptureFile); err == nil {
+			until := info.ModTime().Add(cfg.DebugCaptureDuration).UnixNano()
+			if until > atomic.LoadInt64(&debugCaptureUntil) {
+				atomic.StoreInt64(&debugCaptureUntil, until)
+			}
+		}
+	}
+	return cfg.DebugCaptureActive()
+}
+
+// DebugCaptureActive returns true while a debug capture is running, records are then shipped unfiltered
+func (cfg *LambdaExtensionConfig) DebugCaptureActive() bool {
+	return time.Now().UnixNano() < atomic.LoadInt64(&debugCaptureUntil)
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// configEnv returns the env vars the config is read from
+func configEnv() map[string]string {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if isConfigEnv(parts[0]) || strings.HasPrefix(parts[0], "AWS_LAMBDA_") {
+			env[parts[0]] = parts[1]
+		}
+	}
+	return env
+}
+
+// DetectDrift returns the names of the config env vars changed, added or removed since the config was
+// loaded or the last call, sorted. Values are not returned as they can be secrets.
+func (cfg *LambdaExtensionConfig) DetectDrift() []string {
+	current := configEnv()
+	var changed []string
+	for key, value := range current {
+		if previous, found := cfg.loadedEnv[key]; !found || previous != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range cfg.loadedEnv {
+		if _, found := current[key]; !found {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	cfg.loadedEnv = current
+	return changed
+}
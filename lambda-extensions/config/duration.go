@@ -0,0 +1,15 @@
+package config
+
+import (
+	"strconv"
+	"time"
+)
+
+// parseDuration reads a time-valued setting, either an integer in the unit of its env var, e.g.
+// SUMO_DIAL_TIMEOUT_MS=2000, or a Go duration string such as 250ms, 5s or 1m30s
+func parseDuration(value string, unit time.Duration) (time.Duration, error) {
+	if number, err := strconv.ParseInt(value, 10, 32); err == nil {
+		return time.Duration(number) * unit, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// EndpointCandidate is an endpoint of SUMO_HTTP_ENDPOINTS. Weight and Priority are 0 when not set.
+type EndpointCandidate struct {
+	URL      string
+	Weight   int
+	Priority int
+}
+
+// WeightedEndpoints tells whether the batches are spread across the endpoints by weight, with the endpoints
+// of the next priority taking over when none of the lowest one is healthy. Otherwise the fastest healthy
+// endpoint is posted to.
+func (cfg *LambdaExtensionConfig) WeightedEndpoints() bool {
+	for _, candidate := range cfg.EndpointCandidates {
+		if candidate.Weight != 0 || candidate.Priority != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEndpointCandidates reads the endpoints of SUMO_HTTP_ENDPOINTS separated by commas, each optionally
+// followed by its weight and priority, e.g. "https://a/receiver;weight=3,https://b/receiver;priority=1".
+// The endpoints are equivalent, e.g. the same source in several deployments or two collectors during a
+// migration.
+func parseEndpointCandidates(value string) ([]EndpointCandidate, error) {
+	var candidates []EndpointCandidate
+	var allErrors []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ";")
+		candidate := EndpointCandidate{URL: strings.TrimSpace(parts[0])}
+		if _, err := url.ParseRequestURI(candidate.URL); err != nil {
+			allErrors = append(allErrors, "an endpoint is not Valid")
+			continue
+		}
+		valid := true
+		for _, setting := range parts[1:] {
+			kv := strings.SplitN(strings.TrimSpace(setting), "=", 2)
+			number := -1
+			if len(kv) == 2 {
+				if n, err := strconv.Atoi(strings.TrimSpace(kv[1])); err == nil {
+					number = n
+				}
+			}
+			switch {
+			case kv[0] == "weight" && number > 0:
+				candidate.Weight = number
+			case kv[0] == "priority" && number >= 0:
+				candidate.Priority = number
+			default:
+				// the endpoints embed their token, only the setting is reported
+				allErrors = append(allErrors, fmt.Sprintf("setting %q is not a positive weight=N or a priority=N", strings.TrimSpace(setting)))
+				valid = false
+			}
+		}
+		if valid {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(allErrors) > 0 {
+		return candidates, errors.New(strings.Join(allErrors, ", "))
+	}
+	return candidates, nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"strings"
+)
+
+// experimentGroup is a named config variant of SUMO_EXPERIMENT_GROUPS
+type experimentGroup struct {
+	name     string
+	settings url.Values
+}
+
+// ApplyExperimentGroup selects one of the groups of SUMO_EXPERIMENT_GROUPS from a hash of the execution
+// environment id and sets its variables, so that an environment stays in the same group for its lifetime.
+// Groups are separated by ; and are written name:KEY=VALUE&KEY=VALUE, values being query escaped, e.g.
+// SUMO_EXPERIMENT_GROUPS='small:SUMO_MAX_CONCURRENT_REQUESTS=3;large:SUMO_MAX_CONCURRENT_REQUESTS=10'.
+// It returns the name of the selected group, which is then reloaded by GetConfig.
+func ApplyExperimentGroup(experimentGroups, environmentID string) (string, error) {
+	groups, err := parseExperimentGroups(experimentGroups)
+	if err != nil {
+		return "", fmt.Errorf("Unable to parse SUMO_EXPERIMENT_GROUPS: %v", err)
+	}
+	if len(groups) == 0 {
+		return "", nil
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(environmentID))
+	group := groups[hash.Sum32()%uint32(len(groups))]
+	values := make(map[string]string, len(group.settings))
+	for key, settings := range group.settings {
+		values[key] = settings[len(settings)-1]
+	}
+	setLayer(SourceExperiment, values)
+	return group.name, nil
+}
+
+func parseExperimentGroups(value string) ([]experimentGroup, error) {
+	var groups []experimentGroup
+	var allErrors []string
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			allErrors = append(allErrors, fmt.Sprintf("group %q is not in name:KEY=VALUE&KEY=VALUE format", entry))
+			continue
+		}
+		settings, err := url.ParseQuery(strings.TrimSpace(parts[1]))
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("group %s: %v", name, err))
+			continue
+		}
+		for key := range settings {
+			// variants only tune the extension, they can not select another experiment
+			if !strings.HasPrefix(key, "SUMO_") || key == "SUMO_EXPERIMENT_GROUPS" {
+				allErrors = append(allErrors, fmt.Sprintf("group %s can not set %s", name, key))
+			}
+		}
+		groups = append(groups, experimentGroup{name: name, settings: settings})
+	}
+	if len(allErrors) > 0 {
+		return nil, errors.New(strings.Join(allErrors, ", "))
+	}
+	return groups, nil
+}
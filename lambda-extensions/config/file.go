@@ -0,0 +1,292 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultConfigFile is where the layer ships its config file, next to the extensions directory as Lambda
+// runs every file of /opt/extensions as an extension
+const defaultConfigFile = "/opt/sumo-extension.yaml"
+
+// applyConfigFile sets the layer of the config env vars of the config file, so that the env vars of the
+// function override the values shipped in the layer. The file is the one of SUMO_CONFIG_FILE, or the default
+// one when it exists. An empty SUMO_CONFIG_FILE ignores the default one. SUMO_CONFIG_FILE and SUMO_PROFILE
+// are read from the env and then from the values of the config blob.
+func applyConfigFile(blob map[string]string) error {
+	lookupEnv := func(key string) (string, bool) {
+		if value, found := os.LookupEnv(key); found {
+			return value, true
+		}
+		value, found := blob[key]
+		return value, found
+	}
+	path, required := lookupEnv("SUMO_CONFIG_FILE")
+	if !required {
+		path = defaultConfigFile
+	} else if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !required && os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("Unable to read SUMO_CONFIG_FILE: %v", err)
+	}
+	file, err := parseConfigFile(string(data))
+	if err != nil {
+		return fmt.Errorf("Unable to parse %s: %v", path, err)
+	}
+	profile, _ := lookupEnv("SUMO_PROFILE")
+	values, err := file.values(profile)
+	if err != nil {
+		return fmt.Errorf("Unable to read %s: %v", path, err)
+	}
+	setLayer(SourceConfigFile, values)
+	return nil
+}
+
+// profilesKey is the key of the config file mapping the profiles to their config env vars
+const profilesKey = "profiles"
+
+// configFile is the content of the config file, see parseConfigFile
+type configFile struct {
+	// Settings are the config env vars of the file, the lists are joined with commas as in the env vars
+	Settings map[string]string
+	// Profiles are the config env vars of every profile, which override Settings once selected
+	Profiles map[string]map[string]string
+}
+
+// values returns the settings of the file overridden by the ones of profile, the SUMO_PROFILE of the file
+// applies when profile is empty. A profile which is not in the file is an error unless the file has none.
+func (f *configFile) values(profile string) (map[string]string, error) {
+	values := make(map[string]string, len(f.Settings))
+	for key, value := range f.Settings {
+		values[key] = value
+	}
+	if profile == "" {
+		profile = f.Settings["SUMO_PROFILE"]
+	}
+	if profile == "" || len(f.Profiles) == 0 {
+		return values, nil
+	}
+	selected, found := f.Profiles[profile]
+	if !found {
+		var names []string
+		for name := range f.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("profile %s is not one of %s", profile, strings.Join(names, ", "))
+	}
+	for key, value := range selected {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// parseConfigFile reads the config file, a YAML mapping of the config env vars to scalars or to lists of
+// scalars. The config env vars of the profile selected by SUMO_PROFILE override the other ones, so that one
+// file serves several environments:
+//
+//	SUMO_HTTP_ENDPOINT: ssm:///sumo/endpoint
+//	SUMO_LOG_TYPES:
+//	  - platform
+//	  - function
+//	profiles:
+//	  dev:
+//	    SUMO_LOG_LEVEL: debug
+//	  prod:
+//	    SOURCE_CATEGORY_OVERRIDE: aws/lambda/prod
+//
+// Only this subset of YAML is supported, the rest of the syntax, such as flow collections, block scalars,
+// anchors or several documents, is reported along with its line rather than read differently than YAML does.
+// Values holding JSON, as SUMO_LOG_TYPE_CONFIG does, have to be quoted.
+func parseConfigFile(data string) (*configFile, error) {
+	file := &configFile{Settings: map[string]string{}, Profiles: map[string]map[string]string{}}
+	var allErrors []string
+	fail := func(line int, format string, args ...interface{}) {
+		allErrors = append(allErrors, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+	}
+	// listKey is the setting whose list items are being read, in listTarget
+	var listKey string
+	var list []string
+	var listTarget map[string]string
+	var listIndent int
+	endList := func() {
+		if listKey != "" {
+			listTarget[listKey] = strings.Join(list, ",")
+		}
+		listKey, list = "", nil
+	}
+	// set within the profiles mapping, profile holds the config env vars of the profile being read, the
+	// indentations are -1 until the first profile and its first setting are read
+	var inProfiles bool
+	var profile map[string]string
+	profileIndent, settingIndent := -1, -1
+	started := false
+	for i, line := range strings.Split(data, "\n") {
+		n := i + 1
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed == "---" || trimmed == "..." {
+			if started {
+				fail(n, "several documents are not supported")
+			}
+			continue
+		}
+		started = true
+		indentation := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if strings.Contains(indentation, "\t") {
+			fail(n, "tabs can not indent")
+			continue
+		}
+		indent := len(indentation)
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			if listKey == "" || indent < listIndent {
+				fail(n, "list item without a key")
+				continue
+			}
+			value, present, err := parseScalar(strings.TrimSpace(trimmed[1:]))
+			if err != nil {
+				fail(n, "%v", err)
+			} else if present {
+				list = append(list, value)
+			}
+			continue
+		}
+		endList()
+		colon := strings.Index(trimmed, ":")
+		if colon <= 0 || (colon+1 < len(trimmed) && trimmed[colon+1] != ' ') {
+			fail(n, "expected key: value")
+			continue
+		}
+		key := trimmed[:colon]
+		rest := strings.TrimSpace(trimmed[colon+1:])
+		var target map[string]string
+		switch {
+		case indent == 0:
+			inProfiles, profile = false, nil
+			if key == profilesKey {
+				if _, present, _ := parseScalar(rest); present {
+					fail(n, "%s has to map the profiles to their config env vars", profilesKey)
+				}
+				inProfiles, profileIndent = true, -1
+				continue
+			}
+			target = file.Settings
+		case !inProfiles:
+			fail(n, "%s is nested in a setting, only %s maps names to config env vars", key, profilesKey)
+			continue
+		case profileIndent == -1 || indent == profileIndent:
+			profileIndent, settingIndent = indent, -1
+			if _, present, _ := parseScalar(rest); present {
+				fail(n, "profile %s has to map to its config env vars", key)
+				profile = nil
+				continue
+			}
+			if _, found := file.Profiles[key]; found {
+				fail(n, "profile %s is defined twice", key)
+			}
+			profile = map[string]string{}
+			file.Profiles[key] = profile
+			continue
+		case indent < profileIndent || profile == nil || (settingIndent != -1 && indent != settingIndent):
+			fail(n, "%s is not indented as the settings of its profile", key)
+			continue
+		default:
+			settingIndent = indent
+			target = profile
+		}
+		if !isConfigEnv(key) {
+			fail(n, "%s is not a config env var", key)
+			continue
+		}
+		if _, found := target[key]; found {
+			fail(n, "%s is set twice", key)
+		}
+		value, present, err := parseScalar(rest)
+		switch {
+		case err != nil:
+			fail(n, "%s: %v", key, err)
+		case present:
+			target[key] = value
+		default:
+			listKey, listTarget, listIndent = key, target, indent
+		}
+	}
+	endList()
+	if len(allErrors) > 0 {
+		return nil, errors.New(strings.Join(allErrors, ", "))
+	}
+	return file, nil
+}
+
+// parseScalar returns the value of a plain, single quoted or double quoted scalar without its comment, and
+// false when there is no value. The other kinds of values are reported as unsupported.
+func parseScalar(text string) (string, bool, error) {
+	if text == "" || text[0] == '#' {
+		return "", false, nil
+	}
+	switch text[0] {
+	case '"', '\'':
+		end := closingQuote(text)
+		if end == -1 {
+			return "", false, errors.New("quoted value is not terminated")
+		}
+		if trailing := strings.TrimSpace(text[end+1:]); trailing != "" && trailing[0] != '#' {
+			return "", false, errors.New("quoted value is followed by more text")
+		}
+		if text[0] == '\'' {
+			return strings.Replace(text[1:end], "''", "'", -1), true, nil
+		}
+		value, err := strconv.Unquote(text[:end+1])
+		if err != nil {
+			return "", false, fmt.Errorf("double quoted value is invalid: %v", err)
+		}
+		return value, true, nil
+	case '[', '{':
+		return "", false, errors.New("flow sequences and mappings are not supported, write lists as - items and quote JSON values")
+	case '|', '>':
+		return "", false, errors.New("block scalars are not supported, quote the value")
+	case '&', '*', '!':
+		return "", false, errors.New("anchors, aliases and tags are not supported")
+	case '-':
+		if text == "-" || strings.HasPrefix(text, "- ") {
+			return "", false, errors.New("nested lists are not supported")
+		}
+	}
+	if comment := strings.Index(text, " #"); comment != -1 {
+		text = strings.TrimSpace(text[:comment])
+	}
+	if strings.Contains(text, ": ") || strings.HasSuffix(text, ":") {
+		return "", false, errors.New("value is a mapping, quote it")
+	}
+	return text, true, nil
+}
+
+// closingQuote returns the index of the quote closing the value text starts with, -1 when there is none.
+// Single quotes are escaped by doubling them and double quotes by a backslash.
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
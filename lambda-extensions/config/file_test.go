@@ -0,0 +1,79 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	file, err := parseConfigFile(`---
+# shared by the functions of the layer
+SUMO_HTTP_ENDPOINT: ssm:///sumo/endpoint # resolved at init
+SUMO_LOG_TYPES:
+  - platform
+  - 'function'
+SUMO_LOG_TYPE_CONFIG: '{"platform": {"category": "aws/lambda/platform"}}'
+SOURCE_CATEGORY_OVERRIDE: "aws/lambda/#team"
+SUMO_FIELDS:
+profiles:
+  dev:
+    SUMO_LOG_LEVEL: debug
+    SUMO_LOG_TYPES:
+    - function
+  prod:
+    SOURCE_CATEGORY_OVERRIDE: aws/lambda/prod
+`)
+	assertEqual(t, err, nil, "config file should be parsed")
+	assertEqual(t, file.Settings["SUMO_HTTP_ENDPOINT"], "ssm:///sumo/endpoint", "comment should be removed from the value")
+	assertEqual(t, file.Settings["SUMO_LOG_TYPES"], "platform,function", "list should be joined with commas")
+	assertEqual(t, file.Settings["SUMO_LOG_TYPE_CONFIG"], `{"platform": {"category": "aws/lambda/platform"}}`, "quoted JSON should be kept")
+	assertEqual(t, file.Settings["SOURCE_CATEGORY_OVERRIDE"], "aws/lambda/#team", "quoted value should keep its #")
+	value, found := file.Settings["SUMO_FIELDS"]
+	assertEqual(t, found && value == "", true, "key without value should be set empty")
+	assertEqual(t, len(file.Profiles), 2, "profiles should be read")
+
+	values, err := file.values("dev")
+	assertEqual(t, err, nil, "profile should be selected")
+	assertEqual(t, values["SUMO_LOG_LEVEL"], "debug", "profile should add its settings")
+	assertEqual(t, values["SUMO_LOG_TYPES"], "function", "profile should override the settings")
+	assertEqual(t, file.Settings["SUMO_LOG_TYPES"], "platform,function", "settings should not be changed by a profile")
+	values, err = file.values("")
+	assertEqual(t, err, nil, "no profile should be selected")
+	assertEqual(t, values["SOURCE_CATEGORY_OVERRIDE"], "aws/lambda/#team", "settings should apply without profile")
+	_, err = file.values("staging")
+	assertEqual(t, err != nil && strings.Contains(err.Error(), "dev, prod"), true, "unknown profile should list the profiles")
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		error string
+	}{
+		{"flow sequence", "SUMO_LOG_TYPES: [platform, function]", "line 1: SUMO_LOG_TYPES: flow sequences and mappings are not supported"},
+		{"flow mapping", `SUMO_LOG_TYPE_CONFIG: {"platform": {}}`, "line 1: SUMO_LOG_TYPE_CONFIG: flow sequences and mappings are not supported"},
+		{"block scalar", "SUMO_FIELDS: |\n  team=payments", "line 1: SUMO_FIELDS: block scalars are not supported"},
+		{"anchor", "SUMO_LOG_LEVEL: &level debug", "line 1: SUMO_LOG_LEVEL: anchors, aliases and tags are not supported"},
+		{"several documents", "SUMO_LOG_LEVEL: debug\n---\nSUMO_LOG_LEVEL: info", "line 2: several documents are not supported"},
+		{"tab", "profiles:\n\tdev:", "line 2: tabs can not indent"},
+		{"nested setting", "SUMO_LOG_LEVEL:\n  level: debug", "line 2: level is nested in a setting"},
+		{"unknown key", "LOG_LEVEL: debug", "line 1: LOG_LEVEL is not a config env var"},
+		{"duplicate key", "SUMO_LOG_LEVEL: debug\nSUMO_LOG_LEVEL: info", "line 2: SUMO_LOG_LEVEL is set twice"},
+		{"list without key", "- platform", "line 1: list item without a key"},
+		{"nested list", "SUMO_LOG_TYPES:\n  - - platform", "line 2: nested lists are not supported"},
+		{"mapping in list", "SUMO_LOG_TYPES:\n  - type: platform", "line 2: value is a mapping"},
+		{"not terminated", `SUMO_LOG_LEVEL: "debug`, "line 1: SUMO_LOG_LEVEL: quoted value is not terminated"},
+		{"text after quote", `SUMO_LOG_LEVEL: "debug" info`, "line 1: SUMO_LOG_LEVEL: quoted value is followed by more text"},
+		{"no colon", "SUMO_LOG_LEVEL debug", "line 1: expected key: value"},
+		{"profile value", "profiles:\n  dev: debug", "line 2: profile dev has to map to its config env vars"},
+		{"profile indentation", "profiles:\n  dev:\n    SUMO_LOG_LEVEL: debug\n      SUMO_FIELDS: team=payments", "line 4: SUMO_FIELDS is not indented as the settings of its profile"},
+	}
+	for _, test := range tests {
+		_, err := parseConfigFile(test.data)
+		if err == nil {
+			t.Errorf("%s: config file should not be parsed", test.name)
+			continue
+		}
+		assertEqual(t, strings.HasPrefix(err.Error(), test.error), true, test.name+": "+err.Error())
+	}
+}
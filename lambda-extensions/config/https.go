@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+)
+
+// sumoSourcePathPattern matches the path of the URL of a Sumo Logic HTTP source, /receiver/v1/http/<token>
+var sumoSourcePathPattern = regexp.MustCompile(`^/receiver/v1/http/[A-Za-z0-9=_-]+/?$`)
+
+// configuredEndpoint is an endpoint the logs are posted to and the env var setting it, the URL carrying the
+// source token is never part of the errors and warnings
+type configuredEndpoint struct {
+	env string
+	url string
+}
+
+// configuredEndpoints returns the endpoints of SUMO_HTTP_ENDPOINT, or of its secret, file or ciphertext, of
+// SUMO_ALIAS_ENDPOINT_MAP, SUMO_HTTP_ENDPOINTS and SUMO_LOG_TYPE_CONFIG
+func (cfg *LambdaExtensionConfig) configuredEndpoints() []configuredEndpoint {
+	var endpoints []configuredEndpoint
+	if cfg.SumoHTTPEndpoint != "" {
+		endpoints = append(endpoints, configuredEndpoint{env: "SUMO_HTTP_ENDPOINT", url: cfg.SumoHTTPEndpoint})
+	}
+	aliases := make([]string, 0, len(cfg.AliasEndpoints))
+	for alias := range cfg.AliasEndpoints {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		endpoints = append(endpoints, configuredEndpoint{env: "SUMO_ALIAS_ENDPOINT_MAP " + alias, url: cfg.AliasEndpoints[alias]})
+	}
+	for _, candidate := range cfg.EndpointCandidates {
+		endpoints = append(endpoints, configuredEndpoint{env: "SUMO_HTTP_ENDPOINTS", url: candidate.URL})
+	}
+	logTypes := make([]string, 0, len(cfg.LogTypeConfig))
+	for logType, settings := range cfg.LogTypeConfig {
+		if settings.Endpoint != "" {
+			logTypes = append(logTypes, logType)
+		}
+	}
+	sort.Strings(logTypes)
+	for _, logType := range logTypes {
+		endpoints = append(endpoints, configuredEndpoint{env: "SUMO_LOG_TYPE_CONFIG " + logType, url: cfg.LogTypeConfig[logType].Endpoint})
+	}
+	return endpoints
+}
+
+// insecureEndpointErrors returns an error for every endpoint which is not https, the source token of a
+// plain http endpoint being readable on the network. SUMO_ALLOW_INSECURE allows them, e.g. for a local
+// receiver in tests. The endpoints which are not valid URLs are reported by their own validation.
+func (cfg *LambdaExtensionConfig) insecureEndpointErrors() []string {
+	if cfg.AllowInsecure {
+		return nil
+	}
+	var allErrors []string
+	for _, endpoint := range cfg.configuredEndpoints() {
+		parsed, err := url.ParseRequestURI(endpoint.url)
+		if err != nil || parsed.Scheme == "https" {
+			continue
+		}
+		allErrors = append(allErrors, fmt.Sprintf("%s is not https and SUMO_ALLOW_INSECURE is not true", endpoint.env))
+	}
+	return allErrors
+}
+
+// EndpointWarnings returns a warning for every endpoint whose path is not the one of a Sumo Logic HTTP
+// source, most often the URL of the collector or of another source type pasted instead of the source URL.
+// The logs are still posted to them since a proxy in front of Sumo Logic can have paths of its own.
+func (cfg *LambdaExtensionConfig) EndpointWarnings() []string {
+	var warnings []string
+	for _, endpoint := range cfg.configuredEndpoints() {
+		parsed, err := url.ParseRequestURI(endpoint.url)
+		if err != nil || sumoSourcePathPattern.MatchString(parsed.Path) {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("%s does not look like a Sumo Logic HTTP source URL /receiver/v1/http/<token>", endpoint.env))
+	}
+	return warnings
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/fields"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// LogTypeSettings are the settings of SUMO_LOG_TYPE_CONFIG overriding the global ones for the records of a
+// log type, the empty values are left to the global settings
+type LogTypeSettings struct {
+	Metadata fields.Metadata
+	Endpoint string
+}
+
+// TypeSettings returns the settings of the records of a log type, e.g. platform.report has the settings
+// of platform. The second value tells whether the log type has settings of its own.
+func (cfg *LambdaExtensionConfig) TypeSettings(logType string) (LogTypeSettings, bool) {
+	settings, found := cfg.LogTypeConfig[strings.SplitN(logType, ".", 2)[0]]
+	return settings, found
+}
+
+// parseLogTypeConfig reads the blocks of SUMO_LOG_TYPE_CONFIG separated by ; and written
+// logType:category=VALUE&host=VALUE&name=VALUE&endpoint=VALUE&maxPayloadKB=VALUE, values being query
+// escaped, e.g. SUMO_LOG_TYPE_CONFIG='platform:category=aws/lambda/platform&maxPayloadKB=128'. The payload
+// sizes are returned apart as they are merged with SUMO_MAX_PAYLOAD_KB_BY_TYPE.
+func parseLogTypeConfig(value string) (map[string]LogTypeSettings, map[string]int, error) {
+	blocks := map[string]LogTypeSettings{}
+	sizes := map[string]int{}
+	var allErrors []string
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		logType := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || logType == "" {
+			allErrors = append(allErrors, fmt.Sprintf("entry %q is not in logType:key=VALUE&key=VALUE format", entry))
+			continue
+		}
+		if !utils.StringInSlice(logType, validLogTypes) {
+			allErrors = append(allErrors, fmt.Sprintf("logType %s is unsupported", logType))
+			continue
+		}
+		values, err := url.ParseQuery(strings.TrimSpace(parts[1]))
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("logType %s: %v", logType, err))
+			continue
+		}
+		var settings LogTypeSettings
+		for key := range values {
+			switch key {
+			case "category":
+				settings.Metadata.Category = values.Get(key)
+			case "host":
+				settings.Metadata.Host = values.Get(key)
+			case "name":
+				settings.Metadata.Name = values.Get(key)
+			case "endpoint":
+				settings.Endpoint = values.Get(key)
+				if _, err := url.ParseRequestURI(settings.Endpoint); err != nil {
+					allErrors = append(allErrors, fmt.Sprintf("endpoint of logType %s is not Valid", logType))
+				}
+			case "maxPayloadKB":
+				sizeKB, err := strconv.ParseInt(values.Get(key), 10, 32)
+				if err != nil || sizeKB <= 0 {
+					allErrors = append(allErrors, fmt.Sprintf("size of logType %s has to be a positive number of KB", logType))
+					continue
+				}
+				sizes[logType] = int(sizeKB) * 1024
+			default:
+				allErrors = append(allErrors, fmt.Sprintf("logType %s can not set %s", logType, key))
+			}
+		}
+		if err := settings.Metadata.Validate(); err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("logType %s: %v", logType, err))
+			continue
+		}
+		if settings != (LogTypeSettings{}) {
+			blocks[logType] = settings
+		}
+	}
+	if len(allErrors) > 0 {
+		return blocks, sizes, errors.New(strings.Join(allErrors, ", "))
+	}
+	return blocks, sizes, nil
+}
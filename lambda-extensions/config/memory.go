@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// memoryTier is the buffering footprint of the functions of up to maxMemoryMB, the queued payloads and the
+// chunks being compressed by every concurrent request being held in the memory of the function
+type memoryTier struct {
+	maxMemoryMB           int
+	maxDataQueueLength    int
+	maxConcurrentRequests int
+	maxDataPayloadSize    int
+}
+
+// memoryTiers are sorted by memory, the last one applies above and when the memory size is unknown
+var memoryTiers = []memoryTier{
+	{maxMemoryMB: 256, maxDataQueueLength: 5, maxConcurrentRequests: 1, maxDataPayloadSize: 256 * 1024},
+	{maxMemoryMB: 512, maxDataQueueLength: 10, maxConcurrentRequests: 2, maxDataPayloadSize: 512 * 1024},
+	{maxMemoryMB: 2048, maxDataQueueLength: 20, maxConcurrentRequests: 3, maxDataPayloadSize: 1024 * 1024},
+	{maxMemoryMB: 4096, maxDataQueueLength: 40, maxConcurrentRequests: 5, maxDataPayloadSize: 1024 * 1024},
+	{maxDataQueueLength: 80, maxConcurrentRequests: 8, maxDataPayloadSize: 1024 * 1024},
+}
+
+// defaultMemoryTier returns the tier of AWS_LAMBDA_FUNCTION_MEMORY_SIZE, the payloads do not grow above the
+// 1 MB recommended by Sumo. An unknown or invalid memory size gets the defaults of a 1 GB function.
+func defaultMemoryTier(env *envSource) memoryTier {
+	memoryMB, err := strconv.Atoi(env.Getenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE"))
+	if err != nil || memoryMB <= 0 {
+		memoryMB = 1024
+	}
+	tier := memoryTiers[len(memoryTiers)-1]
+	for _, t := range memoryTiers {
+		if memoryMB <= t.maxMemoryMB {
+			tier = t
+			break
+		}
+	}
+	return tier
+}
+
+// logsAPIBatchBytes is the maxBytes of the Logs API subscription, the most a payload of the data queue holds
+const logsAPIBatchBytes = 256 * 1024
+
+// BufferedBytes returns the most bytes held by the data queue, the in-flight requests, each holding a chunk
+// of the largest payload size, the overflow buffer and the payloads coalesced across invocations
+func (cfg *LambdaExtensionConfig) BufferedBytes() int {
+	queueBytes := cfg.RingBufferSize
+	if queueBytes == 0 {
+		queueBytes = cfg.MaxDataQueueLength * logsAPIBatchBytes
+	}
+	concurrency := cfg.MaxConcurrentRequests
+	if cfg.EnableAutotune && cfg.AutotuneMaxConcurrency > concurrency {
+		concurrency = cfg.AutotuneMaxConcurrency
+	}
+	coalescedBytes := 0
+	if cfg.CoalesceMaxAge > 0 {
+		coalescedBytes = cfg.CoalesceMaxBytes
+	}
+	return queueBytes + concurrency*cfg.largestPayloadSize() + cfg.OverflowBufferSize + coalescedBytes
+}
+
+func (cfg *LambdaExtensionConfig) largestPayloadSize() int {
+	largest := cfg.MaxDataPayloadSize
+	for _, size := range cfg.PayloadSizeByType {
+		if size > largest {
+			largest = size
+		}
+	}
+	return largest
+}
+
+// applyMemoryBudget derives the buffers left unset from SUMO_MAX_MEMORY_MB: the in-flight requests and the
+// overflow buffer are capped to a quarter of it each and the data queue gets the rest. The buffers set
+// explicitly are kept, it is an error when they do not fit in the budget.
+func (cfg *LambdaExtensionConfig) applyMemoryBudget(env *envSource) error {
+	if cfg.MaxMemory == 0 {
+		return nil
+	}
+	quarter := cfg.MaxMemory / 4
+	maxConcurrency := quarter / cfg.largestPayloadSize()
+	if maxConcurrency < 1 {
+		maxConcurrency = 1
+	}
+	if env.Getenv("SUMO_MAX_CONCURRENT_REQUESTS") == "" && cfg.MaxConcurrentRequests > maxConcurrency {
+		cfg.MaxConcurrentRequests = maxConcurrency
+	}
+	if env.Getenv("SUMO_AUTOTUNE_MAX_CONCURRENT_REQUESTS") == "" && cfg.AutotuneMaxConcurrency > maxConcurrency {
+		cfg.AutotuneMaxConcurrency = maxConcurrency
+	}
+	if env.Getenv("SUMO_OVERFLOW_BUFFER_MB") == "" && cfg.OverflowBufferSize > quarter {
+		cfg.OverflowBufferSize = quarter
+	}
+	if env.Getenv("SUMO_MAX_DATAQUEUE_LENGTH") == "" && cfg.RingBufferSize == 0 {
+		// the bytes left once the queue is emptied
+		cfg.MaxDataQueueLength = 0
+		cfg.MaxDataQueueLength = (cfg.MaxMemory - cfg.BufferedBytes()) / logsAPIBatchBytes
+		if cfg.MaxDataQueueLength < 1 {
+			cfg.MaxDataQueueLength = 1
+		}
+	}
+	if buffered := cfg.BufferedBytes(); buffered > cfg.MaxMemory {
+		return fmt.Errorf("SUMO_MAX_MEMORY_MB of %d MB is less than the %.1f MB buffered by the data queue, the in-flight requests, the overflow buffer and the coalesced payloads", cfg.MaxMemory/(1024*1024), float64(buffered)/(1024*1024))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import "strings"
+
+// Option sets config env vars of the config built by New
+type Option func(*envSource)
+
+// envSource is where New reads the config env vars from, the values of the options take precedence over
+// the other sources, see setting
+type envSource struct {
+	values     map[string]string
+	processEnv bool
+	// settings are the config env vars resolved from values and the layers of the process
+	settings map[string]setting
+}
+
+// Getenv returns the value of an env var, empty when not set
+func (e *envSource) Getenv(key string) string {
+	value, _ := e.LookupEnv(key)
+	return value
+}
+
+// LookupEnv returns the value of an env var and whether it is set
+func (e *envSource) LookupEnv(key string) (string, bool) {
+	value, _, found := e.Resolve(key)
+	return value, found
+}
+
+// WithEnv sets config env vars, e.g. WithEnv(map[string]string{"SUMO_LOG_LEVEL": "debug"}), in the format
+// of the SUMO_ env vars and validated as them
+func WithEnv(values map[string]string) Option {
+	return func(e *envSource) {
+		for key, value := range values {
+			e.values[key] = value
+		}
+	}
+}
+
+// WithoutProcessEnv ignores the env vars of the process, only the values of the options and the defaults are
+// used. The config blob, the config file and the other sources of the process are not read and no parameter
+// nor secret reference is resolved.
+func WithoutProcessEnv() Option {
+	return func(e *envSource) {
+		e.processEnv = false
+	}
+}
+
+// WithEndpoint sets the collector endpoint of SUMO_HTTP_ENDPOINT
+func WithEndpoint(endpoint string) Option {
+	return WithEnv(map[string]string{"SUMO_HTTP_ENDPOINT": endpoint})
+}
+
+// WithLogTypes sets the log types of SUMO_LOG_TYPES, no log type subscribes to none
+func WithLogTypes(logTypes ...string) Option {
+	return WithEnv(map[string]string{"SUMO_LOG_TYPES": strings.Join(logTypes, ",")})
+}
+
+// WithLogLevel sets the level of SUMO_LOG_LEVEL, e.g. debug
+func WithLogLevel(level string) Option {
+	return WithEnv(map[string]string{"SUMO_LOG_LEVEL": level})
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// Accountings of SUMO_PAYLOAD_SIZE_ACCOUNTING, records counts the lines of the records only toward the payload
+// size and request counts the headers carrying the source metadata and fields as well
+const (
+	PayloadAccountingRecords = "records"
+	PayloadAccountingRequest = "request"
+)
+
+var validPayloadAccountings = []string{PayloadAccountingRecords, PayloadAccountingRequest}
+
+// PayloadSize returns the payload size limit of the records of a log type, e.g. platform.report is limited
+// by the size of platform and falls back to MaxDataPayloadSize
+func (cfg *LambdaExtensionConfig) PayloadSize(logType string) int {
+	if size, found := cfg.PayloadSizeByType[strings.SplitN(logType, ".", 2)[0]]; found {
+		return size
+	}
+	return cfg.MaxDataPayloadSize
+}
+
+// parsePayloadSizeByType reads SUMO_MAX_PAYLOAD_KB_BY_TYPE in the "function=1024,platform=128" format
+func parsePayloadSizeByType(value string) (map[string]int, error) {
+	sizes := map[string]int{}
+	var allErrors []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			allErrors = append(allErrors, fmt.Sprintf("entry %q is not in logType=KB format", entry))
+			continue
+		}
+		logType := strings.TrimSpace(kv[0])
+		if !utils.StringInSlice(logType, validLogTypes) {
+			allErrors = append(allErrors, fmt.Sprintf("logType %s is unsupported", logType))
+			continue
+		}
+		sizeKB, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 32)
+		if err != nil || sizeKB <= 0 {
+			allErrors = append(allErrors, fmt.Sprintf("size of logType %s has to be a positive number of KB", logType))
+			continue
+		}
+		sizes[logType] = int(sizeKB) * 1024
+	}
+	if len(allErrors) > 0 {
+		return sizes, errors.New(strings.Join(allErrors, ", "))
+	}
+	return sizes, nil
+}
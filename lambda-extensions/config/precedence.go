@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The sources setting the config env vars, from the lowest to the highest precedence, the value of a source
+// overrides the ones of the sources before it and the defaults apply when none sets an env var:
+//
+//	defaults < config file < SUMO_CONFIG_JSON < AppConfig < SSM/Secrets < startup file < function env < experiment group < options
+//
+// The config file, SUMO_CONFIG_JSON and AppConfig are shared by many functions, the parameter and secret
+// references, ssm://name or secretsmanager://id, they set are resolved into the SSM/Secrets layer, which
+// overrides their plain values. The references set by the sources of the function itself are resolved in
+// place and keep the precedence of their source. The resolved env vars are reported as sourced from SSM or
+// Secrets Manager.
+var (
+	// sharedSources are the sources below the SSM/Secrets layer, from the highest precedence
+	sharedSources = []string{SourceAppConfig, SourceConfigJSON, SourceConfigFile}
+	// functionSources are the sources above the SSM/Secrets layer, from the highest precedence
+	functionSources = []string{SourceOption, SourceExperiment, SourceEnv, SourceStartupFile}
+)
+
+// setting is the value of a config env var along with the source it comes from
+type setting struct {
+	value  string
+	source string
+}
+
+// configLayers are the config env vars set by the sources the extension reads itself, by source. The function
+// env and the options are read when the layers are resolved.
+var configLayers = struct {
+	mu     sync.Mutex
+	values map[string]map[string]string
+}{values: map[string]map[string]string{}}
+
+// setLayer replaces the config env vars set by source, it returns true when they changed
+func setLayer(source string, values map[string]string) bool {
+	configLayers.mu.Lock()
+	defer configLayers.mu.Unlock()
+	previous := configLayers.values[source]
+	configLayers.values[source] = values
+	if len(previous) != len(values) {
+		return true
+	}
+	for key, value := range values {
+		if previousValue, found := previous[key]; !found || previousValue != value {
+			return true
+		}
+	}
+	return false
+}
+
+// processLayers returns the config env vars of every source along with the env of the function and options
+func processLayers(options map[string]string) map[string]map[string]string {
+	layers := map[string]map[string]string{SourceOption: options, SourceEnv: {}}
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		layers[SourceEnv][parts[0]] = parts[1]
+	}
+	configLayers.mu.Lock()
+	defer configLayers.mu.Unlock()
+	for source, values := range configLayers.values {
+		layers[source] = values
+	}
+	return layers
+}
+
+// resolveLayers returns the config env vars of layers, by source, in the order of precedence above. The
+// references are resolved with resolve, they are kept as they are when resolve is nil or fails.
+func resolveLayers(layers map[string]map[string]string, resolve func(reference string) (string, error)) (map[string]setting, error) {
+	keys := map[string]bool{}
+	for _, values := range layers {
+		for key := range values {
+			keys[key] = true
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	settings := make(map[string]setting, len(sorted))
+	var allErrors []string
+	for _, key := range sorted {
+		resolved, found := highestSetting(layers, functionSources, key, false)
+		if !found {
+			// a reference of the shared sources overrides their plain values
+			resolved, found = highestSetting(layers, sharedSources, key, true)
+		}
+		if !found {
+			resolved, _ = highestSetting(layers, sharedSources, key, false)
+		}
+		if resolve != nil && isConfigEnv(key) && isReference(resolved.value) {
+			value, err := resolve(resolved.value)
+			if err != nil {
+				allErrors = append(allErrors, fmt.Sprintf("Unable to resolve %s: %v", key, err))
+			} else {
+				resolved = setting{value: value, source: referenceSource(resolved.value)}
+			}
+		}
+		settings[key] = resolved
+	}
+	if len(allErrors) > 0 {
+		return settings, errors.New(strings.Join(allErrors, ", "))
+	}
+	return settings, nil
+}
+
+// highestSetting returns the value of key of the source of sources which sets it first, only references
+// when references is set
+func highestSetting(layers map[string]map[string]string, sources []string, key string, references bool) (setting, bool) {
+	for _, source := range sources {
+		value, found := layers[source][key]
+		if found && (!references || isReference(value)) {
+			return setting{value: value, source: source}, true
+		}
+	}
+	return setting{}, false
+}
+
+// referenceSource returns the source of the value of a reference
+func referenceSource(reference string) string {
+	if strings.HasPrefix(reference, ssmReferencePrefix) {
+		return SourceSSM
+	}
+	return SourceSecretsManager
+}
+
+// currentEnv returns the config env vars of the process layers without resolving the references, for the
+// settings read before the config is resolved
+func currentEnv() map[string]setting {
+	settings, _ := resolveLayers(processLayers(nil), nil)
+	return settings
+}
+
+// Resolve returns the value of a config env var, the source it comes from and whether it is set, from the
+// layers resolved by New
+func (e *envSource) Resolve(key string) (string, string, bool) {
+	resolved, found := e.settings[key]
+	return resolved.value, resolved.source, found
+}
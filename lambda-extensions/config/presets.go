@@ -0,0 +1,19 @@
+package config
+
+// FieldMapping is the keys a logging framework uses in its json lines
+type FieldMapping struct {
+	Level     string
+	Timestamp string
+	Message   string
+	// NumericLevels are the levels written as numbers, like bunyan and pino do
+	NumericLevels bool
+}
+
+// FieldMappingPresets are the values of SUMO_FIELD_MAPPING_PRESET
+var FieldMappingPresets = map[string]FieldMapping{
+	"winston":      {Level: "level", Timestamp: "timestamp", Message: "message"},
+	"bunyan":       {Level: "level", Timestamp: "time", Message: "msg", NumericLevels: true},
+	"zap":          {Level: "level", Timestamp: "ts", Message: "msg"},
+	"logback-json": {Level: "level", Timestamp: "@timestamp", Message: "message"},
+	"python-json":  {Level: "levelname", Timestamp: "asctime", Message: "message"},
+}
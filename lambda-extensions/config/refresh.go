@@ -0,0 +1,42 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// lastRefresh is when the dynamic config sources were last refreshed, the init counts as the first refresh
+var lastRefresh = time.Now()
+
+// RefreshDynamicSources resolves the parameter and secret references again, fetches the secret of
+// SUMO_HTTP_ENDPOINT_SECRET_ARN again and polls the AppConfig profile once ConfigRefreshInterval elapsed
+// since the last refresh, so that warm environments pick up rotated endpoints. It returns true when a value
+// changed, the config then has to be reloaded.
+func (cfg *LambdaExtensionConfig) RefreshDynamicSources() (bool, error) {
+	if cfg.ConfigRefreshInterval == 0 || utils.Since(lastRefresh) < cfg.ConfigRefreshInterval {
+		return false, nil
+	}
+	lastRefresh = time.Now()
+	var allErrors []string
+	changed, err := refreshReferences()
+	if err != nil {
+		allErrors = append(allErrors, err.Error())
+	}
+	// the endpoint of the secret is read when posting, it does not need a reload
+	if _, err := cfg.RefreshEndpointSecret(0); err != nil {
+		allErrors = append(allErrors, err.Error())
+	}
+	// the profile is polled now even when its own poll interval did not elapse
+	appConfig.lastPoll = time.Time{}
+	profileChanged, err := cfg.PollAppConfig()
+	if err != nil {
+		allErrors = append(allErrors, err.Error())
+	}
+	if len(allErrors) > 0 {
+		return changed || profileChanged, errors.New(strings.Join(allErrors, ", "))
+	}
+	return changed || profileChanged, nil
+}
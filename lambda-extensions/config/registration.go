@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// Extensions API events of SUMO_REGISTRATION_EVENTS
+const (
+	EventInvoke   = "INVOKE"
+	EventShutdown = "SHUTDOWN"
+)
+
+var validRegistrationEvents = []string{EventInvoke, EventShutdown}
+
+// invokelessFlushInterval is the FlushInterval used when not registering for INVOKE, the dataQueue is
+// otherwise only drained on shutdown
+const invokelessFlushInterval = 1 * time.Second
+
+// Disabled tells whether the kill switch, see parseDisabled, turns the extension into a no-op, which registers
+// for SHUTDOWN only and neither subscribes nor sends anything, so that it can be switched off without removing
+// the layer. An invalid kill switch is returned as an error and does not disable the extension. It is read
+// before the references are resolved, so it can not be one.
+func Disabled() (bool, error) {
+	applyLocalSources()
+	env := currentEnv()
+	return parseDisabled(func(key string) string { return env[key].value })
+}
+
+// parseDisabled reads the kill switch with getenv. SUMO_DISABLE is the kill switch and SUMO_ENABLED its
+// negated alias: SUMO_ENABLED=false reads as SUMO_DISABLE=true. Setting both is valid as long as they agree.
+func parseDisabled(getenv func(string) string) (bool, error) {
+	var allErrors []string
+	var switches []string
+	disabled := map[string]bool{}
+	for _, key := range []string{"SUMO_DISABLE", "SUMO_ENABLED"} {
+		value := getenv(key)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to parse %s: %v", key, err))
+			continue
+		}
+		switches = append(switches, key)
+		disabled[key] = parsed == (key == "SUMO_DISABLE")
+	}
+	if len(switches) == 2 && disabled["SUMO_DISABLE"] != disabled["SUMO_ENABLED"] {
+		allErrors = append(allErrors, fmt.Sprintf("SUMO_DISABLE=%s contradicts SUMO_ENABLED=%s", getenv("SUMO_DISABLE"), getenv("SUMO_ENABLED")))
+	}
+	if len(allErrors) > 0 {
+		return false, errors.New(strings.Join(allErrors, ", "))
+	}
+	return len(switches) > 0 && disabled[switches[0]], nil
+}
+
+// RegistrationEvents returns the events of SUMO_REGISTRATION_EVENTS. The registration starts before the config
+// is resolved so the env var is read on its own, an invalid value registers for all the events and is
+// reported by GetConfig.
+func RegistrationEvents() []string {
+	// an invalid kill switch is reported by GetConfig
+	if disabled, _ := Disabled(); disabled {
+		return []string{EventShutdown}
+	}
+	events, err := parseRegistrationEvents(currentEnv()["SUMO_REGISTRATION_EVENTS"].value)
+	if err != nil {
+		return validRegistrationEvents
+	}
+	return events
+}
+
+// RegisteredForInvoke tells whether the extension is woken up by every invocation
+func (cfg *LambdaExtensionConfig) RegisteredForInvoke() bool {
+	return utils.StringInSlice(EventInvoke, cfg.RegistrationEvents)
+}
+
+func parseRegistrationEvents(value string) ([]string, error) {
+	if value == "" {
+		return validRegistrationEvents, nil
+	}
+	var events []string
+	for _, event := range strings.Split(value, ",") {
+		event = strings.ToUpper(strings.TrimSpace(event))
+		if !utils.StringInSlice(event, validRegistrationEvents) {
+			return nil, fmt.Errorf("event %s is unsupported", event)
+		}
+		if !utils.StringInSlice(event, events) {
+			events = append(events, event)
+		}
+	}
+	// the dataQueue is flushed on shutdown, without it the last logs of the environment are lost
+	if !utils.StringInSlice(EventShutdown, events) {
+		return nil, fmt.Errorf("%s is required", EventShutdown)
+	}
+	return events, nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+// redactedFields hold credentials, the collector endpoints embed their token in the path
+var redactedFields = map[string]bool{
+	"SumoHTTPEndpoint":   true,
+	"AliasEndpoints":     true,
+	"EndpointCandidates": true,
+	"LogTypeConfig":      true,
+	"SigningKey":         true,
+	"CommitWebhookURL":   true,
+}
+
+// Resolved returns the settings of the config by field name with the credentials redacted, durations and
+// levels as text, for printing the config an environment resolves to
+func (cfg *LambdaExtensionConfig) Resolved() map[string]interface{} {
+	settings := map[string]interface{}{}
+	value := reflect.ValueOf(*cfg)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		v := value.Field(i).Interface()
+		switch typed := v.(type) {
+		case time.Duration:
+			v = typed.String()
+		case fmt.Stringer:
+			v = typed.String()
+		}
+		if redactedFields[field.Name] {
+			v = redact(v)
+		}
+		settings[field.Name] = v
+	}
+	return settings
+}
+
+// redact keeps the host of the endpoints so that a wrong deployment or region is still visible
+func redact(v interface{}) interface{} {
+	switch typed := v.(type) {
+	case string:
+		if typed == "" {
+			return ""
+		}
+		if u, err := url.Parse(typed); err == nil && u.Host != "" {
+			return fmt.Sprintf("%s://%s/REDACTED", u.Scheme, u.Host)
+		}
+		return "REDACTED"
+	case map[string]string:
+		redacted := make(map[string]string, len(typed))
+		for key, value := range typed {
+			redacted[key] = redact(value).(string)
+		}
+		return redacted
+	case []EndpointCandidate:
+		redacted := make([]EndpointCandidate, len(typed))
+		for i, candidate := range typed {
+			candidate.URL = redact(candidate.URL).(string)
+			redacted[i] = candidate
+		}
+		return redacted
+	case map[string]LogTypeSettings:
+		redacted := make(map[string]LogTypeSettings, len(typed))
+		for logType, settings := range typed {
+			settings.Endpoint = redact(settings.Endpoint).(string)
+			redacted[logType] = settings
+		}
+		return redacted
+	}
+	return "REDACTED"
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// setEndpoint caches the endpoint of source and tells whether it changed
+func (s *endpointSecretCache) setEndpoint(source, endpoint string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := s.endpoint != endpoint
+	s.source, s.endpoint = source, endpoint
+	return changed
+}
+
+// currentEndpoint returns the cached endpoint
+func (s *endpointSecretCache) currentEndpoint() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.endpoint
+}
+
+// currentSource returns the secret ARN or the ciphertext of the cached endpoint
+func (s *endpointSecretCache) currentSource() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source
+}
+
+// RefreshEndpointSecret fetches the secret of SUMO_HTTP_ENDPOINT_SECRET_ARN again when it was fetched more
+// than minAge ago, so that a rotated collector token is picked up by the warm environments. It is called
+// between invocations every EndpointSecretTTL and on 401 responses, minAge bounds the fetches of the
+// latter. It returns true when the endpoint changed, Endpoint returns the new one right away.
+func (cfg *LambdaExtensionConfig) RefreshEndpointSecret(minAge time.Duration) (bool, error) {
+	if !cfg.endpointFromSecret {
+		return false, nil
+	}
+	endpointSecret.fetchMu.Lock()
+	defer endpointSecret.fetchMu.Unlock()
+	if minAge > 0 && utils.Since(endpointSecret.fetchedAt) < minAge {
+		return false, nil
+	}
+	// failed fetches count as well so that a missing permission does not fetch on every response
+	endpointSecret.fetchedAt = time.Now()
+	secretARN := endpointSecret.currentSource()
+	endpoint, err := fetchEndpointSecret(secretARN)
+	if err != nil {
+		return false, fmt.Errorf("Unable to fetch SUMO_HTTP_ENDPOINT_SECRET_ARN: %v", err)
+	}
+	return endpointSecret.setEndpoint(secretARN, endpoint), nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/fields"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// Processing outcomes of a batch which can be sent with their own source metadata
+const (
+	// OutcomeCatchUp is a failover object replayed by the catch-up
+	OutcomeCatchUp = "catchUp"
+	// OutcomeDebugCapture is a batch sent while a debug capture is running
+	OutcomeDebugCapture = "debugCapture"
+)
+
+var validOutcomes = []string{OutcomeCatchUp, OutcomeDebugCapture}
+
+// OutcomeMetadata returns the source metadata configured in SUMO_OUTCOME_METADATA for the outcome of a batch,
+// with the empty values left to the defaults. An empty outcome is a batch processed as usual.
+func (cfg *LambdaExtensionConfig) OutcomeMetadata(outcome string) fields.Metadata {
+	return cfg.OutcomeMetadataMap[outcome]
+}
+
+// parseOutcomeMetadata reads the outcomes of SUMO_OUTCOME_METADATA separated by ; and written
+// outcome:category=VALUE&host=VALUE&name=VALUE, values being query escaped, e.g.
+// SUMO_OUTCOME_METADATA='catchUp:category=aws/lambda/replayed;debugCapture:name=debug'.
+func parseOutcomeMetadata(value string) (map[string]fields.Metadata, error) {
+	outcomes := map[string]fields.Metadata{}
+	var allErrors []string
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		outcome := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || outcome == "" {
+			allErrors = append(allErrors, fmt.Sprintf("entry %q is not in outcome:category=VALUE&host=VALUE&name=VALUE format", entry))
+			continue
+		}
+		if !utils.StringInSlice(outcome, validOutcomes) {
+			allErrors = append(allErrors, fmt.Sprintf("outcome %s is unsupported", outcome))
+			continue
+		}
+		settings, err := url.ParseQuery(strings.TrimSpace(parts[1]))
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("outcome %s: %v", outcome, err))
+			continue
+		}
+		var metadata fields.Metadata
+		for key := range settings {
+			switch key {
+			case "category":
+				metadata.Category = settings.Get(key)
+			case "host":
+				metadata.Host = settings.Get(key)
+			case "name":
+				metadata.Name = settings.Get(key)
+			default:
+				allErrors = append(allErrors, fmt.Sprintf("outcome %s can not set %s", outcome, key))
+			}
+		}
+		if err := metadata.Validate(); err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("outcome %s: %v", outcome, err))
+			continue
+		}
+		outcomes[outcome] = metadata
+	}
+	if len(allErrors) > 0 {
+		return outcomes, errors.New(strings.Join(allErrors, ", "))
+	}
+	return outcomes, nil
+}
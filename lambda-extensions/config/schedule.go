@@ -0,0 +1,191 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	// the provided runtimes do not all ship the zoneinfo files
+	_ "time/tzdata"
+)
+
+// scheduleZonePrefix selects the time zone of SUMO_SHIP_SCHEDULE, as CRON_TZ does for crontab entries
+const scheduleZonePrefix = "CRON_TZ="
+
+var scheduleDays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ShipSchedule is the parsed SUMO_SHIP_SCHEDULE, the windows in which all the records are shipped. Outside of
+// them only the error records are.
+type ShipSchedule struct {
+	Location *time.Location
+	Windows  []ShipWindow
+}
+
+// ShipWindow is a time range on some days of the week, in minutes since midnight. A window ending before it
+// starts runs past midnight into the next day.
+type ShipWindow struct {
+	Days  [7]bool
+	Start int
+	End   int
+}
+
+// ShipVerbose tells whether all the records are shipped at t, which is always the case without
+// SUMO_SHIP_SCHEDULE
+func (cfg *LambdaExtensionConfig) ShipVerbose(t time.Time) bool {
+	if cfg.ShipSchedule == nil {
+		return true
+	}
+	return cfg.ShipSchedule.contains(t)
+}
+
+// String returns the schedule in the format of SUMO_SHIP_SCHEDULE, with the days listed one by one
+func (s *ShipSchedule) String() string {
+	if s == nil {
+		return ""
+	}
+	var windows []string
+	for _, w := range s.Windows {
+		var days []string
+		for day, set := range w.Days {
+			if set {
+				days = append(days, time.Weekday(day).String()[:3])
+			}
+		}
+		windows = append(windows, fmt.Sprintf("%s %02d:%02d-%02d:%02d", strings.Join(days, ","), w.Start/60, w.Start%60, w.End/60, w.End%60))
+	}
+	return scheduleZonePrefix + s.Location.String() + " " + strings.Join(windows, ";")
+}
+
+func (s *ShipSchedule) contains(t time.Time) bool {
+	t = t.In(s.Location)
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	previousDay := (day + 6) % 7
+	for _, w := range s.Windows {
+		if w.Start < w.End {
+			if w.Days[day] && minute >= w.Start && minute < w.End {
+				return true
+			}
+			continue
+		}
+		// the window of the previous day runs until End
+		if (w.Days[day] && minute >= w.Start) || (w.Days[previousDay] && minute < w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseShipSchedule reads the windows of SUMO_SHIP_SCHEDULE separated by ; and written DAYS HH:MM-HH:MM, the
+// days being a comma separated list of days or ranges of days, or * for every day. The times are in UTC
+// unless the schedule starts with a CRON_TZ= time zone, e.g.
+// SUMO_SHIP_SCHEDULE='CRON_TZ=Europe/Paris Mon-Fri 08:00-19:00;Sat 09:00-12:00'.
+func parseShipSchedule(value string) (*ShipSchedule, error) {
+	schedule := &ShipSchedule{Location: time.UTC}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, scheduleZonePrefix) {
+		parts := strings.SplitN(value, " ", 2)
+		location, err := time.LoadLocation(strings.TrimPrefix(parts[0], scheduleZonePrefix))
+		if err != nil {
+			return nil, err
+		}
+		schedule.Location = location
+		value = ""
+		if len(parts) == 2 {
+			value = parts[1]
+		}
+	}
+	var allErrors []string
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		window, err := parseShipWindow(entry)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("window %q: %v", entry, err))
+			continue
+		}
+		schedule.Windows = append(schedule.Windows, window)
+	}
+	if len(allErrors) > 0 {
+		return nil, errors.New(strings.Join(allErrors, ", "))
+	}
+	if len(schedule.Windows) == 0 {
+		return nil, errors.New("no window is set")
+	}
+	return schedule, nil
+}
+
+func parseShipWindow(entry string) (ShipWindow, error) {
+	var window ShipWindow
+	parts := strings.Fields(entry)
+	if len(parts) != 2 {
+		return window, errors.New("expected DAYS HH:MM-HH:MM")
+	}
+	for _, days := range strings.Split(parts[0], ",") {
+		if days == "*" {
+			for day := range window.Days {
+				window.Days[day] = true
+			}
+			continue
+		}
+		bounds := strings.SplitN(strings.ToLower(days), "-", 2)
+		first, found := scheduleDays[bounds[0]]
+		if !found {
+			return window, fmt.Errorf("day %s is unsupported", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, found = scheduleDays[bounds[1]]; !found {
+				return window, fmt.Errorf("day %s is unsupported", bounds[1])
+			}
+		}
+		// ranges can wrap around the end of the week, e.g. Fri-Mon
+		for day := first; ; day = (day + 1) % 7 {
+			window.Days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	times := strings.SplitN(parts[1], "-", 2)
+	if len(times) != 2 {
+		return window, errors.New("expected HH:MM-HH:MM")
+	}
+	var err error
+	if window.Start, err = parseScheduleTime(times[0]); err != nil {
+		return window, err
+	}
+	if window.End, err = parseScheduleTime(times[1]); err != nil {
+		return window, err
+	}
+	if window.Start == window.End {
+		return window, errors.New("the window is empty")
+	}
+	return window, nil
+}
+
+// parseScheduleTime returns the minutes since midnight of HH:MM, 24:00 being the end of the day
+func parseScheduleTime(value string) (int, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("time %s is not HH:MM", value)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("time %s is not HH:MM", value)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("time %s is not HH:MM", value)
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes > 0) {
+		return 0, fmt.Errorf("time %s is out of range", value)
+	}
+	return hours*60 + minutes, nil
+}
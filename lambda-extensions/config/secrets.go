@@ -0,0 +1,338 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+const (
+	// Prefixes of env var values which are references to be resolved, e.g. SUMO_HTTP_ENDPOINT=ssm:///sumo/endpoint
+	ssmReferencePrefix            = "ssm://"
+	secretsManagerReferencePrefix = "secretsmanager://"
+
+	// AWS Parameters and Secrets Lambda extension, serving cached SSM parameters and secrets on localhost
+	paramsSecretsExtensionPath = "/opt/extensions/AWSParametersAndSecretsLambdaExtension"
+	paramsSecretsPortEnv       = "PARAMETERS_SECRETS_EXTENSION_HTTP_PORT"
+	paramsSecretsDefaultPort   = "2773"
+	paramsSecretsTokenHeader   = "X-Aws-Parameters-Secrets-Token"
+	// the extension starts in parallel with this one, so early calls are retried until it is ready
+	paramsSecretsNumRetry   = 10
+	paramsSecretsRetrySleep = 100 * time.Millisecond
+
+	// calls to the SSM and Secrets Manager APIs, the SDK retries them itself
+	awsAPINumRetry = 3
+	awsAPITimeout  = 3000 * time.Millisecond
+
+	// endpointSecretKey is the key of the endpoint in key/value secrets of SUMO_HTTP_ENDPOINT_SECRET_ARN
+	endpointSecretKey = "SUMO_HTTP_ENDPOINT"
+
+	// layerRoot is where Lambda extracts the layers, relative paths of SUMO_HTTP_ENDPOINT_FILE are in it
+	layerRoot = "/opt"
+)
+
+// endpointSecret caches the endpoint fetched or decrypted at init, the config reloads do not fetch it again.
+// The endpoint of a secret is fetched again by RefreshEndpointSecret, mu guards it as Endpoint reads it
+// while posting.
+var endpointSecret endpointSecretCache
+
+type endpointSecretCache struct {
+	mu       sync.Mutex
+	source   string
+	endpoint string
+	// fetchMu serializes the fetches of the secret, fetchedAt is guarded by it
+	fetchMu   sync.Mutex
+	fetchedAt time.Time
+}
+
+// configEnvPrefixes are the env vars in which references are resolved
+var configEnvPrefixes = []string{"SUMO_", "SOURCE_"}
+
+// referenceResolver fetches the parameters and secrets referenced by the config env vars
+type referenceResolver interface {
+	getParameter(name string) (string, error)
+	getSecret(secretID string) (string, error)
+}
+
+// newReferenceResolver prefers the AWS Parameters and Secrets extension, whose values are cached across
+// cold starts, and calls the SSM and Secrets Manager APIs when it is not part of the function
+func newReferenceResolver() referenceResolver {
+	if client := detectParamsSecretsExtension(); client != nil {
+		return client
+	}
+	return awsAPIResolver{}
+}
+
+// awsAPIResolver fetches parameters and secrets with the SSM and Secrets Manager APIs
+type awsAPIResolver struct{}
+
+func (awsAPIResolver) getParameter(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), awsAPITimeout)
+	defer cancel()
+	return utils.GetParameter(ctx, name, awsAPINumRetry)
+}
+
+func (awsAPIResolver) getSecret(secretID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), awsAPITimeout)
+	defer cancel()
+	return utils.GetSecretString(ctx, secretID, awsAPINumRetry)
+}
+
+// paramsSecretsClient fetches parameters and secrets through the AWS Parameters and Secrets Lambda extension
+type paramsSecretsClient struct {
+	baseURL    string
+	httpClient http.Client
+}
+
+// detectParamsSecretsExtension returns a client when the AWS Parameters and Secrets extension is part of the function
+func detectParamsSecretsExtension() *paramsSecretsClient {
+	port, found := os.LookupEnv(paramsSecretsPortEnv)
+	if !found {
+		if _, err := os.Stat(paramsSecretsExtensionPath); err != nil {
+			return nil
+		}
+		port = paramsSecretsDefaultPort
+	}
+	return &paramsSecretsClient{
+		baseURL:    fmt.Sprintf("http://localhost:%s", port),
+		httpClient: http.Client{Timeout: 1000 * time.Millisecond},
+	}
+}
+
+// getParameter returns the decrypted value of an SSM parameter
+func (c *paramsSecretsClient) getParameter(name string) (string, error) {
+	var response struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	err := c.get("/systemsmanager/parameters/get?withDecryption=true&name="+url.QueryEscape(name), &response)
+	return response.Parameter.Value, err
+}
+
+// getSecret returns the string value of a Secrets Manager secret
+func (c *paramsSecretsClient) getSecret(secretID string) (string, error) {
+	var response struct {
+		SecretString string `json:"SecretString"`
+	}
+	err := c.get("/secretsmanager/get?secretId="+url.QueryEscape(secretID), &response)
+	return response.SecretString, err
+}
+
+func (c *paramsSecretsClient) get(path string, v interface{}) error {
+	return utils.Retry(func(attempt int) (bool, error) {
+		request, err := http.NewRequest("GET", c.baseURL+path, nil)
+		if err != nil {
+			return false, err
+		}
+		request.Header.Set(paramsSecretsTokenHeader, os.Getenv("AWS_SESSION_TOKEN"))
+		response, err := c.httpClient.Do(request)
+		if err != nil {
+			time.Sleep(paramsSecretsRetrySleep)
+			return true, err
+		}
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return true, err
+		}
+		if response.StatusCode != 200 {
+			// not found or access denied won't be fixed by retrying
+			return response.StatusCode >= 500, fmt.Errorf("Request failed with status %s and response %s", response.Status, string(body))
+		}
+		return false, json.Unmarshal(body, v)
+	}, paramsSecretsNumRetry)
+}
+
+// resolvedReferences are the values of the parameter and secret references by reference, kept across config
+// reloads so that they are only fetched again by RefreshDynamicSources. mu serializes the fetches.
+var resolvedReferences = struct {
+	mu       sync.Mutex
+	resolver referenceResolver
+	values   map[string]string
+}{values: map[string]string{}}
+
+// resolveCachedReference returns the value of a reference, which is fetched the first time only
+func resolveCachedReference(reference string) (string, error) {
+	resolvedReferences.mu.Lock()
+	defer resolvedReferences.mu.Unlock()
+	if value, found := resolvedReferences.values[reference]; found {
+		return value, nil
+	}
+	if resolvedReferences.resolver == nil {
+		resolvedReferences.resolver = newReferenceResolver()
+	}
+	value, err := resolveReference(resolvedReferences.resolver, reference)
+	if err != nil {
+		return "", err
+	}
+	resolvedReferences.values[reference] = value
+	return value, nil
+}
+
+// refreshReferences fetches the references resolved so far again, it returns true when a value changed. A
+// reference which can not be fetched keeps its value.
+func refreshReferences() (bool, error) {
+	resolvedReferences.mu.Lock()
+	defer resolvedReferences.mu.Unlock()
+	changed := false
+	var allErrors []string
+	for reference, previous := range resolvedReferences.values {
+		value, err := resolveReference(resolvedReferences.resolver, reference)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Unable to resolve %s: %v", reference, err))
+			continue
+		}
+		if value != previous {
+			resolvedReferences.values[reference] = value
+			changed = true
+		}
+	}
+	if len(allErrors) > 0 {
+		return changed, errors.New(strings.Join(allErrors, ", "))
+	}
+	return changed, nil
+}
+
+// resolveReference returns the value of an ssm:// or secretsmanager:// reference
+func resolveReference(resolver referenceResolver, reference string) (string, error) {
+	if strings.HasPrefix(reference, ssmReferencePrefix) {
+		return resolver.getParameter(strings.TrimPrefix(reference, ssmReferencePrefix))
+	}
+	return resolver.getSecret(strings.TrimPrefix(reference, secretsManagerReferencePrefix))
+}
+
+// applyEndpointSecret sets the endpoint from the secret of SUMO_HTTP_ENDPOINT_SECRET_ARN, from the KMS
+// ciphertext of SUMO_HTTP_ENDPOINT_ENCRYPTED or from the file of SUMO_HTTP_ENDPOINT_FILE, which keep the
+// collector URL, a credential, out of the plain text env vars
+func (cfg *LambdaExtensionConfig) applyEndpointSecret(env *envSource) error {
+	secretARN := env.Getenv("SUMO_HTTP_ENDPOINT_SECRET_ARN")
+	ciphertext := env.Getenv("SUMO_HTTP_ENDPOINT_ENCRYPTED")
+	endpointFile := env.Getenv("SUMO_HTTP_ENDPOINT_FILE")
+	set := 0
+	for _, value := range []string{cfg.SumoHTTPEndpoint, secretARN, ciphertext, endpointFile} {
+		if value != "" {
+			set++
+		}
+	}
+	if set == 0 || (set == 1 && cfg.SumoHTTPEndpoint != "") {
+		return nil
+	}
+	if set > 1 {
+		return errors.New("only one of SUMO_HTTP_ENDPOINT, SUMO_HTTP_ENDPOINT_SECRET_ARN, SUMO_HTTP_ENDPOINT_ENCRYPTED and SUMO_HTTP_ENDPOINT_FILE can be set")
+	}
+	if endpointFile != "" {
+		// read on every config reload, so that a file updated on the mount is picked up without a cold start
+		endpoint, err := readEndpointFile(endpointFile)
+		if err != nil {
+			return fmt.Errorf("Unable to read SUMO_HTTP_ENDPOINT_FILE: %v", err)
+		}
+		cfg.SumoHTTPEndpoint = endpoint
+		return nil
+	}
+	if secretARN != "" && endpointSecret.currentSource() != secretARN {
+		endpointSecret.fetchMu.Lock()
+		defer endpointSecret.fetchMu.Unlock()
+		endpoint, err := fetchEndpointSecret(secretARN)
+		if err != nil {
+			return fmt.Errorf("Unable to fetch SUMO_HTTP_ENDPOINT_SECRET_ARN: %v", err)
+		}
+		endpointSecret.setEndpoint(secretARN, endpoint)
+		endpointSecret.fetchedAt = time.Now()
+	}
+	if ciphertext != "" && endpointSecret.currentSource() != ciphertext {
+		endpoint, err := decryptEndpoint(ciphertext, cfg.FunctionName)
+		if err != nil {
+			return fmt.Errorf("Unable to decrypt SUMO_HTTP_ENDPOINT_ENCRYPTED: %v", err)
+		}
+		endpointSecret.setEndpoint(ciphertext, endpoint)
+	}
+	cfg.SumoHTTPEndpoint = endpointSecret.currentEndpoint()
+	cfg.endpointFromSecret = secretARN != ""
+	return nil
+}
+
+// decryptEndpoint returns the endpoint of a base64 encoded KMS ciphertext, encrypted with the function name
+// as encryption context by the encryption helpers of the Lambda console or without encryption context
+func decryptEndpoint(encoded string, functionName string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", fmt.Errorf("the ciphertext is not base64 encoded: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), awsAPITimeout)
+	defer cancel()
+	encryptionContext := map[string]string{"LambdaFunctionName": functionName}
+	plaintext, err := utils.Decrypt(ctx, ciphertext, encryptionContext, awsAPINumRetry)
+	if err != nil {
+		return "", err
+	}
+	if len(plaintext) == 0 {
+		return "", errors.New("the plaintext is empty")
+	}
+	return strings.TrimSpace(string(plaintext)), nil
+}
+
+// fetchEndpointSecret returns the endpoint stored as the secret string, or as its SUMO_HTTP_ENDPOINT key
+// for key/value secrets
+func fetchEndpointSecret(secretARN string) (string, error) {
+	value, err := awsAPIResolver{}.getSecret(secretARN)
+	if err != nil {
+		return "", err
+	}
+	return parseEndpointValue(value, "secret "+secretARN)
+}
+
+// readEndpointFile returns the endpoint of a file mounted from EFS or written by a secrets injection layer,
+// a relative path is the one of a file shipped in a layer
+func readEndpointFile(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(layerRoot, path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return parseEndpointValue(string(data), "file "+path)
+}
+
+// parseEndpointValue returns the endpoint of a secret or file holding either the endpoint or key/value pairs
+// with the SUMO_HTTP_ENDPOINT key, origin names the secret or file in errors
+func parseEndpointValue(value string, origin string) (string, error) {
+	endpoint := strings.TrimSpace(value)
+	if strings.HasPrefix(endpoint, "{") {
+		var keyValues map[string]string
+		if err := json.Unmarshal([]byte(endpoint), &keyValues); err != nil {
+			return "", fmt.Errorf("%s is not a string nor key/value pairs: %v", origin, err)
+		}
+		endpoint = strings.TrimSpace(keyValues[endpointSecretKey])
+	}
+	if endpoint == "" {
+		return "", fmt.Errorf("%s has no endpoint", origin)
+	}
+	return endpoint, nil
+}
+
+func isConfigEnv(key string) bool {
+	for _, prefix := range configEnvPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isReference(value string) bool {
+	return strings.HasPrefix(value, ssmReferencePrefix) || strings.HasPrefix(value, secretsManagerReferencePrefix)
+}
@@ -0,0 +1,40 @@
+package config
+
+// Sources of the config env vars returned by Sources
+const (
+	SourceEnv            = "env"
+	SourceOption         = "option"
+	SourceConfigJSON     = "configJson"
+	SourceConfigFile     = "configFile"
+	SourceStartupFile    = "startupFile"
+	SourceAppConfig      = "appConfig"
+	SourceExperiment     = "experiment"
+	SourceSSM            = "ssm"
+	SourceSecretsManager = "secretsManager"
+	SourceKMS            = "kms"
+	SourceEndpointFile   = "endpointFile"
+)
+
+// Sources returns the source of every config env var set when the config was built, the settings of the
+// env vars not set are the defaults. The env vars holding a resolved reference are sourced from SSM or
+// Secrets Manager.
+func (cfg *LambdaExtensionConfig) Sources() map[string]string {
+	return cfg.sources
+}
+
+func configSources(env *envSource) map[string]string {
+	sources := map[string]string{}
+	for key, resolved := range env.settings {
+		if isConfigEnv(key) || resolved.source == SourceOption {
+			sources[key] = resolved.source
+		}
+	}
+	if env.Getenv("SUMO_HTTP_ENDPOINT_SECRET_ARN") != "" {
+		sources["SUMO_HTTP_ENDPOINT"] = SourceSecretsManager
+	} else if env.Getenv("SUMO_HTTP_ENDPOINT_ENCRYPTED") != "" {
+		sources["SUMO_HTTP_ENDPOINT"] = SourceKMS
+	} else if env.Getenv("SUMO_HTTP_ENDPOINT_FILE") != "" {
+		sources["SUMO_HTTP_ENDPOINT"] = SourceEndpointFile
+	}
+	return sources
+}
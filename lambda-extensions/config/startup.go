@@ -0,0 +1,58 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// startupPollInterval is how often the startup wait file is checked for
+const startupPollInterval = 50 * time.Millisecond
+
+// WaitForStartupFile blocks until the file at path exists and is non-empty or the timeout expires.
+// It is used to hold back the Logs API subscription until a sibling extension has written its values.
+func WaitForStartupFile(path string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		info, err := os.Stat(path)
+		if err == nil && info.Size() > 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out after %v waiting for %s", timeout, path)
+		}
+		time.Sleep(startupPollInterval)
+	}
+}
+
+// LoadEnvFile reads KEY=VALUE lines from path into the layer of the startup file.
+// They override the config blob and file but not the variables set on the function, see functionSources.
+// Blank lines and lines starting with # are skipped.
+func LoadEnvFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		values[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	setLayer(SourceStartupFile, values)
+	return nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// otherConfigEnv are the env vars read besides the ones of knownConfigEnv, which can not be set from
+// SUMO_CONFIG_JSON
+var otherConfigEnv = []string{"SUMO_CONFIG_JSON", "SUMO_FAULT_INJECTION", "SUMO_FAULT_INJECTION_SEED"}
+
+// maxSuggestionDistance is the number of edits within which a known env var is suggested for an unknown one
+const maxSuggestionDistance = 3
+
+// UnknownEnv returns the SUMO_ env vars of the environment and of the other sources which the extension does
+// not read, followed by the known env var closest to them, e.g. "SUMO_NUM_RETRY (did you mean
+// SUMO_NUM_RETRIES?)". A misspelled env var otherwise silently leaves the setting to its default.
+func UnknownEnv() []string {
+	var unknown []string
+	for key := range currentEnv() {
+		if !strings.HasPrefix(key, "SUMO_") || utils.StringInSlice(key, knownConfigEnv) || utils.StringInSlice(key, otherConfigEnv) {
+			continue
+		}
+		if suggestion := closestConfigEnv(key); suggestion != "" {
+			key = fmt.Sprintf("%s (did you mean %s?)", key, suggestion)
+		}
+		unknown = append(unknown, key)
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// closestConfigEnv returns the known env var with the fewest edits from key, empty when none is within
+// maxSuggestionDistance. Short names need fewer edits, so that SUMO_FOO does not suggest SUMO_XRAY.
+func closestConfigEnv(key string) string {
+	maxDistance := maxSuggestionDistance
+	if name := len(key) - len("SUMO_"); name/3 < maxDistance {
+		maxDistance = name / 3
+	}
+	closest, closestDistance := "", maxDistance+1
+	for _, known := range knownConfigEnv {
+		if distance := editDistance(key, known); distance < closestDistance {
+			closest, closestDistance = known, distance
+		}
+	}
+	return closest
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
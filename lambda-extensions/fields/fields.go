@@ -0,0 +1,194 @@
+package fields
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Headers understood by Sumo Logic HTTP sources
+const (
+	CategoryHeader = "X-Sumo-Category"
+	HostHeader     = "X-Sumo-Host"
+	NameHeader     = "X-Sumo-Name"
+	FieldsHeader   = "X-Sumo-Fields"
+)
+
+// Limits enforced by Sumo Logic on source metadata, requests exceeding them are rejected
+const (
+	maxCategoryLength   = 1024
+	maxHostLength       = 128
+	maxNameLength       = 128
+	maxFieldCount       = 30
+	maxFieldKeyLength   = 255
+	maxFieldValueLength = 200
+)
+
+var fieldKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_\-]*$`)
+
+// Fields is an ordered set of X-Sumo-Fields key value pairs with unique keys
+type Fields struct {
+	keys   []string
+	values map[string]string
+}
+
+// NewFields returns an empty Fields
+func NewFields() *Fields {
+	return &Fields{values: map[string]string{}}
+}
+
+// Parse reads fields in the X-Sumo-Fields format "key1=value1,key2=value2"
+func Parse(encoded string) (*Fields, error) {
+	f := NewFields()
+	var allErrors []string
+	for _, pair := range strings.Split(encoded, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			allErrors = append(allErrors, fmt.Sprintf("field %q is not in key=value format", pair))
+			continue
+		}
+		if err := f.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])); err != nil {
+			allErrors = append(allErrors, err.Error())
+		}
+	}
+	if len(allErrors) > 0 {
+		return f, errors.New(strings.Join(allErrors, ", "))
+	}
+	return f, nil
+}
+
+// Add validates and sets a field. Adding an existing key replaces its value instead of sending it twice.
+func (f *Fields) Add(key, value string) error {
+	if !fieldKeyPattern.MatchString(key) {
+		return fmt.Errorf("field key %q must start with a letter and contain only letters, digits, _ or -", key)
+	}
+	if len(key) > maxFieldKeyLength {
+		return fmt.Errorf("field key %q is longer than %d characters", key, maxFieldKeyLength)
+	}
+	if len(value) > maxFieldValueLength {
+		return fmt.Errorf("value of field %s is longer than %d characters", key, maxFieldValueLength)
+	}
+	if strings.ContainsAny(value, ",=") || hasControlCharacters(value) {
+		return fmt.Errorf("value of field %s contains forbidden characters", key)
+	}
+	if _, found := f.values[key]; !found {
+		if len(f.keys) >= maxFieldCount {
+			return fmt.Errorf("can not add field %s, at most %d fields are allowed", key, maxFieldCount)
+		}
+		f.keys = append(f.keys, key)
+	}
+	f.values[key] = value
+	return nil
+}
+
+// Clone returns a copy of the fields which can be added to without changing f
+func (f *Fields) Clone() *Fields {
+	clone := NewFields()
+	clone.keys = append(clone.keys, f.keys...)
+	for key, value := range f.values {
+		clone.values[key] = value
+	}
+	return clone
+}
+
+// Len returns the number of fields
+func (f *Fields) Len() int {
+	return len(f.keys)
+}
+
+// Pairs returns the key value pairs in their order
+func (f *Fields) Pairs() [][2]string {
+	pairs := make([][2]string, 0, len(f.keys))
+	for _, key := range f.keys {
+		pairs = append(pairs, [2]string{key, f.values[key]})
+	}
+	return pairs
+}
+
+// Encode returns the fields in the X-Sumo-Fields format
+func (f *Fields) Encode() string {
+	pairs := make([]string, 0, len(f.keys))
+	for _, key := range f.keys {
+		pairs = append(pairs, key+"="+f.values[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// String returns the fields in the X-Sumo-Fields format, for printing the config, empty for no fields
+func (f *Fields) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.Encode()
+}
+
+// Metadata is the source metadata sent with every request
+type Metadata struct {
+	Category string
+	Host     string
+	Name     string
+	Fields   *Fields
+}
+
+// Validate checks the metadata against the Sumo Logic limits and returns all the problems found
+func (m *Metadata) Validate() error {
+	var allErrors []string
+	for _, check := range []struct {
+		header    string
+		value     string
+		maxLength int
+	}{
+		{CategoryHeader, m.Category, maxCategoryLength},
+		{HostHeader, m.Host, maxHostLength},
+		{NameHeader, m.Name, maxNameLength},
+	} {
+		if err := validateValue(check.header, check.value, check.maxLength); err != nil {
+			allErrors = append(allErrors, err.Error())
+		}
+	}
+	if len(allErrors) > 0 {
+		return errors.New(strings.Join(allErrors, ", "))
+	}
+	return nil
+}
+
+// SetHeaders adds the non empty metadata to the request headers
+func (m *Metadata) SetHeaders(header http.Header) {
+	if m.Category != "" {
+		header.Set(CategoryHeader, m.Category)
+	}
+	if m.Host != "" {
+		header.Set(HostHeader, m.Host)
+	}
+	if m.Name != "" {
+		header.Set(NameHeader, m.Name)
+	}
+	if m.Fields != nil && m.Fields.Len() > 0 {
+		header.Set(FieldsHeader, m.Fields.Encode())
+	}
+}
+
+func validateValue(header, value string, maxLength int) error {
+	if len(value) > maxLength {
+		return fmt.Errorf("%s is longer than %d characters", header, maxLength)
+	}
+	if hasControlCharacters(value) {
+		return fmt.Errorf("%s contains control characters", header)
+	}
+	return nil
+}
+
+func hasControlCharacters(value string) bool {
+	for _, r := range value {
+		if r < 0x20 || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
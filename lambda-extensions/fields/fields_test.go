@@ -0,0 +1,59 @@
+package fields
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	f, err := Parse("team=payments, env=prod,team=billing")
+	if err != nil {
+		t.Errorf("Parse should not generate error: %v", err)
+	}
+	if f.Encode() != "team=billing,env=prod" {
+		t.Errorf("duplicate keys should be deduplicated, got %s", f.Encode())
+	}
+
+	_, err = Parse("team,1env=prod,env=a=b")
+	if err == nil {
+		t.Fatal("Parse should generate error")
+	}
+	for _, expected := range []string{`"team" is not in key=value format`, `field key "1env"`, "value of field env contains forbidden characters"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("error %q should contain %q", err.Error(), expected)
+		}
+	}
+}
+
+func TestCloneFields(t *testing.T) {
+	f, _ := Parse("team=payments")
+	clone := f.Clone()
+	clone.Add("env", "prod")
+	if f.Encode() != "team=payments" || clone.Encode() != "team=payments,env=prod" {
+		t.Errorf("clone should not share fields, got %s and %s", f.Encode(), clone.Encode())
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	metadata := Metadata{Category: strings.Repeat("c", maxCategoryLength+1), Name: "name\n"}
+	err := metadata.Validate()
+	if err == nil || !strings.Contains(err.Error(), CategoryHeader) || !strings.Contains(err.Error(), NameHeader) {
+		t.Errorf("Validate should report category and name errors, got %v", err)
+	}
+
+	f := NewFields()
+	f.Add("env", "prod")
+	metadata = Metadata{Host: "/aws/lambda/test", Fields: f}
+	if err := metadata.Validate(); err != nil {
+		t.Errorf("Validate should not generate error: %v", err)
+	}
+	header := http.Header{}
+	metadata.SetHeaders(header)
+	if header.Get(HostHeader) != "/aws/lambda/test" || header.Get(FieldsHeader) != "env=prod" {
+		t.Errorf("unexpected headers %v", header)
+	}
+	if _, found := header[CategoryHeader]; found {
+		t.Error("empty category should not be sent")
+	}
+}
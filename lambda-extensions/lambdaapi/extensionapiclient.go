@@ -41,8 +41,6 @@ const (
 	Invoke EventType = "INVOKE"
 	// Shutdown is a shutdown event for the environment
 	Shutdown EventType = "SHUTDOWN"
-	// Base URL for extension
-	extensionURL = "2020-01-01/extension/"
 )
 
 var (
@@ -52,9 +50,14 @@ var (
 // RegisterExtension is to register extension to Run Time API client. Call the following method on initialization as early as possible,
 // otherwise you may get a timeout error. Runtime initialization will start after all extensions are registered.
 func (client *Client) RegisterExtension(ctx context.Context) (*RegisterResponse, error) {
-	URL := client.baseURL + extensionURL + "register"
+	return client.RegisterExtensionForEvents(ctx, lambdaEvents)
+}
+
+// RegisterExtensionForEvents registers the extension for the given events only. An extension registered for
+// SHUTDOWN only is not woken up by the invocations, NextEvent then blocks until the environment shuts down.
+func (client *Client) RegisterExtensionForEvents(ctx context.Context, events []EventType) (*RegisterResponse, error) {
 	reqBody, err := json.Marshal(map[string]interface{}{
-		"events": lambdaEvents,
+		"events": events,
 	})
 	if err != nil {
 		return nil, err
@@ -62,13 +65,14 @@ func (client *Client) RegisterExtension(ctx context.Context) (*RegisterResponse,
 	headers := map[string]string{
 		extensionNameHeader: client.extensionName,
 	}
-	var response []byte
-	if ctx != nil {
-		response, err = client.MakeRequestWithContext(ctx, headers, bytes.NewBuffer(reqBody), "POST", URL)
-	} else {
-		response, err = client.MakeRequest(headers, bytes.NewBuffer(reqBody), "POST", URL)
-	}
-
+	// the version of the Extensions API is negotiated on registration, the first request of the extension
+	response, err := negotiate("Extensions", extensionAPIVersions, &client.extensionAPI, func(version APIVersion) ([]byte, error) {
+		URL := client.baseURL + version.path + "register"
+		if ctx != nil {
+			return client.MakeRequestWithContext(ctx, headers, bytes.NewBuffer(reqBody), "POST", URL)
+		}
+		return client.MakeRequest(headers, bytes.NewBuffer(reqBody), "POST", URL)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +87,7 @@ func (client *Client) RegisterExtension(ctx context.Context) (*RegisterResponse,
 // NextEvent is - Call the following method when the extension is ready to receive the next invocation
 // and there is no job it needs to execute beforehand. blocks while long polling for the next lambda invoke or shutdown
 func (client *Client) NextEvent(ctx context.Context) (*NextEventResponse, error) {
-	URL := client.baseURL + extensionURL + "event/next"
+	URL := client.baseURL + client.ExtensionAPIVersion().path + "event/next"
 
 	headers := map[string]string{
 		extensionIdentiferHeader: client.extensionID,
@@ -108,7 +112,7 @@ func (client *Client) NextEvent(ctx context.Context) (*NextEventResponse, error)
 
 // InitError reports an initialization error to the platform. Call it when you registered but failed to initialize
 func (client *Client) InitError(ctx context.Context, errorType string) (*StatusResponse, error) {
-	URL := client.baseURL + extensionURL + "/init/error"
+	URL := client.baseURL + client.ExtensionAPIVersion().path + "/init/error"
 
 	headers := map[string]string{
 		extensionIdentiferHeader: client.extensionID,
@@ -134,7 +138,7 @@ func (client *Client) InitError(ctx context.Context, errorType string) (*StatusR
 
 // ExitError reports an error to the platform before exiting. Call it when you encounter an unexpected failure
 func (client *Client) ExitError(ctx context.Context, errorType string) (*StatusResponse, error) {
-	URL := client.baseURL + extensionURL + "/exit/error"
+	URL := client.baseURL + client.ExtensionAPIVersion().path + "/exit/error"
 
 	headers := map[string]string{
 		extensionIdentiferHeader: client.extensionID,
@@ -125,3 +125,27 @@ func TestExitError(t *testing.T) {
 	response, err = client.ExitError(context.Background(), "EXIT ERROR")
 	commonAsserts(t, client, response, err)
 }
+
+func TestRegisterExtensionForEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody struct {
+			Events []EventType `json:"events"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&reqBody)
+		assertNoError(t, err, "Received error while reading request")
+		defer r.Body.Close()
+		assertEqual(t, len(reqBody.Events), 1, "Only one event should be registered")
+		assertEqual(t, reqBody.Events[0], Shutdown, "SHUTDOWN should be registered")
+
+		w.Header().Add(extensionIdentiferHeader, "test-sumo-id")
+		w.WriteHeader(200)
+		respBytes, _ := json.Marshal(RegisterResponse{})
+		_, _ = w.Write(respBytes)
+	}))
+
+	defer srv.Close()
+	client := NewClient(srv.URL[7:], extensionName)
+
+	response, err := client.RegisterExtensionForEvents(context.Background(), []EventType{Shutdown})
+	commonAsserts(t, client, response, err)
+}
@@ -20,6 +20,20 @@ type Client struct {
 	httpClient    *http.Client
 	extensionID   string
 	extensionName string
+	// extensionAPI and logsAPI are the versions negotiated with the runtime, nil until the first request
+	extensionAPI *APIVersion
+	logsAPI      *APIVersion
+}
+
+// StatusError is the error of a request the API answered with a status other than 200
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Request failed with status %s and response %s", e.Status, e.Body)
 }
 
 // NewClient returns a Lambda Extensions API client
@@ -55,7 +69,7 @@ func (client *Client) MakeRequestWithContext(ctx context.Context, headers map[st
 		return nil, err
 	}
 	if httpRes.StatusCode != 200 {
-		return nil, fmt.Errorf("Request failed with status %s and response %s", httpRes.Status, string(body))
+		return nil, &StatusError{StatusCode: httpRes.StatusCode, Status: httpRes.Status, Body: string(body)}
 	}
 	// Get the Extension ID from the headers
 	id := httpRes.Header.Get(extensionIdentiferHeader)
@@ -88,7 +102,7 @@ func (client *Client) MakeRequest(headers map[string]string, request *bytes.Buff
 		return nil, err
 	}
 	if httpRes.StatusCode != 200 {
-		return nil, fmt.Errorf("Request failed with status %s and response %s", httpRes.Status, string(body))
+		return nil, &StatusError{StatusCode: httpRes.StatusCode, Status: httpRes.Status, Body: string(body)}
 	}
 	// Get the Extension ID from the headers
 	id := httpRes.Header.Get(extensionIdentiferHeader)
@@ -97,3 +111,24 @@ func (client *Client) MakeRequest(headers map[string]string, request *bytes.Buff
 	}
 	return body, nil
 }
+
+// ExtensionID returns the identifier assigned to the extension on registration
+func (client *Client) ExtensionID() string {
+	return client.extensionID
+}
+
+// ExtensionAPIVersion returns the version of the Extensions API negotiated on registration
+func (client *Client) ExtensionAPIVersion() APIVersion {
+	if client.extensionAPI == nil {
+		return extensionAPIVersions[0]
+	}
+	return *client.extensionAPI
+}
+
+// LogsAPIVersion returns the version the logs were subscribed with, the first one tried before the subscription
+func (client *Client) LogsAPIVersion() APIVersion {
+	if client.logsAPI == nil {
+		return logsAPIVersions[0]
+	}
+	return *client.logsAPI
+}
@@ -75,7 +75,7 @@ func runMakeRequest(ctx context.Context, t *testing.T) ([]byte, *Client, error)
 
 	client := NewClient(server.URL[7:], extensionName)
 
-	URL := client.baseURL + extensionURL + "event/next"
+	URL := client.baseURL + client.ExtensionAPIVersion().path + "event/next"
 	headers := map[string]string{
 		extensionNameHeader: client.extensionName,
 	}
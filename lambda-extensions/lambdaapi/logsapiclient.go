@@ -8,8 +8,6 @@ import (
 )
 
 const (
-	// Base URL for extension
-	logsURL = "2020-08-15/logs"
 	// Subscription Body Constants. Subscribe to platform logs and receive them on ${local_ip}:4243 via HTTP protocol.
 	timeoutMs    = 1000
 	maxBytes     = 262144
@@ -17,30 +15,63 @@ const (
 	receiverPort = 4243
 )
 
-// SubscribeToLogsAPI is - Subscribe to Logs API to receive the Lambda Logs.
+// SubscribeToLogsAPI is - Subscribe to Logs API to receive the Lambda Logs. The first subscription negotiates
+// the version with the runtime, falling back to the newer versions of the Logs API and to the Telemetry API
+// when the runtime does not serve a version, and returns an *APIUnavailableError when it serves none.
 func (client *Client) SubscribeToLogsAPI(ctx context.Context, logEvents []string) ([]byte, error) {
-	URL := client.baseURL + logsURL
-
-	reqBody, err := json.Marshal(map[string]interface{}{
-		"destination": map[string]interface{}{"protocol": "HTTP", "URI": fmt.Sprintf("http://sandbox:%v", receiverPort)},
-		"types":       logEvents,
-		"buffering":   map[string]interface{}{"timeoutMs": timeoutMs, "maxBytes": maxBytes, "maxItems": maxItems},
-	})
-	if err != nil {
-		return nil, err
-	}
 	headers := map[string]string{
 		extensionIdentiferHeader: client.extensionID,
 	}
-	var response []byte
-	if ctx != nil {
-		response, err = client.MakeRequestWithContext(ctx, headers, bytes.NewBuffer(reqBody), "PUT", URL)
-	} else {
-		response, err = client.MakeRequest(headers, bytes.NewBuffer(reqBody), "PUT", URL)
+	return negotiate("Logs", logsAPIVersions, &client.logsAPI, func(version APIVersion) ([]byte, error) {
+		URL := client.baseURL + version.path
+		subscription := map[string]interface{}{
+			"destination": map[string]interface{}{"protocol": "HTTP", "URI": fmt.Sprintf("http://sandbox:%v", receiverPort)},
+			"types":       logEvents,
+			"buffering":   map[string]interface{}{"timeoutMs": timeoutMs, "maxBytes": maxBytes, "maxItems": maxItems},
+		}
+		// the schema of the records is chosen by the subscription since 2021-03-18
+		if version != logsAPIVersions[0] {
+			subscription["schemaVersion"] = version.Version
+		}
+		reqBody, err := json.Marshal(subscription)
+		if err != nil {
+			return nil, err
+		}
+		if ctx != nil {
+			return client.MakeRequestWithContext(ctx, headers, bytes.NewBuffer(reqBody), "PUT", URL)
+		}
+		return client.MakeRequest(headers, bytes.NewBuffer(reqBody), "PUT", URL)
+	})
+}
+
+// SubscribeToAvailableLogTypes subscribes to logEvents and, when the Logs API rejects the subscription, to the
+// types it accepts. A subscription replaces the previous one, so the types are tried one by one before the
+// accepted ones are subscribed together. It returns the subscribed types and the error of each rejected type,
+// or the *APIUnavailableError when the runtime serves no version of the API.
+func (client *Client) SubscribeToAvailableLogTypes(ctx context.Context, logEvents []string) ([]string, map[string]error, error) {
+	_, err := client.SubscribeToLogsAPI(ctx, logEvents)
+	if err == nil {
+		return logEvents, nil, nil
+	}
+	if _, unavailable := err.(*APIUnavailableError); unavailable || len(logEvents) == 0 {
+		return nil, nil, err
 	}
-	if err != nil {
-		return nil, err
+	if len(logEvents) == 1 {
+		return nil, map[string]error{logEvents[0]: err}, nil
 	}
-
-	return response, nil
+	var accepted []string
+	rejected := map[string]error{}
+	for _, logEvent := range logEvents {
+		if _, err := client.SubscribeToLogsAPI(ctx, []string{logEvent}); err != nil {
+			rejected[logEvent] = err
+		} else {
+			accepted = append(accepted, logEvent)
+		}
+	}
+	if len(accepted) > 1 {
+		if _, err := client.SubscribeToLogsAPI(ctx, accepted); err != nil {
+			return nil, rejected, err
+		}
+	}
+	return accepted, rejected, nil
 }
@@ -1,10 +1,12 @@
 package lambdaapi
 
 import (
+	"bytes"
 	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -33,3 +35,69 @@ func TestSubscribeToLogsAPI(t *testing.T) {
 	response, err = client.SubscribeToLogsAPI(context.Background(), []string{"platform", "function", "extension"})
 	commonAsserts(t, client, response, err)
 }
+
+func TestSubscribeToAvailableLogTypes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqBytes, err := ioutil.ReadAll(r.Body)
+		assertNoError(t, err, "Received error")
+		defer r.Body.Close()
+		if bytes.Contains(reqBytes, []byte(`"extension"`)) {
+			w.WriteHeader(400)
+			return
+		}
+		w.WriteHeader(200)
+	}))
+
+	defer srv.Close()
+	client := NewClient(srv.URL[7:], extensionName)
+
+	subscribed, rejected, err := client.SubscribeToAvailableLogTypes(context.Background(), []string{"platform", "function", "extension"})
+	assertNoError(t, err, "Received error")
+	assertEqual(t, strings.Join(subscribed, ","), "platform,function", "Accepted types are not subscribed")
+	assertEqual(t, len(rejected), 1, "Rejected type is not reported")
+	assertNotEmpty(t, rejected["extension"], "Rejected type has no error")
+}
+
+func TestSubscribeNegotiatesAPIVersion(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		reqBytes, err := ioutil.ReadAll(r.Body)
+		assertNoError(t, err, "Received error")
+		defer r.Body.Close()
+		if !strings.HasSuffix(r.URL.Path, "/telemetry") {
+			w.WriteHeader(404)
+			return
+		}
+		assertEqual(t, bytes.Contains(reqBytes, []byte(`"schemaVersion":"2022-07-01"`)), true, "Schema version is not sent")
+		w.WriteHeader(200)
+	}))
+
+	defer srv.Close()
+	client := NewClient(srv.URL[7:], extensionName)
+
+	_, err := client.SubscribeToLogsAPI(context.Background(), []string{"platform", "function"})
+	assertNoError(t, err, "Received error")
+	assertEqual(t, strings.Join(paths, ","), "/2020-08-15/logs,/2021-03-18/logs,/2022-07-01/telemetry", "Versions are not tried in order")
+	assertEqual(t, client.LogsAPIVersion().String(), "telemetry 2022-07-01", "Negotiated version is not kept")
+
+	paths = nil
+	_, err = client.SubscribeToLogsAPI(context.Background(), []string{"platform"})
+	assertNoError(t, err, "Received error")
+	assertEqual(t, strings.Join(paths, ","), "/2022-07-01/telemetry", "Negotiated version is not reused")
+}
+
+func TestSubscribeAPIUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+
+	defer srv.Close()
+	client := NewClient(srv.URL[7:], extensionName)
+
+	_, err := client.SubscribeToLogsAPI(context.Background(), []string{"platform"})
+	unavailable, ok := err.(*APIUnavailableError)
+	assertEqual(t, ok, true, "Unavailable API is not reported")
+	assertEqual(t, strings.Join(unavailable.Versions, ","), "2020-08-15,2021-03-18,2022-07-01", "Tried versions are not reported")
+	assertEqual(t, len(unavailable.Errors), 3, "Errors of the versions are not reported")
+}
@@ -0,0 +1,74 @@
+package lambdaapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIVersion is a version of the Extensions API or of the API the logs are subscribed with
+type APIVersion struct {
+	// API is extensions, logs or telemetry
+	API     string `json:"api"`
+	Version string `json:"version"`
+	path    string
+}
+
+func (v APIVersion) String() string {
+	return v.API + " " + v.Version
+}
+
+// extensionAPIVersions are the versions of the Extensions API tried in their order on registration
+var extensionAPIVersions = []APIVersion{
+	{API: "extensions", Version: "2020-01-01", path: "2020-01-01/extension/"},
+}
+
+// logsAPIVersions are the versions the logs are subscribed with tried in their order, the Telemetry API
+// replaces the Logs API and sends the platform, function and extension records in a compatible schema
+var logsAPIVersions = []APIVersion{
+	{API: "logs", Version: "2020-08-15", path: "2020-08-15/logs"},
+	{API: "logs", Version: "2021-03-18", path: "2021-03-18/logs"},
+	{API: "telemetry", Version: "2022-07-01", path: "2022-07-01/telemetry"},
+}
+
+// APIUnavailableError is returned when the runtime serves none of the versions of an API, with the error of
+// every version tried
+type APIUnavailableError struct {
+	API      string   `json:"api"`
+	Versions []string `json:"versions"`
+	Errors   []string `json:"errors"`
+}
+
+func (e *APIUnavailableError) Error() string {
+	return fmt.Sprintf("The %s API is unavailable, tried versions %s: %s", e.API, strings.Join(e.Versions, ", "), strings.Join(e.Errors, "; "))
+}
+
+// versionUnavailable tells whether err is the runtime not serving the version of an API, a request the
+// version rejects is not a reason to try another one
+func versionUnavailable(err error) bool {
+	statusErr, ok := err.(*StatusError)
+	return ok && (statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusMethodNotAllowed)
+}
+
+// negotiate sends request with the versions in their order until the runtime serves one, which is then
+// kept in negotiated so that the following requests use it. The version is kept once the runtime answers
+// the request, even with an error.
+func negotiate(api string, versions []APIVersion, negotiated **APIVersion, request func(APIVersion) ([]byte, error)) ([]byte, error) {
+	if *negotiated != nil {
+		return request(**negotiated)
+	}
+	unavailable := &APIUnavailableError{API: api}
+	for i := range versions {
+		response, err := request(versions[i])
+		if versionUnavailable(err) {
+			unavailable.Versions = append(unavailable.Versions, versions[i].Version)
+			unavailable.Errors = append(unavailable.Errors, err.Error())
+			continue
+		}
+		if _, isStatusErr := err.(*StatusError); err == nil || isStatusErr {
+			*negotiated = &versions[i]
+		}
+		return response, err
+	}
+	return nil, unavailable
+}
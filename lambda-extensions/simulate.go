@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/sumoclient"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/workers"
+
+	cfg "github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+)
+
+// simulatedCollector answers the posts of a simulated shutdown with status after latency, and counts the
+// batches it accepted. A request whose context is done before is failed as by the transport.
+type simulatedCollector struct {
+	latency       time.Duration
+	status        int
+	commitWebhook string
+	mu            sync.Mutex
+	accepted      int
+	acceptedBytes int
+	rejected      int
+}
+
+func (c *simulatedCollector) Do(request *http.Request) (*http.Response, error) {
+	body, _ := ioutil.ReadAll(request.Body)
+	request.Body.Close()
+	select {
+	case <-time.After(c.latency):
+	case <-request.Context().Done():
+		return nil, request.Context().Err()
+	}
+	response := &http.Response{StatusCode: c.status, Body: ioutil.NopCloser(strings.NewReader(""))}
+	// the commit webhook is notified of the batches accepted, it is not a batch of its own
+	if c.commitWebhook != "" && request.URL.String() == c.commitWebhook {
+		return response, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status == http.StatusOK {
+		c.accepted++
+		c.acceptedBytes += len(body)
+	} else {
+		c.rejected++
+	}
+	return response, nil
+}
+
+// simulatedBucket keeps the failover objects of a simulated shutdown in memory
+type simulatedBucket struct {
+	mu      sync.Mutex
+	objects map[string]int
+}
+
+func (b *simulatedBucket) Upload(bucketName, keyName string, data io.Reader) error {
+	body, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[keyName] = len(body)
+	return nil
+}
+
+func (b *simulatedBucket) Download(bucketName, keyName string) ([]byte, error) {
+	return nil, fmt.Errorf("%s is not part of the simulated bucket", keyName)
+}
+
+func (b *simulatedBucket) Delete(bucketName, keyName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.objects, keyName)
+	return nil
+}
+
+// loadSpillDir returns the payloads of the files of dir, oldest first, each file being a Logs API payload,
+// gzipped when its name ends with .gz. The modification time of a file is the time its payload was
+// enqueued, so that SUMO_SPILL_TTL_MIN expires the old ones as it would in the container. The files which
+// are not payloads are returned with their error.
+func loadSpillDir(dir string) ([]workers.QueueItem, map[string]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var items []workers.QueueItem
+	skipped := map[string]string{}
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		payload, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err == nil && strings.HasSuffix(file.Name(), ".gz") {
+			payload, err = utils.Decompress(payload)
+		}
+		if err == nil {
+			var records []json.RawMessage
+			err = json.Unmarshal(bytes.TrimSpace(payload), &records)
+		}
+		if err != nil {
+			skipped[file.Name()] = err.Error()
+			continue
+		}
+		items = append(items, workers.QueueItem{Payload: payload, EnqueuedAt: file.ModTime()})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].EnqueuedAt.Before(items[j].EnqueuedAt)
+	})
+	return items, skipped, nil
+}
+
+// simulateShutdown flushes the payloads of a spill directory as the SHUTDOWN event does, within the longest
+// shutdown phase, to a simulated collector and failover bucket, and prints what was flushed, persisted to the
+// failover bucket, dropped or left in the queue. It validates the drain settings, e.g. the concurrency and
+// the retries, before they reach production. It returns the exit code, 1 when payloads are lost.
+func simulateShutdown(dir string, latency time.Duration, status int) int {
+	// the logs of the pipeline go to stderr, the report to stdout
+	logger.Logger.SetOutput(os.Stderr)
+	config, err := cfg.GetConfig()
+	var configErrors []string
+	if err != nil {
+		configErrors = strings.Split(err.Error(), ", ")
+	}
+	logger.Logger.SetLevel(config.LogLevel)
+	items, skipped, err := loadSpillDir(dir)
+	if err != nil {
+		logger.Error("Unable to read the spill directory: ", err.Error())
+		return 1
+	}
+	var loadedBytes int
+	for _, item := range items {
+		loadedBytes += len(item.Payload)
+	}
+
+	// the queue holds every payload of the directory and the spill expired event, the payloads beyond the
+	// queue of the config are reported instead of blocking the simulation
+	queue := workers.NewChannelQueue(len(items) + 1)
+	for _, item := range items {
+		queue.Requeue(item)
+	}
+	collector := &simulatedCollector{latency: latency, status: status, commitWebhook: config.CommitWebhookURL}
+	bucket := &simulatedBucket{objects: map[string]int{}}
+	sender := sumoclient.NewCustomLogSenderClient(logger, config, collector, bucket)
+	simulated := workers.NewTaskConsumerWithSender(queue, config, logger, sender)
+
+	budget := maxShutdownDuration - shutdownDeadlineMargin
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), budget)
+	started := time.Now()
+	simulated.FlushDataQueue(flushCtx)
+	elapsed := time.Since(started)
+	cancelFlush()
+
+	var persistedBytes int
+	for _, size := range bucket.objects {
+		persistedBytes += size
+	}
+	counters := telemetry.Snapshot()
+	// the payloads expired by SUMO_SPILL_TTL_MIN are dropped on purpose
+	lost := counters[telemetry.PayloadsDropped] - counters[telemetry.PayloadsExpired] + int64(queue.Len())
+	fmt.Println(utils.PrettyPrint(map[string]interface{}{
+		"extensionName":    extensionName,
+		"configErrors":     configErrors,
+		"budget":           budget.String(),
+		"elapsed":          elapsed.String(),
+		"deadlineExceeded": elapsed > budget,
+		"loaded": map[string]interface{}{
+			"payloads":           len(items),
+			"bytes":              loadedBytes,
+			"skippedFiles":       skipped,
+			"exceedsQueueLength": config.RingBufferSize == 0 && len(items) > config.MaxDataQueueLength,
+		},
+		"flushed": map[string]interface{}{
+			"batches":     collector.accepted,
+			"bytes":       collector.acceptedBytes,
+			"failedPosts": collector.rejected,
+			"retries":     counters[telemetry.PostRetries],
+		},
+		"persisted": map[string]interface{}{
+			"enabled": config.EnableFailover,
+			"objects": len(bucket.objects),
+			"bytes":   persistedBytes,
+		},
+		"dropped": map[string]interface{}{
+			"payloads": counters[telemetry.PayloadsDropped],
+			"expired":  counters[telemetry.PayloadsExpired],
+		},
+		"leftInQueue": queue.Len(),
+	}))
+	if lost > 0 {
+		return 1
+	}
+	return 0
+}
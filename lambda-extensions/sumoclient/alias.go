@@ -0,0 +1,24 @@
+package sumoclient
+
+import (
+	"context"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+)
+
+// aliasKey is the context key of the alias whose endpoint a payload is posted to
+type aliasKey struct{}
+
+// WithAlias posts the payloads of ctx to the endpoint of alias in SUMO_ALIAS_ENDPOINT_MAP, the alias of the
+// invocation the payload was received during
+func WithAlias(ctx context.Context, alias string) context.Context {
+	return context.WithValue(ctx, aliasKey{}, alias)
+}
+
+// contextAlias returns the alias of WithAlias, the alias of the last invocation when not set
+func contextAlias(ctx context.Context) string {
+	if alias, ok := ctx.Value(aliasKey{}).(string); ok && alias != "" {
+		return alias
+	}
+	return config.InvokedQualifier()
+}
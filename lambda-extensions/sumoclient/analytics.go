@@ -0,0 +1,18 @@
+package sumoclient
+
+import (
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/analytics"
+)
+
+// observe accounts a shipped record of size bytes in the analytics summary
+func (s *sumoLogicClient) observe(item map[string]interface{}, size int) {
+	if !s.config.EnableAnalytics {
+		return
+	}
+	logType, _ := item["type"].(string)
+	var message string
+	if logType == "function" || logType == "extension" {
+		message, _ = item["message"].(string)
+	}
+	analytics.Observe(logType, message, size)
+}
@@ -0,0 +1,112 @@
+package sumoclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxBreakerCooldown bounds the cooldown, which doubles with every failed probe
+const maxBreakerCooldown = 5 * time.Minute
+
+// circuitBreaker stops posting after consecutive failed posts. It lives in the extension process so the
+// state carries over the invocations of the container: during a collector outage only one probe is sent
+// per cooldown instead of every invocation going through all the retries again, and the payloads go
+// straight to the failover. A nil circuitBreaker always allows posting.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	logger    *logrus.Entry
+	failures  int
+	// current is the cooldown after the last failure, it grows while the probes fail
+	current time.Duration
+	// openUntil is on the monotonic clock as it is only compared with time.Now
+	openUntil time.Time
+	probing   bool
+}
+
+// newCircuitBreaker returns a breaker opening after threshold failed posts in a row, nil when threshold is 0
+func newCircuitBreaker(threshold int, cooldown time.Duration, logger *logrus.Entry) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, current: cooldown, logger: logger}
+}
+
+// allow returns whether a post can be attempted and whether it is the single probe of an open breaker,
+// which is then sent without retries
+func (b *circuitBreaker) allow() (allowed bool, probe bool) {
+	if b == nil {
+		return true, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true, false
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// record accounts the outcome of a post allowed by allow
+func (b *circuitBreaker) record(probe bool, success bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if success {
+		if b.failures >= b.threshold {
+			b.logger.Info("Collector is reachable again, closing the circuit breaker")
+		}
+		b.failures = 0
+		b.current = b.cooldown
+		return
+	}
+	b.failures++
+	if b.failures < b.threshold {
+		return
+	}
+	if probe {
+		b.current *= 2
+		if b.current > maxBreakerCooldown {
+			b.current = maxBreakerCooldown
+		}
+	}
+	if probe || b.failures == b.threshold {
+		telemetry.Add(telemetry.BreakerOpens, 1)
+		b.logger.Warnf("Opening the circuit breaker for %v after %d failed posts", b.current, b.failures)
+	}
+	b.openUntil = time.Now().Add(b.current)
+}
+
+// release gives back a post allowed by allow which was not sent, so that the next post probes the collector
+func (b *circuitBreaker) release(probe bool) {
+	if b == nil || !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// closed returns true when the last post allowed by the breaker succeeded. A nil circuitBreaker has no state
+// to tell and is never closed.
+func (b *circuitBreaker) closed() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures == 0
+}
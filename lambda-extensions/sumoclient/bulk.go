@@ -0,0 +1,40 @@
+package sumoclient
+
+import (
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/fields"
+)
+
+// Keys of the source metadata carried by every line in the bulk output format
+const (
+	sourceCategoryKey = "_sourceCategory"
+	sourceHostKey     = "_sourceHost"
+	sourceNameKey     = "_sourceName"
+)
+
+// addLineMetadata sets the source metadata of a record in the bulk output format, where a single request
+// carries lines of several metadata combinations, e.g. the lines of a debug capture with their own category,
+// and the collector routes every line by its keys instead of the request headers.
+func (s *sumoLogicClient) addLineMetadata(item map[string]interface{}) {
+	metadata := fields.Metadata{
+		Category: s.config.SourceCategoryOverride,
+		Host:     s.sourceHost(),
+		Name:     s.sourceName(),
+	}
+	logType, _ := item["type"].(string)
+	if settings, found := s.config.TypeSettings(logType); found {
+		applyOutcomeMetadata(&metadata, settings.Metadata)
+	}
+	if debugCapture, _ := item["debugCapture"].(bool); debugCapture {
+		applyOutcomeMetadata(&metadata, s.config.OutcomeMetadata(config.OutcomeDebugCapture))
+	}
+	for key, value := range map[string]string{
+		sourceCategoryKey: metadata.Category,
+		sourceHostKey:     metadata.Host,
+		sourceNameKey:     metadata.Name,
+	} {
+		if value != "" {
+			item[key] = value
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package sumoclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// maxFailoverObjects bounds the failover objects remembered for catch-up
+const maxFailoverObjects = 1000
+
+// failoverObject is a payload written to the failover bucket by this extension, enqueuedAt is when it was
+// received so that it keeps its age once written and alias the alias whose endpoint it is replayed to
+type failoverObject struct {
+	key        string
+	size       int64
+	enqueuedAt time.Time
+	alias      string
+}
+
+// enqueuedAtKey is the context key of the time the payload posted was received at
+type enqueuedAtKey struct{}
+
+// WithEnqueuedAt sets when the payloads of ctx were received, the failover objects they are written to keep
+// their age for SpillTTL and CatchUpMaxAge
+func WithEnqueuedAt(ctx context.Context, enqueuedAt time.Time) context.Context {
+	return context.WithValue(ctx, enqueuedAtKey{}, enqueuedAt)
+}
+
+// contextEnqueuedAt returns the time of WithEnqueuedAt, now when not set
+func contextEnqueuedAt(ctx context.Context) time.Time {
+	if enqueuedAt, ok := ctx.Value(enqueuedAtKey{}).(time.Time); ok && !enqueuedAt.IsZero() {
+		return enqueuedAt
+	}
+	return time.Now()
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	io.Reader
+	count int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.Reader.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
+
+// recordFailoverObject remembers an object written to the failover bucket for a later catch-up
+func (s *sumoLogicClient) recordFailoverObject(ctx context.Context, key string, size int64) {
+	if !s.config.EnableCatchUp {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.failoverObjects) >= maxFailoverObjects {
+		return
+	}
+	s.failoverObjects = append(s.failoverObjects, failoverObject{key: key, size: size, enqueuedAt: contextEnqueuedAt(ctx), alias: contextAlias(ctx)})
+}
+
+// CatchUp re-ingests the failover objects written by this extension, oldest first, so that short collector
+// outages heal without the external replay. It stops at the first failure, as the collector is still unavailable.
+// Objects older than SpillTTL are deleted unsent, as the payloads spilled in the queue are, objects older than
+// CatchUpMaxAge are left for the external replay and at most CatchUpMaxBytes are sent per call.
+// Nothing is replayed until a live post succeeded or the circuit breaker closed after its failures.
+func (s *sumoLogicClient) CatchUp(ctx context.Context) error {
+	if !s.collectorRecovered() {
+		s.logger.Debug("CatchUp - Waiting for a successful post before replaying the failover objects")
+		return nil
+	}
+	s.mu.Lock()
+	pending := s.failoverObjects
+	s.failoverObjects = nil
+	s.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var err error
+	var sentBytes int64
+	var remaining []failoverObject
+	for i, obj := range pending {
+		if s.config.SpillTTL > 0 && utils.Since(obj.enqueuedAt) > s.config.SpillTTL {
+			s.expireFailoverObject(obj)
+			continue
+		}
+		if utils.Since(obj.enqueuedAt) > s.config.CatchUpMaxAge {
+			s.logger.Debugf("CatchUp - Leaving %s for replay as it is older than %v", obj.key, s.config.CatchUpMaxAge)
+			continue
+		}
+		if sentBytes > 0 && sentBytes+obj.size > s.config.CatchUpMaxBytes {
+			remaining = append(remaining, pending[i:]...)
+			break
+		}
+		err = s.replayFailoverObject(ctx, obj)
+		if errors.Is(err, errInvalidMetadata) {
+			// the collector is not at fault, the next objects are replayed
+			s.logger.Warnf("%v, leaving it for the external replay", err)
+			err = nil
+			continue
+		}
+		if err != nil {
+			remaining = append(remaining, pending[i:]...)
+			break
+		}
+		sentBytes += obj.size
+		telemetry.Add(telemetry.CatchUpObjects, 1)
+		telemetry.Add(telemetry.CatchUpBytes, obj.size)
+	}
+	s.logger.Debugf("CatchUp - Sent %d bytes, %d objects pending", sentBytes, len(remaining))
+
+	s.mu.Lock()
+	s.failoverObjects = append(remaining, s.failoverObjects...)
+	s.mu.Unlock()
+	return err
+}
+
+// expireFailoverObject deletes a failover object kept longer than SpillTTL, so that a long dormant container
+// does not flood the ingestion with days old records when it warms up
+func (s *sumoLogicClient) expireFailoverObject(obj failoverObject) {
+	telemetry.Add(telemetry.PayloadsDropped, 1)
+	telemetry.Add(telemetry.PayloadsExpired, 1)
+	s.logger.Warnf("CatchUp - Dropping %s of %d bytes kept %v, longer than %v", obj.key, obj.size, utils.Since(obj.enqueuedAt).Round(time.Second), s.config.SpillTTL)
+	if err := s.objectStore.Delete(s.config.S3BucketName, obj.key); err != nil {
+		s.logger.Warnf("CatchUp - Unable to delete expired object %s: %v", obj.key, err)
+	}
+}
+
+// recordLivePost remembers the outcome of the last live post, which tells catch-up whether the collector is back
+func (s *sumoLogicClient) recordLivePost(delivered bool) {
+	var value int32
+	if delivered {
+		value = 1
+	}
+	atomic.StoreInt32(&s.livePostDelivered, value)
+}
+
+// collectorRecovered returns true when the last live post was delivered or the circuit breaker is closed
+func (s *sumoLogicClient) collectorRecovered() bool {
+	return atomic.LoadInt32(&s.livePostDelivered) == 1 || s.breaker.closed()
+}
+
+func (s *sumoLogicClient) replayFailoverObject(ctx context.Context, obj failoverObject) error {
+	// failover objects are already gzipped in the format posted to Sumo, but the ones written uncompressed
+	// close to the shutdown deadline
+	data, err := s.objectStore.Download(s.config.S3BucketName, obj.key)
+	if err != nil {
+		return fmt.Errorf("CatchUp - Failed to download %s: %v", obj.key, err)
+	}
+	var payload []byte
+	var body io.Reader = bytes.NewReader(data)
+	if !strings.HasSuffix(obj.key, compressedExtension) {
+		payload = data
+		body = uncompressedBody{Reader: body}
+	} else if s.config.SigningKey != "" || s.config.CommitWebhookURL != "" {
+		// the signature and the commit describe the uncompressed payload, as for live batches
+		payload, err = utils.Decompress(data)
+		if err != nil {
+			return fmt.Errorf("CatchUp - Failed to decompress %s: %v", obj.key, err)
+		}
+	}
+	signature := s.sign(payload)
+	allowed, probe := s.breaker.allow()
+	if !allowed {
+		return fmt.Errorf("CatchUp - Not posting %s as the circuit breaker is open", obj.key)
+	}
+	response, err := s.makeRequest(WithAlias(ctx, obj.alias), body, signature, config.OutcomeCatchUp)
+	if response != nil {
+		response.Body.Close()
+	}
+	if errors.Is(err, errInvalidMetadata) {
+		s.breaker.release(probe)
+		return fmt.Errorf("CatchUp - Not posting %s: %w", obj.key, err)
+	}
+	// the object is only deleted once the collector accepted it, a 5xx keeps it for the next catch-up
+	delivered := isDelivered(err, response)
+	s.breaker.record(probe, delivered)
+	if !delivered {
+		if err == nil {
+			err = fmt.Errorf("statuscode %v", response.StatusCode)
+		}
+		return fmt.Errorf("CatchUp - Failed to post %s: %v", obj.key, err)
+	}
+	s.commitBatch(ctx, "catchUp", payload, signature, obj.key)
+	err = s.objectStore.Delete(s.config.S3BucketName, obj.key)
+	if err != nil {
+		// the logs are in Sumo already, a replay of the object would only duplicate them
+		s.logger.Warnf("CatchUp - Unable to delete replayed object %s: %v", obj.key, err)
+	}
+	return nil
+}
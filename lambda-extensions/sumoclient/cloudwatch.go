@@ -0,0 +1,40 @@
+package sumoclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+// createClassicLine renders the START, END and REPORT records in the text format written by Lambda to
+// CloudWatch Logs, so that the parsers and dashboards built on the CloudWatch lines keep working on the
+// lines sent by the extension. Records without a requestId are left as they are.
+func (s *sumoLogicClient) createClassicLine(item map[string]interface{}, logType string) {
+	record, ok := item["record"].(map[string]interface{})
+	if !ok || record["requestId"] == nil {
+		return
+	}
+	delete(item, "record")
+	switch logType {
+	case "platform.start":
+		version, ok := record["version"].(string)
+		if !ok {
+			version = s.config.FunctionVersion
+		}
+		item["message"] = fmt.Sprintf("START RequestId: %v Version: %s", record["requestId"], version)
+	case "platform.end":
+		item["message"] = fmt.Sprintf("END RequestId: %v", record["requestId"])
+	case "platform.report":
+		metrics, _ := record["metrics"].(map[string]interface{})
+		var line strings.Builder
+		fmt.Fprintf(&line, "REPORT RequestId: %v\t", record["requestId"])
+		fmt.Fprintf(&line, "Duration: %.2f ms\t", metrics["durationMs"])
+		fmt.Fprintf(&line, "Billed Duration: %.0f ms\t", metrics["billedDurationMs"])
+		fmt.Fprintf(&line, "Memory Size: %.0f MB\t", metrics["memorySizeMB"])
+		fmt.Fprintf(&line, "Max Memory Used: %.0f MB\t", metrics["maxMemoryUsedMB"])
+		// only the invocations of a cold start report the init duration
+		if initDuration, ok := metrics["initDurationMs"]; ok {
+			fmt.Fprintf(&line, "Init Duration: %.2f ms\t", initDuration)
+		}
+		item["message"] = line.String()
+	}
+}
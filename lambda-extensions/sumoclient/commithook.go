@@ -0,0 +1,84 @@
+package sumoclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+
+	uuid "github.com/google/uuid"
+)
+
+// commitHookTimeout bounds the time a delivered batch waits for the webhook
+const commitHookTimeout = 2 * time.Second
+
+// batchCommit is posted to the commit webhook for every batch delivered to Sumo Logic
+type batchCommit struct {
+	BatchID         string `json:"batchId"`
+	Source          string `json:"source"`
+	FunctionName    string `json:"functionName"`
+	FunctionVersion string `json:"functionVersion"`
+	LogStream       string `json:"logStream"`
+	RecordCount     int    `json:"recordCount"`
+	ByteCount       int    `json:"byteCount"`
+	Checksum        string `json:"checksum"`
+	Signature       string `json:"signature,omitempty"`
+	FailoverKey     string `json:"failoverKey,omitempty"`
+	DeliveredAt     string `json:"deliveredAt"`
+}
+
+// commitBatch notifies the CommitWebhookURL that a batch was delivered, so that external systems can reconcile
+// what reached Sumo Logic. source is "live" for the records just received and "catchUp" for replayed failover objects.
+// Webhook failures are only logged, the batch is delivered already.
+func (s *sumoLogicClient) commitBatch(ctx context.Context, source string, payload []byte, signature, failoverKey string) {
+	if s.config.CommitWebhookURL == "" {
+		return
+	}
+	batchID, err := uuid.NewUUID()
+	if err != nil {
+		s.logger.Error("Unable to create batch id: ", err.Error())
+		return
+	}
+	body, err := json.Marshal(batchCommit{
+		BatchID:         batchID.String(),
+		Source:          source,
+		FunctionName:    s.config.FunctionName,
+		FunctionVersion: s.config.FunctionVersion,
+		LogStream:       s.getLogStream(),
+		RecordCount:     strings.Count(strings.TrimSpace(string(payload)), "\n") + 1,
+		ByteCount:       len(payload),
+		Checksum:        fmt.Sprintf("crc32:%08x", crc32.ChecksumIEEE(payload)),
+		Signature:       signature,
+		FailoverKey:     failoverKey,
+		DeliveredAt:     time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		s.logger.Error("Unable to create batch commit: ", err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, commitHookTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, "POST", s.config.CommitWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		s.logger.Error("Unable to create commit webhook request: ", err.Error())
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := s.httpClient.Do(request)
+	if err == nil {
+		response.Body.Close()
+		if response.StatusCode >= 300 {
+			err = fmt.Errorf("statuscode %v", response.StatusCode)
+		}
+	}
+	if err != nil {
+		telemetry.Add(telemetry.CommitHookErrors, 1)
+		s.logger.Errorf("Commit webhook failed for batch %s: %v", batchID, err)
+	}
+}
@@ -0,0 +1,171 @@
+package sumoclient
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// dedupFileVersion is the first byte of the binary dedup file, followed by the raw hashes and the CRC-32
+	// of both. The version without the CRC and the text format of hex lines, which never starts with a
+	// version, are still read.
+	dedupFileVersion      byte = 2
+	dedupFileVersionNoCRC byte = 1
+	dedupHashSize              = sha256.Size
+	dedupChecksumSize          = crc32.Size
+)
+
+// dedupWindow remembers the hashes of the last batches posted, so that a batch replayed to the extension
+// after a crash and a restart is not sent twice. The hashes are persisted in /tmp, which outlives the
+// extension process within an execution environment. A nil dedupWindow remembers nothing.
+type dedupWindow struct {
+	mu     sync.Mutex
+	size   int
+	path   string
+	order  []string
+	hashes map[string]bool
+	logger *logrus.Entry
+}
+
+// newDedupWindow returns a window of size hashes persisted in path, nil when size is 0. Nothing is
+// persisted when path is empty.
+func newDedupWindow(size int, path string, logger *logrus.Entry) *dedupWindow {
+	if size <= 0 {
+		return nil
+	}
+	d := &dedupWindow{size: size, path: path, hashes: map[string]bool{}, logger: logger}
+	if path == "" {
+		return d
+	}
+	// the copy being written when the previous extension process crashed
+	if err := os.Remove(path + ".tmp"); err == nil {
+		logger.Infof("Removed the partially written %s.tmp", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warnf("Unable to read the sent batches of %s: %v", path, err)
+		}
+		return d
+	}
+	hashes, err := decodeDedupFile(data)
+	if err != nil {
+		// a corrupted window is dropped, the next batch posted writes a new one
+		logger.Warnf("Unable to read the sent batches of %s: %v", path, err)
+		os.Remove(path)
+		return d
+	}
+	for _, hash := range hashes {
+		d.remember(hash)
+	}
+	return d
+}
+
+// encodeDedupFile returns the hashes in the binary format, half the size of their hex encoding
+func encodeDedupFile(hashes []string) []byte {
+	data := make([]byte, 1, 1+len(hashes)*dedupHashSize+dedupChecksumSize)
+	data[0] = dedupFileVersion
+	for _, hash := range hashes {
+		raw, err := hex.DecodeString(hash)
+		if err != nil || len(raw) != dedupHashSize {
+			continue
+		}
+		data = append(data, raw...)
+	}
+	checksum := make([]byte, dedupChecksumSize)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(data))
+	return append(data, checksum...)
+}
+
+// decodeDedupFile returns the hashes of a dedup file in the binary formats or in the text format
+func decodeDedupFile(data []byte) ([]string, error) {
+	if len(data) == 0 || (data[0] != dedupFileVersion && data[0] != dedupFileVersionNoCRC) {
+		return strings.Fields(string(data)), nil
+	}
+	if data[0] == dedupFileVersion {
+		if len(data) < 1+dedupChecksumSize {
+			return nil, fmt.Errorf("truncated file of %d bytes", len(data))
+		}
+		end := len(data) - dedupChecksumSize
+		if crc32.ChecksumIEEE(data[:end]) != binary.BigEndian.Uint32(data[end:]) {
+			return nil, fmt.Errorf("checksum mismatch in file of %d bytes", len(data))
+		}
+		data = data[:end]
+	}
+	if (len(data)-1)%dedupHashSize != 0 {
+		return nil, fmt.Errorf("truncated file of %d bytes", len(data))
+	}
+	var hashes []string
+	for i := 1; i < len(data); i += dedupHashSize {
+		hashes = append(hashes, hex.EncodeToString(data[i:i+dedupHashSize]))
+	}
+	return hashes, nil
+}
+
+// batchHash returns the hash a batch is remembered by
+func batchHash(payload string) string {
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
+
+// sent tells whether the batch of hash was posted recently and moves it to the most recent end
+func (d *dedupWindow) sent(hash string) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.hashes[hash] {
+		return false
+	}
+	d.remember(hash)
+	return true
+}
+
+// add remembers the batch of hash as posted and persists the window
+func (d *dedupWindow) add(hash string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.remember(hash)
+	if d.path == "" {
+		return
+	}
+	// written aside and renamed so that a crash while writing does not lose the window
+	tmpPath := d.path + ".tmp"
+	err := ioutil.WriteFile(tmpPath, encodeDedupFile(d.order), 0600)
+	if err == nil {
+		err = os.Rename(tmpPath, d.path)
+	}
+	if err != nil {
+		d.logger.Warnf("Unable to persist the sent batches to %s: %v", d.path, err)
+	}
+}
+
+// remember moves hash to the most recent end and evicts the least recent one, d.mu has to be held
+func (d *dedupWindow) remember(hash string) {
+	if d.hashes[hash] {
+		for i, h := range d.order {
+			if h == hash {
+				d.order = append(d.order[:i], d.order[i+1:]...)
+				break
+			}
+		}
+	} else if len(d.order) >= d.size {
+		delete(d.hashes, d.order[0])
+		d.order = d.order[1:]
+	}
+	d.hashes[hash] = true
+	d.order = append(d.order, hash)
+}
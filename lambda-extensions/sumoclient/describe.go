@@ -0,0 +1,126 @@
+package sumoclient
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Stage is a step records go through before reaching Sumo Logic, with the settings resolved from the config
+type Stage struct {
+	Name     string                 `json:"name"`
+	Enabled  bool                   `json:"enabled"`
+	Settings map[string]interface{} `json:"settings,omitempty"`
+}
+
+// DescribePipeline returns the processors and the senders in the order records go through them
+func DescribePipeline(cfg *config.LambdaExtensionConfig) []Stage {
+	// the envelope is the one of the requests of the records without log type settings, before compression
+	client := &sumoLogicClient{config: cfg, logger: logrus.NewEntry(logrus.StandardLogger())}
+	recordsLimit, envelope := client.recordsLimit(""), client.envelopeSize("")
+	return []Stage{
+		{Name: "ownLogsFilter", Enabled: true, Settings: map[string]interface{}{
+			"excludeExtensionLogs": cfg.ExcludeExtensionLogs,
+		}},
+		{Name: "timestampOverride", Enabled: cfg.TimestampSource != "", Settings: map[string]interface{}{
+			"source": cfg.TimestampSource,
+		}},
+		{Name: "debugCapture", Enabled: cfg.EnableDebugCapture || cfg.DebugCaptureFile != "", Settings: map[string]interface{}{
+			"controlFile": cfg.DebugCaptureFile,
+			"duration":    cfg.DebugCaptureDuration.String(),
+			"active":      cfg.DebugCaptureActive(),
+		}},
+		{Name: "lineMetadata", Enabled: cfg.OutputFormat == config.OutputFormatBulk},
+		{Name: "errorFingerprint", Enabled: cfg.EnableErrorFingerprint},
+		{Name: "slowInvocationTag", Enabled: cfg.SlowInvocationTag, Settings: map[string]interface{}{
+			"minSamples": minLatencySamples,
+			"percentile": 99,
+		}},
+		{Name: "cloudWatchFormat", Enabled: cfg.CloudWatchFormat},
+		{Name: "fieldMapping", Enabled: cfg.FieldMappingPreset != "", Settings: map[string]interface{}{
+			"preset": cfg.FieldMappingPreset,
+		}},
+		{Name: "faultContext", Enabled: cfg.FaultContextLines > 0, Settings: map[string]interface{}{
+			"lines": cfg.FaultContextLines,
+		}},
+		{Name: "shipSchedule", Enabled: cfg.ShipSchedule != nil, Settings: map[string]interface{}{
+			"schedule": cfg.ShipSchedule.String(),
+			"verbose":  cfg.ShipVerbose(time.Now()),
+		}},
+		{Name: "secretScan", Enabled: cfg.SecretScan != "", Settings: map[string]interface{}{
+			"mode":      cfg.SecretScan,
+			"detectors": len(secretDetectors),
+		}},
+		{Name: "endOfStream", Enabled: cfg.EnableEndOfStream},
+		{Name: "heartbeat", Enabled: cfg.EnableHeartbeat, Settings: map[string]interface{}{
+			"interval": cfg.HeartbeatInterval.String(),
+		}},
+		{Name: "analytics", Enabled: cfg.EnableAnalytics},
+		{Name: "chunking", Enabled: true, Settings: map[string]interface{}{
+			"maxPayloadBytes":       cfg.MaxDataPayloadSize,
+			"maxPayloadBytesByType": cfg.PayloadSizeByType,
+			"sizeAccounting":        cfg.PayloadSizeAccounting,
+			"maxRecordsBytes":       recordsLimit,
+			"envelopeBytes":         envelope,
+			"maxRequestBytes":       recordsLimit + envelope,
+		}},
+		{Name: "compression", Enabled: true, Settings: map[string]interface{}{
+			"level":                   cfg.CompressionLevel,
+			"streamingThresholdBytes": cfg.StreamingThreshold,
+		}},
+		{Name: "signing", Enabled: cfg.SigningKey != ""},
+		{Name: "httpSender", Enabled: true, Settings: map[string]interface{}{
+			"endpointHost":        endpointHost(cfg.SumoHTTPEndpoint),
+			"aliasEndpoints":      len(cfg.AliasEndpoints),
+			"logTypeSettings":     len(cfg.LogTypeConfig),
+			"outputFormat":        cfg.OutputFormat,
+			"sourceCategory":      cfg.SourceCategoryOverride,
+			"sourceHost":          cfg.SourceHostOverride,
+			"sourceName":          cfg.SourceNameOverride,
+			"fields":              cfg.SumoFields.String(),
+			"fleetId":             cfg.FleetID,
+			"accountAlias":        cfg.AccountAlias,
+			"outcomeMetadata":     cfg.OutcomeMetadataMap,
+			"maxConcurrency":      cfg.MaxConcurrentRequests,
+			"numRetries":          cfg.NumRetry,
+			"numConnectionRetry":  cfg.NumConnectionRetries,
+			"retrySleep":          cfg.RetrySleepTime.String(),
+			"retryMaxElapsedTime": cfg.RetryMaxElapsedTime.String(),
+			"dialTimeout":         cfg.DialTimeout.String(),
+			"tlsHandshakeTimeout": cfg.TLSHandshakeTimeout.String(),
+			"responseTimeout":     cfg.ResponseTimeout.String(),
+			"requestTimeout":      cfg.RequestTimeout.String(),
+		}},
+		{Name: "endpointSelection", Enabled: len(cfg.EndpointCandidates) > 0, Settings: map[string]interface{}{
+			"candidates":    len(cfg.EndpointCandidates),
+			"weighted":      cfg.WeightedEndpoints(),
+			"probeInterval": cfg.EndpointProbeInterval.String(),
+		}},
+		{Name: "circuitBreaker", Enabled: cfg.BreakerThreshold > 0, Settings: map[string]interface{}{
+			"threshold": cfg.BreakerThreshold,
+			"cooldown":  cfg.BreakerCooldown.String(),
+		}},
+		{Name: "commitWebhook", Enabled: cfg.CommitWebhookURL != "", Settings: map[string]interface{}{
+			"host": endpointHost(cfg.CommitWebhookURL),
+		}},
+		{Name: "s3Failover", Enabled: cfg.EnableFailover, Settings: map[string]interface{}{
+			"bucket": cfg.S3BucketName,
+			"region": cfg.S3BucketRegion,
+		}},
+		{Name: "catchUp", Enabled: cfg.EnableFailover && cfg.EnableCatchUp, Settings: map[string]interface{}{
+			"maxAge":   cfg.CatchUpMaxAge.String(),
+			"maxBytes": cfg.CatchUpMaxBytes,
+		}},
+	}
+}
+
+// endpointHost returns the host of an endpoint, the path of the HTTP source urls being their credential
+func endpointHost(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil {
+		return u.Host
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package sumoclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// endOfStreamType is the type of the terminator record sent after the last record of an invocation
+	endOfStreamType = "extension.endOfStream"
+	// maxTrackedInvocations bounds the invocations whose platform.report has not been seen yet
+	maxTrackedInvocations = 100
+	// requestIDLength is the length of the uuid Lambda uses as request id
+	requestIDLength = 36
+	reportPrefix    = "REPORT RequestId: "
+)
+
+// invocationStats is what was shipped for one requestId
+type invocationStats struct {
+	records  int
+	bytes    int
+	checksum uint32
+}
+
+// endOfStreamTracker attributes shipped records to invocations and creates their terminator records
+type endOfStreamTracker struct {
+	mu          sync.Mutex
+	current     string
+	order       []string
+	invocations map[string]*invocationStats
+}
+
+func newEndOfStreamTracker() *endOfStreamTracker {
+	return &endOfStreamTracker{invocations: map[string]*invocationStats{}}
+}
+
+// track accounts the enhanced records of a payload and returns the terminator records of the invocations
+// whose platform.report is part of the payload. The checksum is the sum of the CRC32 of every shipped
+// json line, so it does not depend on the order in which the payloads were sent.
+func (t *endOfStreamTracker) track(msgArr responseBody) responseBody {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var markers responseBody
+	for _, item := range msgArr {
+		b, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+		requestID := t.requestID(item)
+		if requestID == "" {
+			continue
+		}
+		stats := t.stats(requestID)
+		stats.records++
+		stats.bytes += len(b)
+		stats.checksum += crc32.ChecksumIEEE(b)
+
+		if logType, _ := item["type"].(string); logType == "platform.report" {
+			markers = append(markers, map[string]interface{}{
+				"time": time.Now().UTC().Format(time.RFC3339Nano),
+				"type": endOfStreamType,
+				"record": map[string]interface{}{
+					"requestId":   requestID,
+					"recordCount": stats.records,
+					"byteCount":   stats.bytes,
+					"checksum":    fmt.Sprintf("crc32sum:%08x", stats.checksum),
+				},
+			})
+			t.remove(requestID)
+		}
+	}
+	return markers
+}
+
+// requestID returns the invocation a record belongs to, from the record itself when it carries the
+// request id and otherwise from the last platform.start seen.
+func (t *endOfStreamTracker) requestID(item map[string]interface{}) string {
+	if record, ok := item["record"].(map[string]interface{}); ok {
+		if requestID, ok := record["requestId"].(string); ok {
+			if logType, _ := item["type"].(string); logType == "platform.start" {
+				t.current = requestID
+			}
+			return requestID
+		}
+	}
+	if requestID, ok := item[requestIDKey].(string); ok {
+		return requestID
+	}
+	if message, ok := item["message"].(string); ok {
+		if requestID := messageRequestID(message); requestID != "" {
+			return requestID
+		}
+	}
+	return t.current
+}
+
+// messageRequestID returns the request id logged in a message or an empty string
+func messageRequestID(message string) string {
+	// platform.report records are converted to the CloudWatch REPORT line by enhanceLogs
+	if strings.HasPrefix(message, reportPrefix) && len(message) >= len(reportPrefix)+requestIDLength {
+		return message[len(reportPrefix) : len(reportPrefix)+requestIDLength]
+	}
+	// function logs of the managed runtimes are "timestamp\trequestId\tlevel\tmessage"
+	parts := strings.SplitN(message, "\t", 3)
+	if len(parts) == 3 && len(parts[1]) == requestIDLength {
+		return parts[1]
+	}
+	return ""
+}
+
+func (t *endOfStreamTracker) stats(requestID string) *invocationStats {
+	stats, found := t.invocations[requestID]
+	if !found {
+		if len(t.order) >= maxTrackedInvocations {
+			t.remove(t.order[0])
+		}
+		stats = &invocationStats{}
+		t.invocations[requestID] = stats
+		t.order = append(t.order, requestID)
+	}
+	return stats
+}
+
+func (t *endOfStreamTracker) remove(requestID string) {
+	delete(t.invocations, requestID)
+	for i, id := range t.order {
+		if id == requestID {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package sumoclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+)
+
+// Record is a record about to be posted, Item being its json object with the keys added by the extension
+type Record struct {
+	// Type is the log type of the record, e.g. function or platform.report
+	Type string
+	Item map[string]interface{}
+}
+
+// Enricher adds keys to a record or changes them from state the env vars can not carry, such as the tenant
+// or the feature flags of the application embedding the extension. An error leaves the record as it is.
+type Enricher func(ctx context.Context, record *Record) error
+
+// enrichers are the Enrichers registered by the code embedding the extension, run in their order
+var enrichers struct {
+	mu   sync.RWMutex
+	list []Enricher
+}
+
+// RegisterEnricher runs enricher on every record posted by the LogSenders, after the enrichment of the
+// extension. It can be called at any time, the records of the following payloads are enriched by it.
+func RegisterEnricher(enricher Enricher) {
+	enrichers.mu.Lock()
+	defer enrichers.mu.Unlock()
+	enrichers.list = append(enrichers.list, enricher)
+}
+
+// enrich runs the registered Enrichers on the records
+func (s *sumoLogicClient) enrich(ctx context.Context, msgArr responseBody) {
+	enrichers.mu.RLock()
+	list := enrichers.list
+	enrichers.mu.RUnlock()
+	if len(list) == 0 {
+		return
+	}
+	for _, item := range msgArr {
+		logType, _ := item["type"].(string)
+		record := &Record{Type: logType, Item: item}
+		for _, enricher := range list {
+			if err := runEnricher(ctx, enricher, record); err != nil {
+				telemetry.Add(telemetry.EnricherErrors, 1)
+				s.logger.Warn("Unable to enrich the record: ", err.Error())
+			}
+		}
+	}
+}
+
+// runEnricher turns a panic of enricher into an error, so that a faulty enricher does not stop the extension
+func runEnricher(ctx context.Context, enricher Enricher, record *Record) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("enricher panicked: %v", r)
+		}
+	}()
+	return enricher(ctx, record)
+}
@@ -0,0 +1,44 @@
+package sumoclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"strings"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+)
+
+// envelopeSize returns the bytes of the headers of a request posting the records of logType, the source
+// metadata and the fields of the usual batches included
+func (s *sumoLogicClient) envelopeSize(logType string) int {
+	header := http.Header{}
+	header.Add("Content-Encoding", "gzip")
+	header.Add("X-Sumo-Client", config.SumoLogicExtensionLayerVersionSuffix)
+	signature := ""
+	if s.config.SigningKey != "" {
+		// the signatures are hex encoded SHA-256 HMACs, all of the same length
+		signature = strings.Repeat("0", 2*sha256.Size)
+		header.Set(signatureHeader, signaturePrefix+signature)
+	}
+	metadata := s.sourceMetadata(withLogType(context.Background(), logType), signature, "")
+	metadata.SetHeaders(header)
+	var buf bytes.Buffer
+	header.Write(&buf)
+	return buf.Len()
+}
+
+// recordsLimit returns the bytes the records of a chunk of logType can take: the payload size, less the
+// envelope of the request when SUMO_PAYLOAD_SIZE_ACCOUNTING is request. The records keep at least half of
+// the payload size whatever the envelope.
+func (s *sumoLogicClient) recordsLimit(logType string) int {
+	maxSize := s.config.PayloadSize(logType)
+	if s.config.PayloadSizeAccounting != config.PayloadAccountingRequest {
+		return maxSize
+	}
+	if limit := maxSize - s.envelopeSize(logType); limit > maxSize/2 {
+		return limit
+	}
+	return maxSize / 2
+}
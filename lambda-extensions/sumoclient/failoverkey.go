@@ -0,0 +1,66 @@
+package sumoclient
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// metadata of the failover objects listing the invocations of their records
+	requestIDsMetadata   = "request-ids"
+	requestCountMetadata = "request-count"
+	// maxMetadataRequestIDs keeps the request ids within the 2 KB of user metadata of S3 objects
+	maxMetadataRequestIDs = 40
+)
+
+// payloadRequestIDPattern matches the request ids of the json lines of a payload, in the platform records and
+// the records of the JSON log format or in the tab separated prefix of the function lines
+var payloadRequestIDPattern = regexp.MustCompile(`"requestId": ?"([0-9a-f-]{36})"|\\t([0-9a-f-]{36})\\t`)
+
+// payloadRequestIDs returns the invocations a payload has records of, in the order they are first seen
+func payloadRequestIDs(payload string, requestIDs []string) []string {
+	for _, match := range payloadRequestIDPattern.FindAllStringSubmatch(payload, -1) {
+		requestID := match[1] + match[2]
+		found := false
+		for _, seen := range requestIDs {
+			if seen == requestID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			requestIDs = append(requestIDs, requestID)
+		}
+	}
+	return requestIDs
+}
+
+// requestIDsKeySegment returns the part of the failover key naming the invocations of the payload, the request
+// id or the first and last ones joined by _, so that the logs of an invocation can be found and replayed on
+// their own. It is empty when no record carries a request id.
+func requestIDsKeySegment(requestIDs []string) string {
+	switch len(requestIDs) {
+	case 0:
+		return ""
+	case 1:
+		return requestIDs[0]
+	}
+	return requestIDs[0] + "_" + requestIDs[len(requestIDs)-1]
+}
+
+// requestIDsMetadataValues returns the metadata of a failover object, its first maxMetadataRequestIDs
+// invocations and their count
+func requestIDsMetadataValues(requestIDs []string) map[string]string {
+	if len(requestIDs) == 0 {
+		return nil
+	}
+	listed := requestIDs
+	if len(listed) > maxMetadataRequestIDs {
+		listed = listed[:maxMetadataRequestIDs]
+	}
+	return map[string]string{
+		requestIDsMetadata:   strings.Join(listed, ","),
+		requestCountMetadata: strconv.Itoa(len(requestIDs)),
+	}
+}
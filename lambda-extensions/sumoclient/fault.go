@@ -0,0 +1,46 @@
+package sumoclient
+
+import "sync"
+
+// faultContextKey holds the function log lines preceding a platform.fault
+const faultContextKey = "functionContext"
+
+// recentLines keeps the last function log lines, which are attached to platform.fault records
+// as the context of the crash
+type recentLines struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func newRecentLines(size int) *recentLines {
+	return &recentLines{lines: make([]string, size)}
+}
+
+// add keeps line, nothing is kept when the size is 0
+func (r *recentLines) add(line string) {
+	if r == nil || len(r.lines) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns the lines oldest first
+func (r *recentLines) snapshot() []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]string{}, r.lines[:r.next]...)
+	}
+	return append(append([]string{}, r.lines[r.next:]...), r.lines[:r.next]...)
+}
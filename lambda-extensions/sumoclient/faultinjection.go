@@ -0,0 +1,129 @@
+//go:build faultinjection
+// +build faultinjection
+
+package sumoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// injectedFault is a fault of SUMO_FAULT_INJECTION returned instead of sending a share of the requests
+type injectedFault struct {
+	// kind is an HTTP status code, timeout or reset
+	kind        string
+	probability float64
+}
+
+// faultInjectingClient fails requests of the wrapped client with the faults of SUMO_FAULT_INJECTION, so that
+// the retries, the circuit breaker and the failover can be soak tested without a chaos proxy. The faults
+// are drawn from a generator seeded with SUMO_FAULT_INJECTION_SEED, a run is repeated with the same seed.
+type faultInjectingClient struct {
+	client HTTPClient
+	faults []injectedFault
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+// withFaultInjection wraps client with the faults of SUMO_FAULT_INJECTION, e.g. '429:0.2,timeout:0.05'
+// fails 20% of the requests with a 429 and times out 5% of them. It is only built with the faultinjection
+// tag, for testing.
+func withFaultInjection(client HTTPClient, logger *logrus.Entry) HTTPClient {
+	value := os.Getenv("SUMO_FAULT_INJECTION")
+	if value == "" {
+		return client
+	}
+	faults, err := parseFaultInjection(value)
+	if err != nil {
+		logger.Warnf("Unable to parse SUMO_FAULT_INJECTION: %v", err)
+		return client
+	}
+	seed := int64(1)
+	if value := os.Getenv("SUMO_FAULT_INJECTION_SEED"); value != "" {
+		if seed, err = strconv.ParseInt(value, 10, 64); err != nil {
+			logger.Warnf("Unable to parse SUMO_FAULT_INJECTION_SEED: %v", err)
+			return client
+		}
+	}
+	logger.Warnf("Injecting the faults of SUMO_FAULT_INJECTION %s with seed %d", value, seed)
+	return &faultInjectingClient{client: client, faults: faults, random: rand.New(rand.NewSource(seed))}
+}
+
+func parseFaultInjection(value string) ([]injectedFault, error) {
+	var faults []injectedFault
+	total := 0.0
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("entry %q is not in fault:probability format", entry)
+		}
+		kind := strings.TrimSpace(kv[0])
+		if status, err := strconv.Atoi(kind); (err != nil || status < 100 || status > 599) && kind != "timeout" && kind != "reset" {
+			return nil, fmt.Errorf("fault %s is neither an HTTP status code, timeout nor reset", kind)
+		}
+		probability, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || probability < 0 || probability > 1 {
+			return nil, fmt.Errorf("probability of fault %s has to be between 0 and 1", kind)
+		}
+		total += probability
+		faults = append(faults, injectedFault{kind: kind, probability: probability})
+	}
+	if total > 1 {
+		return nil, errors.New("probabilities add up to more than 1")
+	}
+	return faults, nil
+}
+
+// Do returns the fault drawn for the request, or sends it when none is drawn
+func (c *faultInjectingClient) Do(request *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	draw := c.random.Float64()
+	c.mu.Unlock()
+	for _, fault := range c.faults {
+		if draw >= fault.probability {
+			draw -= fault.probability
+			continue
+		}
+		if request.Body != nil {
+			request.Body.Close()
+		}
+		switch fault.kind {
+		case "timeout":
+			return nil, &url.Error{Op: request.Method, URL: request.URL.String(), Err: context.DeadlineExceeded}
+		case "reset":
+			return nil, &url.Error{Op: request.Method, URL: request.URL.String(), Err: syscall.ECONNRESET}
+		}
+		status, _ := strconv.Atoi(fault.kind)
+		return &http.Response{
+			StatusCode: status,
+			Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			Request:    request,
+		}, nil
+	}
+	return c.client.Do(request)
+}
+
+// CloseIdleConnections resets the pool of the wrapped client, as the connection resets of the sender do
+func (c *faultInjectingClient) CloseIdleConnections() {
+	if pool, ok := c.client.(interface{ CloseIdleConnections() }); ok {
+		pool.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !faultinjection
+// +build !faultinjection
+
+package sumoclient
+
+import "github.com/sirupsen/logrus"
+
+// withFaultInjection returns client as SUMO_FAULT_INJECTION is only honored in the builds with the
+// faultinjection tag
+func withFaultInjection(client HTTPClient, logger *logrus.Entry) HTTPClient {
+	return client
+}
@@ -0,0 +1,51 @@
+//go:build faultinjection
+// +build faultinjection
+
+package sumoclient
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestFaultInjection checks that the faults of SUMO_FAULT_INJECTION are injected in their share of the
+// requests and repeat with the seed.
+//
+//	go test -tags faultinjection -run TestFaultInjection ./lambda-extensions/sumoclient/
+func TestFaultInjection(t *testing.T) {
+	os.Setenv("SUMO_FAULT_INJECTION", "429:0.2,timeout:0.05,reset:0.05")
+	defer os.Unsetenv("SUMO_FAULT_INJECTION")
+	var logger = logrus.New().WithField("Name", "sumologic-extension")
+
+	outcomes := func() string {
+		httpClient := &fakeHTTPClient{statusCode: 200}
+		client := withFaultInjection(httpClient, logger)
+		var results []string
+		for i := 0; i < 200; i++ {
+			request, _ := http.NewRequest("POST", "http://localhost/receiver", strings.NewReader("line"))
+			response, err := client.Do(request)
+			switch {
+			case err != nil && isConnectionReset(err):
+				results = append(results, "reset")
+			case err != nil:
+				results = append(results, "timeout")
+			default:
+				results = append(results, http.StatusText(response.StatusCode))
+			}
+		}
+		assertEqual(t, httpClient.requests < 200 && httpClient.requests > 100, true, "a share of the requests should not be sent")
+		return strings.Join(results, ",")
+	}
+	first := outcomes()
+	assertEqual(t, strings.Contains(first, "reset") && strings.Contains(first, "timeout") && strings.Contains(first, http.StatusText(429)), true, "every fault should be injected")
+	assertEqual(t, outcomes(), first, "the faults of a seed should be the same on every run")
+
+	_, err := parseFaultInjection("429:0.7,500:0.5")
+	assertEqual(t, err != nil, true, "probabilities above 1 should not be accepted")
+	_, err = parseFaultInjection("slow:0.1")
+	assertEqual(t, err != nil, true, "unknown faults should not be accepted")
+}
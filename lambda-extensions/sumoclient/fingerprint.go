@@ -0,0 +1,97 @@
+package sumoclient
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxFingerprintFrames bounds the frames hashed, deep recursions would otherwise change the fingerprint
+	maxFingerprintFrames = 10
+	fingerprintLength    = 16
+)
+
+var (
+	// stack frames of the Python, Node.js and Java runtimes, line and column numbers are left out of the
+	// captured groups so that unrelated edits of a file keep the fingerprint
+	pythonFramePattern = regexp.MustCompile(`File "([^"]+)", line \d+, in (\S+)`)
+	nodeFramePattern   = regexp.MustCompile(`(?m)^\s*at (?:(\S+) \()?([^()\s]+?):\d+:\d+\)?\s*$`)
+	javaFramePattern   = regexp.MustCompile(`(?m)^\s*at ([\w$.<>]+)\(([^:)]+)(?::\d+)?\)\s*$`)
+	errorTypePattern   = regexp.MustCompile(`(?m)^(?:\[ERROR\]\s+|Exception in thread "[^"]*"\s+|Uncaught\s+)?([A-Za-z_$][\w.$]*(?:Error|Exception|Fault))\b`)
+)
+
+// lambdaError is the record written by the managed runtimes for an error returned by the handler
+type lambdaError struct {
+	ErrorType  string   `json:"errorType"`
+	StackTrace []string `json:"stackTrace"`
+}
+
+// addErrorFingerprint attaches to a log line containing an exception a hash of its type and normalized
+// stack frames, which is the same for every occurrence of the error so it can be grouped and alerted on.
+func addErrorFingerprint(item map[string]interface{}, message string) {
+	errorType, frames := parseException(message)
+	if len(frames) == 0 {
+		return
+	}
+	hash := sha1.Sum([]byte(errorType + "\n" + strings.Join(frames, "\n")))
+	item["errorFingerprint"] = hex.EncodeToString(hash[:])[:fingerprintLength]
+	if errorType != "" {
+		item["errorType"] = errorType
+	}
+}
+
+// parseException returns the exception type and the normalized frames found in a message
+func parseException(message string) (string, []string) {
+	var errorType string
+	stack := message
+	// errors returned by handlers are logged as json, possibly after the usual tab separated prefix
+	if start := strings.Index(message, "{"); start >= 0 && strings.Contains(message, `"stackTrace"`) {
+		var lambdaErr lambdaError
+		if json.Unmarshal([]byte(message[start:]), &lambdaErr) == nil {
+			errorType = lambdaErr.ErrorType
+			stack = strings.Join(lambdaErr.StackTrace, "\n")
+		}
+	}
+	if errorType == "" {
+		errorType = findErrorType(message)
+	}
+
+	var frames []string
+	for _, match := range pythonFramePattern.FindAllStringSubmatch(stack, -1) {
+		frames = appendFrame(frames, match[1]+":"+match[2])
+	}
+	for _, match := range nodeFramePattern.FindAllStringSubmatch(stack, -1) {
+		frames = appendFrame(frames, match[2]+":"+match[1])
+	}
+	for _, match := range javaFramePattern.FindAllStringSubmatch(stack, -1) {
+		frames = appendFrame(frames, match[2]+":"+match[1])
+	}
+	if len(frames) > maxFingerprintFrames {
+		frames = frames[:maxFingerprintFrames]
+	}
+	return errorType, frames
+}
+
+// findErrorType returns the exception named in the message. Python prints it after the frames, so the
+// last line is looked at first, while the Lambda runtime and the other languages print it first.
+func findErrorType(message string) string {
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	if match := errorTypePattern.FindStringSubmatch(strings.TrimSpace(lines[len(lines)-1])); match != nil {
+		return match[1]
+	}
+	if match := errorTypePattern.FindStringSubmatch(message); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// appendFrame skips the consecutive repetitions of a frame
+func appendFrame(frames []string, frame string) []string {
+	if len(frames) > 0 && frames[len(frames)-1] == frame {
+		return frames
+	}
+	return append(frames, frame)
+}
@@ -0,0 +1,87 @@
+package sumoclient
+
+import (
+	"math"
+	"sync"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+)
+
+const (
+	// slowInvocationKey and slowThresholdKey are the keys of the platform.report records of the invocations
+	// slower than the usual ones of the container
+	slowInvocationKey = "slowInvocation"
+	slowThresholdKey  = "slowInvocationThresholdMs"
+	// minLatencySamples is the number of invocations seen before any is tagged, a few warm invocations being
+	// no estimate of the tail
+	minLatencySamples = 30
+	// latencySmoothing is the weight of an invocation in the estimate once minLatencySamples are seen, the
+	// estimate following the last hundred invocations or so
+	latencySmoothing = 0.02
+	// p99Deviations is the number of standard deviations of the 99th percentile of a normal distribution
+	p99Deviations = 2.326
+)
+
+// latencyEstimate is a running estimate of the durations of the invocations of the container. The durations
+// of an invocation being skewed, the mean and the variance are the ones of their logarithm, so that their
+// 99th percentile is exp(mean + 2.326 deviations) as for a log-normal distribution. It costs two floats
+// whatever the number of invocations.
+type latencyEstimate struct {
+	mu       sync.Mutex
+	samples  int
+	mean     float64
+	variance float64
+}
+
+func newLatencyEstimate() *latencyEstimate {
+	return &latencyEstimate{}
+}
+
+// observe adds an invocation of durationMs to the estimate and returns the threshold it was compared to and
+// whether it is above it, an invocation is only compared once minLatencySamples were seen before it
+func (l *latencyEstimate) observe(durationMs float64) (float64, bool) {
+	if l == nil || durationMs <= 0 {
+		return 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var threshold float64
+	slow := false
+	value := math.Log(durationMs)
+	if l.samples >= minLatencySamples {
+		threshold = math.Exp(l.mean + p99Deviations*math.Sqrt(l.variance))
+		slow = durationMs > threshold
+	}
+	// the exact mean and variance of the first invocations, then an exponentially weighted one
+	l.samples++
+	weight := math.Max(1/float64(l.samples), latencySmoothing)
+	diff := value - l.mean
+	l.mean += weight * diff
+	l.variance = (1 - weight) * (l.variance + weight*diff*diff)
+	return threshold, slow
+}
+
+// tagSlowInvocation sets slowInvocation on the platform.report records of the invocations whose duration
+// is above the estimated 99th percentile of the container, before the estimate includes them, so that the
+// outliers can be filtered on without computing the percentiles in every query
+func (s *sumoLogicClient) tagSlowInvocation(item map[string]interface{}) {
+	record, ok := item["record"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	metrics, ok := record["metrics"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	durationMs, ok := metrics["durationMs"].(float64)
+	if !ok {
+		return
+	}
+	threshold, slow := s.latency.observe(durationMs)
+	if !slow {
+		return
+	}
+	telemetry.Add(telemetry.SlowInvocations, 1)
+	item[slowInvocationKey] = true
+	item[slowThresholdKey] = math.Round(threshold*100) / 100
+}
@@ -0,0 +1,63 @@
+package sumoclient
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// requestIDKey is the key of the request id of the function records in the JSON log format
+const requestIDKey = "requestId"
+
+// structuredRecord moves the values of a function record in the JSON log format of the runtime, e.g.
+// {"timestamp": "...", "level": "INFO", "requestId": "...", "message": "..."}, to the keys of the text
+// records and the normalized keys, and returns its message. The other keys, such as the errorType and
+// stackTrace of an error, stay in record.
+func structuredRecord(item map[string]interface{}, record map[string]interface{}) string {
+	var message string
+	switch typed := record["message"].(type) {
+	case string:
+		message = typed
+	case nil:
+	default:
+		// the loggers of the runtimes log objects as they are
+		if b, err := json.Marshal(typed); err == nil {
+			message = string(b)
+		}
+	}
+	if level, ok := record["level"].(string); ok {
+		item[normalizedLevelKey] = strings.ToLower(level)
+	}
+	if timestamp, found := record["timestamp"]; found {
+		item[normalizedTimestampKey] = timestamp
+	}
+	if requestID, _ := record[requestIDKey].(string); requestID != "" {
+		item[requestIDKey] = requestID
+	}
+	rest := map[string]interface{}{}
+	for key, value := range record {
+		switch key {
+		case "message", "level", "timestamp", requestIDKey:
+		default:
+			rest[key] = value
+		}
+	}
+	if len(rest) > 0 {
+		item["record"] = rest
+	} else {
+		delete(item, "record")
+	}
+	return message
+}
+
+// fingerprintText returns the text an error is fingerprinted from, the errorType and stackTrace of the
+// structured records are left in their record
+func fingerprintText(item map[string]interface{}, message string) string {
+	if rest, ok := item["record"].(map[string]interface{}); ok {
+		if _, found := rest["stackTrace"]; found {
+			if b, err := json.Marshal(rest); err == nil {
+				return string(b)
+			}
+		}
+	}
+	return message
+}
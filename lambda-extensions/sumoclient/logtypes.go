@@ -0,0 +1,53 @@
+package sumoclient
+
+import (
+	"context"
+	"strings"
+)
+
+// logTypeKey is the context key of the log type whose settings a batch is posted with
+type logTypeKey struct{}
+
+// logChunk is a chunk of json lines, logType is the log type of SUMO_LOG_TYPE_CONFIG whose settings the
+// chunk is posted with, empty for the global settings
+type logChunk struct {
+	payload string
+	logType string
+}
+
+// chunkKey identifies the chunks records can share, the ones of the same payload size limit and settings
+type chunkKey struct {
+	maxSize int
+	logType string
+}
+
+// withLogType posts the batches of ctx with the settings of SUMO_LOG_TYPE_CONFIG for logType
+func withLogType(ctx context.Context, logType string) context.Context {
+	if logType == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, logTypeKey{}, logType)
+}
+
+// contextLogType returns the log type of withLogType, empty for the global settings
+func contextLogType(ctx context.Context) string {
+	logType, _ := ctx.Value(logTypeKey{}).(string)
+	return logType
+}
+
+// settingsLogType returns the log type whose settings the records of logType are posted with, empty when
+// it has no settings of its own
+func (s *sumoLogicClient) settingsLogType(logType string) string {
+	if _, found := s.config.TypeSettings(logType); !found {
+		return ""
+	}
+	return strings.SplitN(logType, ".", 2)[0]
+}
+
+// typeEndpoint returns the endpoint of the log type of ctx, or the endpoint of the invocation
+func (s *sumoLogicClient) typeEndpoint(ctx context.Context) string {
+	if settings, _ := s.config.TypeSettings(contextLogType(ctx)); settings.Endpoint != "" {
+		return settings.Endpoint
+	}
+	return s.endpoint(ctx)
+}
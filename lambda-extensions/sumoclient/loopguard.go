@@ -0,0 +1,33 @@
+package sumoclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+)
+
+// ownLogMarker is part of every line written by the extension logger, which carries the Name field
+var ownLogMarker = fmt.Sprintf("Name=%s", config.ExtensionName)
+
+// filterOwnLogs drops the lines logged by this extension that the Logs API sends back as extension records.
+// Lines containing the marker more than once are shipped lines being logged again, those are always dropped
+// since every round trip would amplify them. All of them are dropped when ExcludeExtensionLogs is set,
+// unless a debug capture is running.
+func (s *sumoLogicClient) filterOwnLogs(msgArr responseBody) responseBody {
+	filtered := msgArr[:0]
+	for _, item := range msgArr {
+		logType, _ := item["type"].(string)
+		line, ok := item["record"].(string)
+		if ok && logType == "extension" {
+			markers := strings.Count(line, ownLogMarker)
+			if markers > 1 || (markers == 1 && s.config.ExcludeExtensionLogs && !s.config.DebugCaptureActive()) {
+				telemetry.Add(telemetry.OwnLogsDropped, 1)
+				continue
+			}
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered
+}
@@ -0,0 +1,83 @@
+package sumoclient
+
+import (
+	"sync"
+	"time"
+)
+
+// extensionOverheadKey is the key of the platform.report records holding the time the extension delayed
+// the end of the invocation by
+const extensionOverheadKey = "extensionOverheadMs"
+
+// overhead holds, by request id, when the runtime was done with an invocation and when the extension called
+// /event/next after it. The invocation only ends once every extension called /event/next.
+var overhead = struct {
+	mu          sync.Mutex
+	order       []string
+	runtimeDone map[string]time.Time
+	nextCalls   map[string]time.Time
+}{runtimeDone: map[string]time.Time{}, nextCalls: map[string]time.Time{}}
+
+// RecordNextCall records that the extension is done with the invocation of requestID and calls /event/next
+func RecordNextCall(requestID string, at time.Time) {
+	if requestID == "" {
+		return
+	}
+	overhead.mu.Lock()
+	defer overhead.mu.Unlock()
+	trackOverhead(requestID)
+	overhead.nextCalls[requestID] = at
+}
+
+// trackOverhead adds requestID to the tracked invocations and forgets the oldest one beyond
+// maxTrackedInvocations, overhead.mu has to be held
+func trackOverhead(requestID string) {
+	_, done := overhead.runtimeDone[requestID]
+	_, called := overhead.nextCalls[requestID]
+	if done || called {
+		return
+	}
+	overhead.order = append(overhead.order, requestID)
+	if len(overhead.order) > maxTrackedInvocations {
+		delete(overhead.runtimeDone, overhead.order[0])
+		delete(overhead.nextCalls, overhead.order[0])
+		overhead.order = overhead.order[1:]
+	}
+}
+
+// addExtensionOverhead records the time of the platform.runtimeDone records, and sets on the platform.report
+// record of an invocation, the last of its records, the time between the runtime being done and the
+// extension calling /event/next. It is 0 when the extension called it before the runtime was done.
+func addExtensionOverhead(item map[string]interface{}, logType string) {
+	record, ok := item["record"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	requestID, _ := record["requestId"].(string)
+	if requestID == "" {
+		return
+	}
+	overhead.mu.Lock()
+	defer overhead.mu.Unlock()
+	switch logType {
+	case "platform.runtimeDone":
+		recordTime, _ := item["time"].(string)
+		if done, err := time.Parse(time.RFC3339Nano, recordTime); err == nil {
+			trackOverhead(requestID)
+			overhead.runtimeDone[requestID] = done
+		}
+	case "platform.report":
+		done, found := overhead.runtimeDone[requestID]
+		called, calledFound := overhead.nextCalls[requestID]
+		if !found || !calledFound {
+			return
+		}
+		delay := called.Sub(done)
+		if delay < 0 {
+			delay = 0
+		}
+		item[extensionOverheadKey] = float64(delay.Microseconds()) / 1000
+		delete(overhead.runtimeDone, requestID)
+		delete(overhead.nextCalls, requestID)
+	}
+}
@@ -0,0 +1,48 @@
+package sumoclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+
+	uuid "github.com/google/uuid"
+)
+
+// Preflight posts an empty batch to the endpoint, which the collector accepts without ingesting anything, so
+// that a wrong endpoint is reported at init instead of once the logs of the invocations fail to be sent
+func Preflight(ctx context.Context, cfg *config.LambdaExtensionConfig) error {
+	endpoint := cfg.Endpoint()
+	request, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(""))
+	if err != nil {
+		return fmt.Errorf("http.NewRequest() error: %v", err)
+	}
+	request.Header.Add("X-Sumo-Client", config.SumoLogicExtensionLayerVersionSuffix)
+	response, err := newHTTPClient(cfg).Do(request)
+	if err != nil {
+		return fmt.Errorf("Unable to reach the endpoint %s: %v", endpointHost(endpoint), err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("the endpoint %s answered %s", endpointHost(endpoint), response.Status)
+	}
+	return nil
+}
+
+// ProbeFailoverBucket writes and removes an empty object in the failover bucket, so that a wrong bucket name,
+// region or permission is reported at init instead of once the collector is down and the payloads are lost.
+// The probe object is outside of the prefix of the payloads, the replays do not pick it up.
+func ProbeFailoverBucket(ctx context.Context, cfg *config.LambdaExtensionConfig, store utils.ObjectStore) error {
+	prober, ok := store.(utils.BucketProber)
+	if !ok {
+		return nil
+	}
+	uniqueID, err := uuid.NewUUID()
+	if err != nil {
+		return err
+	}
+	return prober.ProbeBucket(ctx, cfg.S3BucketName, fmt.Sprintf("%s-probe/%s/%v", config.ExtensionName, cfg.FunctionName, uniqueID))
+}
@@ -0,0 +1,52 @@
+package sumoclient
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+)
+
+// Keys of the normalized values, the line itself stays in message
+const (
+	normalizedLevelKey     = "logLevel"
+	normalizedTimestampKey = "logTimestamp"
+	normalizedMessageKey   = "logMessage"
+)
+
+// numericLevels are the bunyan and pino levels
+var numericLevels = map[float64]string{10: "trace", 20: "debug", 30: "info", 40: "warn", 50: "error", 60: "fatal"}
+
+// normalizeFields copies the level, timestamp and message of a json log line written with the framework
+// of the preset to the same keys for every framework, so queries do not depend on the framework used.
+func normalizeFields(item map[string]interface{}, message string, mapping config.FieldMapping) {
+	// console.log lines of the managed runtimes are prefixed with "timestamp\trequestId\tlevel\t"
+	if i := strings.LastIndex(message, "\t"); i >= 0 {
+		message = message[i+1:]
+	}
+	message = strings.TrimSpace(message)
+	if !strings.HasPrefix(message, "{") {
+		return
+	}
+	var line map[string]interface{}
+	if json.Unmarshal([]byte(message), &line) != nil {
+		return
+	}
+	if level, found := line[mapping.Level]; found {
+		if number, ok := level.(float64); ok && mapping.NumericLevels {
+			if name, ok := numericLevels[number]; ok {
+				level = name
+			}
+		}
+		if name, ok := level.(string); ok {
+			level = strings.ToLower(name)
+		}
+		item[normalizedLevelKey] = level
+	}
+	if timestamp, found := line[mapping.Timestamp]; found {
+		item[normalizedTimestampKey] = timestamp
+	}
+	if msg, found := line[mapping.Message]; found {
+		item[normalizedMessageKey] = msg
+	}
+}
@@ -0,0 +1,122 @@
+package sumoclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+)
+
+// maxConsecutiveResets is the number of connection resets in a row after which idle connections are dropped
+const maxConsecutiveResets = 2
+
+// errInvalidMetadata is returned by makeRequest when the source metadata of a batch would be rejected, the
+// request is not sent and is not retried as it would be built the same way again
+var errInvalidMetadata = errors.New("invalid source metadata")
+
+// retryBudget keeps separate retry counts for transport failures and HTTP error responses
+type retryBudget struct {
+	httpRetriesLeft      int
+	transportRetriesLeft int
+	consecutiveResets    int
+}
+
+func (s *sumoLogicClient) newRetryBudget() *retryBudget {
+	return &retryBudget{
+		httpRetriesLeft:      s.config.NumRetry,
+		transportRetriesLeft: s.config.NumConnectionRetries,
+	}
+}
+
+// withRetryDeadline bounds the attempts of a post, the first one included, by SUMO_RETRY_MAX_ELAPSED_TIME_MS,
+// so that the retries of a flush at SHUTDOWN do not outlast its 2 seconds whatever the number of attempts
+func (s *sumoLogicClient) withRetryDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config.RetryMaxElapsedTime <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.config.RetryMaxElapsedTime)
+}
+
+// retryTimeLeft tells whether another attempt can start after the retry sleep before the deadline of ctx,
+// the one of SUMO_RETRY_MAX_ELAPSED_TIME_MS or the one of the caller
+func (s *sumoLogicClient) retryTimeLeft(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > s.config.RetrySleepTime
+}
+
+// isFailedResponse returns true for transport errors and for the responses of a collector which did not
+// accept the payload, 5xx included, so that they are retried and then failed over
+func isFailedResponse(err error, response *http.Response) bool {
+	return !isDelivered(err, response)
+}
+
+// isDelivered returns true when the collector accepted the request, a 2xx or a 302 response
+func isDelivered(err error, response *http.Response) bool {
+	if err != nil {
+		return false
+	}
+	return (response.StatusCode >= 200 && response.StatusCode < 300) || response.StatusCode == 302
+}
+
+// unauthorizedRefetchInterval bounds the fetches of the endpoint secret on 401 responses
+const unauthorizedRefetchInterval = 30 * time.Second
+
+// refetchEndpoint fetches the endpoint secret again on a 401 response, which the collector returns once the
+// token of the endpoint was rotated, so that the next attempts post to the new endpoint
+func (s *sumoLogicClient) refetchEndpoint(response *http.Response) {
+	if response == nil || response.StatusCode != http.StatusUnauthorized {
+		return
+	}
+	changed, err := s.config.RefreshEndpointSecret(unauthorizedRefetchInterval)
+	if err != nil {
+		s.logger.Error("Unable to fetch the endpoint after a 401 response: ", err.Error())
+		return
+	}
+	if changed {
+		telemetry.Add(telemetry.EndpointRotated, 1)
+		s.logger.Info("Fetched a rotated endpoint after a 401 response")
+	}
+}
+
+// isConnectionReset returns true for stale or reset connections, typical after the environment thaws
+func isConnectionReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// trackConnectionReset counts connection resets in a row and drops the pooled connections on repeated resets
+// so that the next attempt dials a fresh connection instead of reusing another stale one.
+func (s *sumoLogicClient) trackConnectionReset(budget *retryBudget, err error) {
+	if err == nil || !isConnectionReset(err) {
+		budget.consecutiveResets = 0
+		return
+	}
+	budget.consecutiveResets++
+	if budget.consecutiveResets >= maxConsecutiveResets {
+		s.logger.Debugf("Resetting connection pool after %d connection resets", budget.consecutiveResets)
+		// the pool can only be reset when the client exposes it, as *http.Client does
+		if pool, ok := s.httpClient.(interface{ CloseIdleConnections() }); ok {
+			pool.CloseIdleConnections()
+		}
+		budget.consecutiveResets = 0
+	}
+}
+
+// consumeRetry charges a failed attempt to the budget of its class and returns whether another attempt is allowed.
+// err is nil when the request reached the collector and failed with an HTTP status.
+func (s *sumoLogicClient) consumeRetry(budget *retryBudget, err error) bool {
+	if errors.Is(err, errInvalidMetadata) {
+		return false
+	}
+	s.trackConnectionReset(budget, err)
+	if err != nil {
+		budget.transportRetriesLeft--
+		return budget.transportRetriesLeft >= 0
+	}
+	budget.httpRetriesLeft--
+	return budget.httpRetriesLeft >= 0
+}
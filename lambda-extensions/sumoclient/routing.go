@@ -0,0 +1,27 @@
+package sumoclient
+
+import (
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/fields"
+)
+
+// liveOutcome returns the outcome of the batches of the records received from the Logs API
+func (s *sumoLogicClient) liveOutcome() string {
+	if s.config.DebugCaptureActive() {
+		return config.OutcomeDebugCapture
+	}
+	return ""
+}
+
+// applyOutcomeMetadata overrides the category, host and name set for the outcome, the fields are kept
+func applyOutcomeMetadata(metadata *fields.Metadata, override fields.Metadata) {
+	if override.Category != "" {
+		metadata.Category = override.Category
+	}
+	if override.Host != "" {
+		metadata.Host = override.Host
+	}
+	if override.Name != "" {
+		metadata.Name = override.Name
+	}
+}
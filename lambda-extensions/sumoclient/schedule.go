@@ -0,0 +1,47 @@
+package sumoclient
+
+import (
+	"strings"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+)
+
+// errorLevels are the values of logLevel of the error records
+var errorLevels = map[string]bool{"error": true, "fatal": true, "critical": true}
+
+// filterSchedule drops the function and extension records which are not errors outside of the windows of
+// SUMO_SHIP_SCHEDULE, the platform records are always kept as the metrics are built from them. It runs
+// after enhanceLogs, which sets the levels of the structured lines. Nothing is dropped while a debug
+// capture is running.
+func (s *sumoLogicClient) filterSchedule(msgArr responseBody) responseBody {
+	if s.config.ShipVerbose(time.Now()) || s.config.DebugCaptureActive() {
+		return msgArr
+	}
+	filtered := msgArr[:0]
+	for _, item := range msgArr {
+		logType, _ := item["type"].(string)
+		if (logType == "function" || logType == "extension") && !isErrorRecord(item) {
+			telemetry.Add(telemetry.ScheduleDropped, 1)
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered
+}
+
+// isErrorRecord tells whether a function or extension record has an error level, either a structured one
+// or the level field of the lines of the managed runtimes, or contains an exception
+func isErrorRecord(item map[string]interface{}) bool {
+	if level, ok := item[normalizedLevelKey].(string); ok && errorLevels[strings.ToLower(level)] {
+		return true
+	}
+	message, ok := item["message"].(string)
+	if !ok {
+		message, _ = item["record"].(string)
+	}
+	if strings.Contains(message, "\tERROR\t") || strings.Contains(message, "\tFATAL\t") || strings.Contains(message, "[ERROR]") {
+		return true
+	}
+	return findErrorType(message) != ""
+}
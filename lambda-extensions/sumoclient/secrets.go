@@ -0,0 +1,174 @@
+package sumoclient
+
+import (
+	"math"
+	"regexp"
+	"unicode"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// securityEventKey is the key of the records in which credentials were detected
+const securityEventKey = "securityEvent"
+
+// secretDetector finds a kind of credential. The credential is the first group of pattern when it has one,
+// e.g. the value of a password= assignment, else the whole match. It has to be at least minEntropy bits per
+// character and, with mixedClasses, to mix two classes of characters, so that placeholders and words are not
+// taken for credentials.
+type secretDetector struct {
+	name         string
+	pattern      *regexp.Regexp
+	minEntropy   float64
+	mixedClasses bool
+}
+
+// secretDetectors are run in their order on the redacted text, the high entropy strings last so that the
+// credentials of a known format are named after it
+var secretDetectors = []secretDetector{
+	{name: "awsAccessKeyId", pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{name: "privateKey", pattern: regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED )?PRIVATE KEY-----`)},
+	{name: "sumoCollectorURL", pattern: regexp.MustCompile(`https://[a-z0-9.-]*sumologic\.(?:com|net)/receiver/v1/[a-z]+/([A-Za-z0-9=_-]{20,})`)},
+	{name: "githubToken", pattern: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{name: "slackToken", pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{name: "stripeKey", pattern: regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{24,}\b`)},
+	{name: "jwt", pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{name: "bearerToken", pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{20,}=*)`), minEntropy: 3},
+	{name: "credentialAssignment", pattern: regexp.MustCompile(`(?i)(?:password|passwd|pwd|secret|token|api_?key|access_?key|client_?secret)["']?\s*[:=]\s*["']?([^\s"',;&]{8,})`), minEntropy: 3, mixedClasses: true},
+	{name: "highEntropyString", pattern: regexp.MustCompile(`[A-Za-z0-9+/_-]{32,}={0,2}`), minEntropy: 4.5},
+}
+
+// scanSecrets looks for credentials in the function and extension records, the platform records only carry
+// metrics. A record with credentials gets a security event listing the detectors which matched, and the
+// credentials are replaced by [REDACTED:detector] in the redact mode of SUMO_SECRET_SCAN. It runs after
+// enhanceLogs, which moves the function lines to message.
+func (s *sumoLogicClient) scanSecrets(msgArr responseBody) {
+	if s.config.SecretScan == "" {
+		return
+	}
+	redact := s.config.SecretScan == config.SecretScanRedact
+	for _, item := range msgArr {
+		logType, _ := item["type"].(string)
+		if logType != "function" && logType != "extension" {
+			continue
+		}
+		var detected []string
+		for _, key := range []string{"message", "record"} {
+			if value, found := item[key]; found {
+				var redacted interface{}
+				redacted, detected = scanValue(value, detected)
+				if redact {
+					item[key] = redacted
+				}
+			}
+		}
+		if len(detected) == 0 {
+			continue
+		}
+		telemetry.Add(telemetry.SecretsDetected, 1)
+		action := "flagged"
+		if redact {
+			action = "redacted"
+		}
+		item[securityEventKey] = map[string]interface{}{
+			"type":      "secretDetected",
+			"detectors": detected,
+			"action":    action,
+		}
+	}
+}
+
+// scanValue returns value with the credentials of its strings redacted, the records of the JSON log format
+// being objects, and appends the detectors which matched to detected
+func scanValue(value interface{}, detected []string) (interface{}, []string) {
+	switch typed := value.(type) {
+	case string:
+		return scanText(typed, detected)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(typed))
+		for key, field := range typed {
+			redacted[key], detected = scanValue(field, detected)
+		}
+		return redacted, detected
+	case []interface{}:
+		redacted := make([]interface{}, len(typed))
+		for i, element := range typed {
+			redacted[i], detected = scanValue(element, detected)
+		}
+		return redacted, detected
+	}
+	return value, detected
+}
+
+// scanText returns text with the credentials redacted and appends the detectors which matched to detected
+func scanText(text string, detected []string) (string, []string) {
+	for _, detector := range secretDetectors {
+		matches := detector.pattern.FindAllStringSubmatchIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		redacted, last, found := make([]byte, 0, len(text)), 0, false
+		for _, match := range matches {
+			start, end := match[0], match[1]
+			if len(match) > 2 && match[2] >= 0 {
+				start, end = match[2], match[3]
+			}
+			if detector.minEntropy > 0 && shannonEntropy(text[start:end]) < detector.minEntropy {
+				continue
+			}
+			if detector.mixedClasses && characterClasses(text[start:end]) < 2 {
+				continue
+			}
+			redacted = append(redacted, text[last:start]...)
+			redacted = append(redacted, "[REDACTED:"+detector.name+"]"...)
+			last, found = end, true
+		}
+		if !found {
+			continue
+		}
+		text = string(append(redacted, text[last:]...))
+		if !utils.StringInSlice(detector.name, detected) {
+			detected = append(detected, detector.name)
+		}
+	}
+	return text, detected
+}
+
+// shannonEntropy returns the bits per character of s, a random base64 string of 32 characters is close to 5
+// and words are below 3
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := map[rune]int{}
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// characterClasses returns how many of lowercase letters, uppercase letters, digits and symbols s contains
+func characterClasses(s string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
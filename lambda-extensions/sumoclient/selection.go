@@ -0,0 +1,208 @@
+package sumoclient
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// latencyWeight is the weight of the last measure in the moving average of the latency of an endpoint
+	latencyWeight = 0.3
+	// switchMargin is how much faster than the current endpoint another one has to be to be switched to, so
+	// that endpoints of similar latencies do not flap
+	switchMargin = 0.2
+)
+
+// endpointSelector posts to the fastest healthy endpoint of equivalent ones, e.g. of the same source in
+// several Sumo deployments, or spreads the batches across them by weight when weighted. The health and
+// the latencies are measured on the posts and by probing all the endpoints every probeInterval. A nil
+// endpointSelector posts to the configured endpoint.
+type endpointSelector struct {
+	mu            sync.Mutex
+	endpoints     []string
+	latencies     map[string]time.Duration
+	healthy       map[string]bool
+	current       string
+	probeInterval time.Duration
+	lastProbe     time.Time
+	probing       bool
+	logger        *logrus.Entry
+
+	weighted   bool
+	weights    map[string]int
+	priorities map[string]int
+	// credits are the smooth weighted round robin state, the endpoint of most credits is posted to next
+	credits  map[string]int
+	priority int
+}
+
+// newEndpointSelector returns a selector across the primary endpoint and the candidates, nil when there is
+// only one endpoint. The primary endpoint has a weight of 1 and the priority 0 unless it is listed in the
+// candidates.
+func newEndpointSelector(primary string, candidates []config.EndpointCandidate, probeInterval time.Duration, logger *logrus.Entry) *endpointSelector {
+	e := &endpointSelector{
+		latencies:     map[string]time.Duration{},
+		healthy:       map[string]bool{},
+		probeInterval: probeInterval,
+		logger:        logger,
+		weights:       map[string]int{},
+		priorities:    map[string]int{},
+		credits:       map[string]int{},
+	}
+	for _, candidate := range append([]config.EndpointCandidate{{URL: primary}}, candidates...) {
+		if candidate.URL == "" {
+			continue
+		}
+		if _, seen := e.healthy[candidate.URL]; !seen {
+			e.endpoints = append(e.endpoints, candidate.URL)
+			e.healthy[candidate.URL] = true
+		}
+		e.weights[candidate.URL] = candidate.Weight
+		if candidate.Weight == 0 {
+			e.weights[candidate.URL] = 1
+		}
+		e.priorities[candidate.URL] = candidate.Priority
+		e.weighted = e.weighted || candidate.Weight != 0 || candidate.Priority != 0
+	}
+	if len(e.endpoints) < 2 {
+		return nil
+	}
+	e.current = e.endpoints[0]
+	return e
+}
+
+// endpoint returns the endpoint to post to
+func (e *endpointSelector) endpoint() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.weighted {
+		return e.nextWeighted()
+	}
+	return e.current
+}
+
+// nextWeighted returns the next endpoint of the lowest priority with a healthy endpoint by smooth weighted
+// round robin, which interleaves the endpoints instead of posting runs of batches to the heaviest one. When
+// no endpoint is healthy the lowest priority is posted to. e.mu has to be held.
+func (e *endpointSelector) nextWeighted() string {
+	priority, found := 0, false
+	for _, endpoint := range e.endpoints {
+		if e.healthy[endpoint] && (!found || e.priorities[endpoint] < priority) {
+			priority, found = e.priorities[endpoint], true
+		}
+	}
+	if !found {
+		for i, endpoint := range e.endpoints {
+			if i == 0 || e.priorities[endpoint] < priority {
+				priority = e.priorities[endpoint]
+			}
+		}
+	}
+	if priority != e.priority {
+		e.logger.Infof("Failing over from the endpoints of priority %d to the ones of priority %d", e.priority, priority)
+		e.priority = priority
+	}
+	best, total := "", 0
+	for _, endpoint := range e.endpoints {
+		if e.priorities[endpoint] != priority || (found && !e.healthy[endpoint]) {
+			continue
+		}
+		e.credits[endpoint] += e.weights[endpoint]
+		total += e.weights[endpoint]
+		if best == "" || e.credits[endpoint] > e.credits[best] {
+			best = endpoint
+		}
+	}
+	e.credits[best] -= total
+	e.current = best
+	return best
+}
+
+// observe records the latency of a request to endpoint and whether it was answered without a 5xx
+// response, then switches to another endpoint when the current one is unhealthy or much slower
+func (e *endpointSelector) observe(endpoint string, latency time.Duration, healthy bool) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, known := e.healthy[endpoint]; !known {
+		return
+	}
+	e.healthy[endpoint] = healthy
+	if healthy {
+		if previous, found := e.latencies[endpoint]; found {
+			latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(previous))
+		}
+		e.latencies[endpoint] = latency
+	}
+	if !e.weighted {
+		e.reselect()
+	}
+}
+
+// reselect picks the fastest healthy endpoint, e.mu has to be held
+func (e *endpointSelector) reselect() {
+	best := ""
+	for _, endpoint := range e.endpoints {
+		latency, measured := e.latencies[endpoint]
+		if !e.healthy[endpoint] || !measured {
+			continue
+		}
+		if best == "" || latency < e.latencies[best] {
+			best = endpoint
+		}
+	}
+	if best == "" || best == e.current {
+		return
+	}
+	currentLatency, measured := e.latencies[e.current]
+	if e.healthy[e.current] && measured && float64(e.latencies[best]) > (1-switchMargin)*float64(currentLatency) {
+		return
+	}
+	if !e.healthy[e.current] {
+		e.logger.Infof("Switching to the endpoint %s as %s is unhealthy", endpointHost(best), endpointHost(e.current))
+	} else {
+		e.logger.Infof("Switching to the endpoint %s, %v faster", endpointHost(best), currentLatency-e.latencies[best])
+	}
+	e.current = best
+}
+
+// probeIfDue measures the latency of every endpoint in the background once probeInterval elapsed since the
+// last probe, with a HEAD request which ingests nothing
+func (e *endpointSelector) probeIfDue(httpClient HTTPClient) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	if e.probing || (!e.lastProbe.IsZero() && time.Since(e.lastProbe) < e.probeInterval) {
+		e.mu.Unlock()
+		return
+	}
+	e.probing = true
+	e.lastProbe = time.Now()
+	e.mu.Unlock()
+	go func() {
+		defer func() {
+			e.mu.Lock()
+			e.probing = false
+			e.mu.Unlock()
+		}()
+		for _, endpoint := range e.endpoints {
+			request, err := http.NewRequest("HEAD", endpoint, nil)
+			if err != nil {
+				continue
+			}
+			start := time.Now()
+			response, err := httpClient.Do(request)
+			if response != nil {
+				response.Body.Close()
+			}
+			e.observe(endpoint, time.Since(start), err == nil && response.StatusCode < 500)
+		}
+	}()
+}
@@ -0,0 +1,26 @@
+package sumoclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	// signatureHeader carries the signature for the proxies between the extension and the collector
+	signatureHeader = "X-Payload-Signature"
+	signaturePrefix = "sha256="
+	// signatureField carries the signature into Sumo Logic
+	signatureField = "payloadSignature"
+)
+
+// sign returns the hex encoded HMAC-SHA256 of the uncompressed batch with SigningKey, empty when signing
+// is disabled. The key is usually a secretsmanager:// reference resolved when loading the config.
+func (s *sumoLogicClient) sign(payload []byte) string {
+	if s.config.SigningKey == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(s.config.SigningKey))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
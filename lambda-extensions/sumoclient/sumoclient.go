@@ -5,14 +5,23 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
 
 	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/fields"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
 
 	uuid "github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -23,14 +32,42 @@ var isColdStart = true
 // LogSender interface which needs to be implemented to send logs
 type LogSender interface {
 	SendLogs(context.Context, []byte) error
-	FlushAll([][]byte) error
+	FlushAll(context.Context, [][]byte) error
+	CatchUp(context.Context) error
+}
+
+// CompressionTuner is implemented by the senders whose compression level can be tuned while they send
+type CompressionTuner interface {
+	SetCompressionLevel(int)
+}
+
+// HTTPClient sends the requests to the collector, *http.Client satisfies it
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
 }
 
 // sumoLogicClient implements LogSender interface
 type sumoLogicClient struct {
-	httpClient http.Client
-	config     *config.LambdaExtensionConfig
-	logger     *logrus.Entry
+	httpClient  HTTPClient
+	objectStore utils.ObjectStore
+	config      *config.LambdaExtensionConfig
+	logger      *logrus.Entry
+	// batchFields are built on the first request, once the experiment group is selected
+	batchFields     *fields.Fields
+	batchFieldsOnce sync.Once
+	endOfStream     *endOfStreamTracker
+	recentLines     *recentLines
+	latency         *latencyEstimate
+	breaker         *circuitBreaker
+	dedup           *dedupWindow
+	selector        *endpointSelector
+	// failoverObjects are guarded by mu as they are written by concurrent senders
+	mu              sync.Mutex
+	failoverObjects []failoverObject
+	// livePostDelivered is 1 when the last live post was delivered, accessed atomically
+	livePostDelivered int32
+	// tunedCompression holds the compression level set by SetCompressionLevel, which replaces the configured one
+	tunedCompression atomic.Value
 }
 
 // It is assumed that logs will be array of json objects and all channel payloads satisfy this format
@@ -38,15 +75,108 @@ type responseBody []map[string]interface{}
 
 // NewLogSenderClient returns interface pointing to the concrete version of LogSender client
 func NewLogSenderClient(logger *logrus.Entry, cfg *config.LambdaExtensionConfig) LogSender {
+	return NewCustomLogSenderClient(logger, cfg, newHTTPClient(cfg), utils.DefaultObjectStore())
+}
+
+// newHTTPClient times the connection phases separately, so that a dead collector is detected quickly, while
+// the whole request is bounded by the longer RequestTimeout, so that big uploads still have the time to be
+// written but a stalled one does not hold the drain forever. A zero timeout disables it.
+func newHTTPClient(cfg *config.LambdaExtensionConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = cfg.ResponseTimeout
+	return &http.Client{Transport: transport, Timeout: cfg.RequestTimeout}
+}
+
+// NewCustomLogSenderClient returns a LogSender sending with httpClient and failing over to objectStore,
+// which lets code embedding the extension and tests use their own clients.
+func NewCustomLogSenderClient(logger *logrus.Entry, cfg *config.LambdaExtensionConfig, httpClient HTTPClient, objectStore utils.ObjectStore) LogSender {
 	// setting the cold start variable here since this function is called
 	var logSenderClient LogSender = &sumoLogicClient{
-		httpClient: http.Client{Timeout: cfg.ConnectionTimeoutValue},
-		config:     cfg,
-		logger:     logger,
+		httpClient:  withFaultInjection(httpClient, logger),
+		objectStore: objectStore,
+		config:      cfg,
+		logger:      logger,
+		endOfStream: newEndOfStreamTracker(),
+		recentLines: newRecentLines(cfg.FaultContextLines),
+		latency:     newLatencyEstimate(),
+		breaker:     newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, logger),
+		dedup:       newDedupWindow(cfg.DedupWindow, cfg.DedupFile, logger),
+		selector:    newEndpointSelector(cfg.SumoHTTPEndpoint, cfg.EndpointCandidates, cfg.EndpointProbeInterval, logger),
 	}
 	return logSenderClient
 }
 
+// newBatchFields returns the X-Sumo-Fields sent with every batch, describing the function runtime environment
+// so that queries across functions can be segmented by runtime and architecture. The fleet id groups the
+// functions of one service or team under a single value.
+func newBatchFields(cfg *config.LambdaExtensionConfig, logger *logrus.Entry) *fields.Fields {
+	batchFields := fields.NewFields()
+	values := [][2]string{
+		{"runtime", cfg.ExecutionEnv},
+		{"architecture", getArchitecture()},
+		{"fleetId", cfg.FleetID},
+		{"accountAlias", cfg.AccountAlias},
+	}
+	if cfg.FunctionMemorySize > 0 {
+		values = append(values, [2]string{"memorySize", strconv.Itoa(cfg.FunctionMemorySize)})
+	}
+	if cfg.ExperimentGroup != "" {
+		values = append(values, [2]string{"experimentGroup", cfg.ExperimentGroup})
+	}
+	for _, kv := range values {
+		if kv[1] == "" {
+			continue
+		}
+		if err := batchFields.Add(kv[0], kv[1]); err != nil {
+			logger.Warn("Skipping batch field: ", err.Error())
+		}
+	}
+	// the fields of SUMO_FIELDS are added last so that they replace the ones set by the extension
+	if cfg.SumoFields != nil {
+		for _, kv := range cfg.SumoFields.Pairs() {
+			if err := batchFields.Add(kv[0], kv[1]); err != nil {
+				logger.Warn("Skipping SUMO_FIELDS field: ", err.Error())
+			}
+		}
+	}
+	return batchFields
+}
+
+// SetCompressionLevel replaces the configured compression level of the payloads sent from now on
+func (s *sumoLogicClient) SetCompressionLevel(level int) {
+	s.tunedCompression.Store(level)
+}
+
+// compressionLevel returns the compression level set by SetCompressionLevel or the configured one
+func (s *sumoLogicClient) compressionLevel() int {
+	if level, ok := s.tunedCompression.Load().(int); ok {
+		return level
+	}
+	return s.config.CompressionLevel
+}
+
+func (s *sumoLogicClient) getBatchFields() *fields.Fields {
+	s.batchFieldsOnce.Do(func() {
+		s.batchFields = newBatchFields(s.config, s.logger)
+	})
+	return s.batchFields
+}
+
+// getArchitecture returns the architecture with the names used by Lambda
+func getArchitecture() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	default:
+		return runtime.GOARCH
+	}
+}
+
 func (s *sumoLogicClient) getColdStart() bool {
 	if isColdStart {
 		isColdStart = false
@@ -54,27 +184,82 @@ func (s *sumoLogicClient) getColdStart() bool {
 	return isColdStart
 }
 
-func (s *sumoLogicClient) makeRequest(ctx context.Context, buf *bytes.Buffer) (*http.Response, error) {
+// makeRequest posts a batch, outcome selects the source metadata of batches processed differently so that
+// the collector can route them, an empty outcome is a batch processed as usual.
+func (s *sumoLogicClient) makeRequest(ctx context.Context, buf io.Reader, signature, outcome string) (*http.Response, error) {
 
-	request, err := http.NewRequestWithContext(ctx, "POST", s.config.SumoHTTPEndpoint, buf)
+	endpoint := s.typeEndpoint(ctx)
+	request, err := http.NewRequestWithContext(withRequestTrace(ctx), "POST", endpoint, buf)
 	if err != nil {
+		if closer, ok := buf.(io.Closer); ok {
+			closer.Close()
+		}
 		err = fmt.Errorf("http.NewRequest() error: %v", err)
 		return nil, err
 	}
-	request.Header.Add("Content-Encoding", "gzip")
+	if !isUncompressed(buf) {
+		request.Header.Add("Content-Encoding", "gzip")
+	}
 	request.Header.Add("X-Sumo-Client", config.SumoLogicExtensionLayerVersionSuffix)
-	// This is added to make it compatible with AWS Lambda and AWS Lambda ULM App
-	request.Header.Add("X-Sumo-Name", s.getLogStream())
-	request.Header.Add("X-Sumo-Host", s.getLogGroup())
-	if s.config.SourceCategoryOverride != "" {
-		request.Header.Add("X-Sumo-Category", s.config.SourceCategoryOverride)
+	if signature != "" {
+		request.Header.Set(signatureHeader, signaturePrefix+signature)
 	}
+	metadata := s.sourceMetadata(ctx, signature, outcome)
+	err = metadata.Validate()
+	if err != nil {
+		request.Body.Close()
+		return nil, fmt.Errorf("%w: %v", errInvalidMetadata, err)
+	}
+	metadata.SetHeaders(request.Header)
+	start := time.Now()
 	response, err := s.httpClient.Do(request)
+	s.selector.observe(endpoint, time.Since(start), err == nil && response.StatusCode < 500)
 	return response, err
 }
 
-// getS3KeyName returns the key by combining function name, version, date and uuid(version 1)
-func (s *sumoLogicClient) getS3KeyName() (string, error) {
+// sourceMetadata returns the source metadata and fields sent as headers of a batch
+func (s *sumoLogicClient) sourceMetadata(ctx context.Context, signature, outcome string) fields.Metadata {
+	// This is added to make it compatible with AWS Lambda and AWS Lambda ULM App
+	metadata := fields.Metadata{
+		Name:     s.sourceName(),
+		Host:     s.sourceHost(),
+		Category: s.config.SourceCategoryOverride,
+		Fields:   s.getBatchFields(),
+	}
+	if settings, found := s.config.TypeSettings(contextLogType(ctx)); found {
+		applyOutcomeMetadata(&metadata, settings.Metadata)
+	}
+	// the lines of the bulk format carry their own metadata as well, debug capture included, the headers are
+	// still sent for the collectors and the processing rules reading them
+	if s.config.OutputFormat == config.OutputFormatBulk && outcome == config.OutcomeDebugCapture {
+		outcome = ""
+	}
+	if outcome != "" {
+		applyOutcomeMetadata(&metadata, s.config.OutcomeMetadata(outcome))
+	}
+	if signature != "" {
+		metadata.Fields = metadata.Fields.Clone()
+		if err := metadata.Fields.Add(signatureField, signature); err != nil {
+			s.logger.Warn("Unable to add the signature field: ", err.Error())
+		}
+	}
+	return metadata
+}
+
+// endpoint returns the endpoint selected for the alias of the payload of ctx, or the fastest of the
+// equivalent endpoints for SUMO_HTTP_ENDPOINT
+func (s *sumoLogicClient) endpoint(ctx context.Context) string {
+	endpoint := s.config.EndpointFor(contextAlias(ctx))
+	if s.selector == nil || endpoint != s.config.SumoHTTPEndpoint {
+		return endpoint
+	}
+	s.selector.probeIfDue(s.httpClient)
+	return s.selector.endpoint()
+}
+
+// getS3KeyName returns the key by combining function name, version, date, the request ids of the payload and
+// uuid(version 1), with the .gz extension for the compressed payloads
+func (s *sumoLogicClient) getS3KeyName(compressed bool, requestIDs []string) (string, error) {
 	currentTime := time.Now()
 	uniqueID, err := uuid.NewUUID()
 	if err != nil {
@@ -82,69 +267,107 @@ func (s *sumoLogicClient) getS3KeyName() (string, error) {
 	}
 	// common prefix where all lambda logs will go
 
-	key := fmt.Sprintf("%s/%s/%s/%s/%d/%02d/%02d/%02d/%d/%v.gz", config.ExtensionName, s.config.LambdaRegion, s.config.FunctionName, s.config.FunctionVersion,
+	key := fmt.Sprintf("%s/%s/%s/%s/%d/%02d/%02d/%02d/%d", config.ExtensionName, s.config.LambdaRegion, s.config.FunctionName, s.config.FunctionVersion,
 		currentTime.Year(), currentTime.Month(), currentTime.Day(),
-		currentTime.Hour(), currentTime.Minute(), uniqueID)
+		currentTime.Hour(), currentTime.Minute())
+	if segment := requestIDsKeySegment(requestIDs); segment != "" {
+		key += "/" + segment
+	}
+	key += fmt.Sprintf("/%v", uniqueID)
+	if compressed {
+		key += compressedExtension
+	}
 
 	return key, nil
 }
 
-func (s *sumoLogicClient) failoverHandler(buf *bytes.Buffer) error {
+// failoverHandler uploads a payload to the failover bucket, with the invocations of its records in its key and
+// metadata. The alias and the time it was received at are read from ctx for catch-up.
+func (s *sumoLogicClient) failoverHandler(ctx context.Context, buf io.Reader, requestIDs []string) error {
+	// streamed bodies have to be closed to stop their producer
+	if closer, ok := buf.(io.Closer); ok {
+		defer closer.Close()
+	}
 
 	if s.config.EnableFailover {
 
 		s.logger.Debug("Trying to Send to S3")
-		keyName, err := s.getS3KeyName()
+		keyName, err := s.getS3KeyName(!isUncompressed(buf), requestIDs)
 		if err != nil {
 			return err
 		}
-		err = utils.UploadToS3(&s.config.S3BucketName, &keyName, buf)
+		body := &countingReader{Reader: buf}
+		if uploader, ok := s.objectStore.(utils.MetadataUploader); ok {
+			err = uploader.UploadWithMetadata(s.config.S3BucketName, keyName, body, requestIDsMetadataValues(requestIDs))
+		} else {
+			err = s.objectStore.Upload(s.config.S3BucketName, keyName, body)
+		}
 		if err != nil {
+			telemetry.Add(telemetry.FailoverErrors, 1)
 			err = fmt.Errorf("Failed to Send to S3 Bucket %s Path %s: %w", s.config.S3BucketName, keyName, err)
+		} else {
+			telemetry.Add(telemetry.FailoverUploads, 1)
+			s.recordFailoverObject(ctx, keyName, body.count)
 		}
 		return err
 	}
 	return nil
 }
 
-func (s *sumoLogicClient) FlushAll(msgQueue [][]byte) error {
+// FlushAll writes the payloads to the failover bucket in one object, replayed to the endpoint of WithAlias and
+// received at the time of WithEnqueuedAt
+func (s *sumoLogicClient) FlushAll(ctx context.Context, msgQueue [][]byte) error {
 	var err error
 
 	if len(msgQueue) > 0 && s.config.EnableFailover {
 		s.logger.Debugf("FlushAll - Attempting to send %d payloads from dataqueue to S3", len(msgQueue))
 		var errorCount int = 0
 		var totalitems int = 0
-		var payload bytes.Buffer
+		// the key is set before the payload is streamed, so the request ids are read from the raw payloads
+		var requestIDs []string
 		for _, rawmsg := range msgQueue {
-			// converting to arr of maps
-			msgArr, err := s.transformBytesToArrayOfMap(rawmsg)
-			if err != nil {
-				s.logger.Error("FlushAll - Error in transforming bytes to array of struct", err.Error())
-				errorCount++
-				continue
-			}
-			if len(msgArr) > 0 {
-				// enhancing logs
-				s.enhanceLogs(msgArr)
-				totalitems += len(msgArr)
-
-				// converting back to string
-				for _, item := range msgArr {
-					b, err := json.Marshal(item)
-					if err != nil {
-						s.logger.Error("FlushAll - Error in coverting to json: ", err.Error())
-						errorCount++
-						continue
+			requestIDs = payloadRequestIDs(string(rawmsg), requestIDs)
+		}
+		// compressing on the fly while pushing to S3 so the whole payload is never held in memory
+		body := utils.CompressStream(func(payload io.Writer) error {
+			for _, rawmsg := range msgQueue {
+				// converting to arr of maps
+				msgArr, err := s.transformBytesToArrayOfMap(rawmsg)
+				if err != nil {
+					s.logger.Error("FlushAll - Error in transforming bytes to array of struct", err.Error())
+					errorCount++
+					continue
+				}
+				msgArr = s.filterOwnLogs(msgArr)
+				if len(msgArr) > 0 {
+					// enhancing logs
+					s.enhanceLogs(msgArr)
+					msgArr = s.filterSchedule(msgArr)
+					s.scanSecrets(msgArr)
+					s.enrich(ctx, msgArr)
+					msgArr = s.appendEndOfStream(msgArr)
+					totalitems += len(msgArr)
+
+					// converting back to string
+					for _, item := range msgArr {
+						b, err := json.Marshal(item)
+						if err != nil {
+							s.logger.Error("FlushAll - Error in coverting to json: ", err.Error())
+							errorCount++
+							continue
+						}
+						s.observe(item, len(b))
+						_, err = fmt.Fprintf(payload, "\n%s", string(b))
+						if err != nil {
+							return err
+						}
 					}
-					payload.WriteString(fmt.Sprintf("\n%s", string(b)))
 				}
 			}
-		}
-		s.logger.Debugf("FlushAll - Total log lines transformed: %d", totalitems)
-
-		// compressing and pushing to S3
-		gzippedBuffer := utils.CompressBuffer(&payload)
-		senderr := s.failoverHandler(gzippedBuffer)
+			s.logger.Debugf("FlushAll - Total log lines transformed: %d", totalitems)
+			return nil
+		}, s.compressionLevel())
+		senderr := s.failoverHandler(ctx, body, requestIDs)
 		if errorCount > 0 || senderr != nil {
 			err = fmt.Errorf("FlushAll - Errors during chunk creation: %d, Errors during flushing to S3: %v", errorCount, senderr)
 		}
@@ -167,6 +390,22 @@ func (s *sumoLogicClient) createCWLogLine(item map[string]interface{}) {
 	item["message"] = cwMessageLine
 }
 
+// sourceHost returns the source host of the batches, SOURCE_HOST_OVERRIDE or the log group of the function
+func (s *sumoLogicClient) sourceHost() string {
+	if s.config.SourceHostOverride != "" {
+		return s.config.SourceHostOverride
+	}
+	return s.getLogGroup()
+}
+
+// sourceName returns the source name of the batches, SOURCE_NAME_OVERRIDE or the log stream of the extension
+func (s *sumoLogicClient) sourceName() string {
+	if s.config.SourceNameOverride != "" {
+		return s.config.SourceNameOverride
+	}
+	return s.getLogStream()
+}
+
 func (s *sumoLogicClient) getLogGroup() string {
 	return fmt.Sprintf("/aws/lambda/%s", s.config.FunctionName)
 }
@@ -190,19 +429,66 @@ func (s *sumoLogicClient) enhanceLogs(msg responseBody) {
 
 		item["IsColdStart"] = s.getColdStart()
 		item["LayerVersion"] = config.SumoLogicExtensionLayerVersionSuffix
+		if s.config.TimestampSource != "" {
+			setTimestamp(item, s.config.TimestampSource)
+		}
+		if s.config.DebugCaptureActive() {
+			item["debugCapture"] = true
+		}
+		if s.config.OutputFormat == config.OutputFormatBulk {
+			s.addLineMetadata(item)
+		}
 		logType, ok := item["type"].(string)
+		if ok && (logType == "platform.runtimeDone" || logType == "platform.report") {
+			addExtensionOverhead(item, logType)
+		}
+		// tagged before the record is converted to the REPORT line
+		if ok && logType == "platform.report" && s.config.SlowInvocationTag {
+			s.tagSlowInvocation(item)
+		}
 		if ok && logType == "function" {
-			message, ok := item["record"].(string)
-			if ok {
+			var message string
+			// the records of the JSON log format of the runtime are objects instead of lines
+			if record, structured := item["record"].(map[string]interface{}); structured {
+				message = structuredRecord(item, record)
+			} else if text, isText := item["record"].(string); isText {
+				message = text
 				delete(item, "record")
 			}
 			item["message"] = strings.TrimSpace(message)
-		} else if ok && logType == "platform.report" {
+			if s.config.EnableErrorFingerprint {
+				addErrorFingerprint(item, fingerprintText(item, message))
+			}
+			if s.config.FieldMappingPreset != "" {
+				normalizeFields(item, message, config.FieldMappingPresets[s.config.FieldMappingPreset])
+			}
+			s.recentLines.add(strings.TrimSpace(message))
+		} else if ok && s.config.CloudWatchFormat && (logType == "platform.start" || logType == "platform.end" || logType == "platform.report") {
+			s.createClassicLine(item, logType)
+		} else if ok && logType == "platform.report" && s.config.LogFormat != config.LogFormatJSON {
+			// the JSON log format writes the platform records as they are, as CloudWatch does
 			s.createCWLogLine(item)
+		} else if ok && logType == "platform.fault" {
+			if lines := s.recentLines.snapshot(); len(lines) > 0 {
+				item[faultContextKey] = lines
+			}
 		}
 	}
 }
 
+// appendEndOfStream adds the terminator records of the invocations completed by this payload when enabled
+func (s *sumoLogicClient) appendEndOfStream(msgArr responseBody) responseBody {
+	if !s.config.EnableEndOfStream {
+		return msgArr
+	}
+	markers := s.endOfStream.track(msgArr)
+	if len(markers) > 0 {
+		s.enhanceLogs(markers)
+		msgArr = append(msgArr, markers...)
+	}
+	return msgArr
+}
+
 func (s *sumoLogicClient) transformBytesToArrayOfMap(rawmsg []byte) (responseBody, error) {
 	s.logger.Debugln("Transforming bytes to array of maps")
 	var msg responseBody
@@ -214,14 +500,25 @@ func (s *sumoLogicClient) transformBytesToArrayOfMap(rawmsg []byte) (responseBod
 	return msg, err
 }
 
-func (s *sumoLogicClient) createChunks(msgArr responseBody) ([]string, error) {
+// pendingChunk is a chunk being filled with the records of one payload size limit and settings
+type pendingChunk struct {
+	buf  bytes.Buffer
+	size int
+}
+
+// createChunks converts the records to chunks of json lines. The records of the log types with their own
+// payload size limit are chunked apart, so that the frequent platform records are not held back by big
+// function records, as are the ones of the log types with their own settings in SUMO_LOG_TYPE_CONFIG.
+func (s *sumoLogicClient) createChunks(msgArr responseBody) ([]logChunk, error) {
 
 	var err error
-	var chunks []string
+	var chunks []logChunk
 	var itemSize int
-	var chunkSize int = 0
-	var currentChunk bytes.Buffer
 	var errorCount int = 0
+	pending := map[chunkKey]*pendingChunk{}
+	var order []chunkKey
+	// the envelope of the requests is the same for the records of a log type
+	limits := map[string]int{}
 	for _, item := range msgArr {
 		b, err := json.Marshal(item)
 		if err != nil {
@@ -229,18 +526,40 @@ func (s *sumoLogicClient) createChunks(msgArr responseBody) ([]string, error) {
 			errorCount++
 			continue
 		}
+		logType, _ := item["type"].(string)
+		maxSize, found := limits[logType]
+		if !found {
+			maxSize = s.recordsLimit(logType)
+			limits[logType] = maxSize
+		}
+		b = s.truncateMessage(item, b, maxSize)
+		s.observe(item, len(b))
 		itemSize = binary.Size(b)
-		if chunkSize+itemSize+1 >= s.config.MaxDataPayloadSize {
-			chunks = append(chunks, currentChunk.String())
-			currentChunk = *bytes.NewBufferString(string(b))
-			chunkSize = itemSize
+		// chunks are keyed by their limit and settings, the log types sharing both share their chunks
+		key := chunkKey{maxSize: maxSize, logType: s.settingsLogType(logType)}
+		currentChunk, found := pending[key]
+		if !found {
+			currentChunk = &pendingChunk{}
+			pending[key] = currentChunk
+			order = append(order, key)
+		}
+		if currentChunk.size+itemSize+1 >= maxSize {
+			chunks = append(chunks, logChunk{payload: currentChunk.buf.String(), logType: key.logType})
+			currentChunk.buf.Reset()
+			currentChunk.buf.Write(b)
+			currentChunk.size = itemSize
 		} else {
-			chunkSize += itemSize + 1
-			currentChunk.WriteString(fmt.Sprintf("\n%s", string(b)))
+			currentChunk.size += itemSize + 1
+			currentChunk.buf.WriteString(fmt.Sprintf("\n%s", string(b)))
 		}
 
 	}
-	chunks = append(chunks, currentChunk.String())
+	for _, key := range order {
+		chunks = append(chunks, logChunk{payload: pending[key].buf.String(), logType: key.logType})
+	}
+	if len(order) == 0 {
+		chunks = append(chunks, logChunk{})
+	}
 	if errorCount > 0 {
 		err = fmt.Errorf("Dropping %d messages due to json parsing error", errorCount)
 	}
@@ -251,13 +570,29 @@ func (s *sumoLogicClient) createChunks(msgArr responseBody) ([]string, error) {
 // SendToSumo send logs to sumo http endpoint returns
 func (s *sumoLogicClient) SendLogs(ctx context.Context, rawmsg []byte) error {
 	if len(rawmsg) > 0 {
+		// the batch is hashed as received, its enriched chunks differ every time it is sent
+		var hash string
+		if s.dedup != nil {
+			hash = batchHash(string(rawmsg))
+			if s.dedup.sent(hash) {
+				telemetry.Add(telemetry.BatchesDeduped, 1)
+				s.logger.Debug("Not posting a batch identical to one posted recently")
+				return nil
+			}
+		}
 		// converting to arr of maps
 		msgArr, err := s.transformBytesToArrayOfMap(rawmsg)
 		if err != nil {
 			return fmt.Errorf("SendLogs - transformBytesToArrayOfMap failed: %v", err)
 		}
 		s.logger.Debugf("SendLogs - Total log lines transformed: %d", len(msgArr))
+		telemetry.Add(telemetry.RecordsReceived, int64(len(msgArr)))
+		msgArr = s.filterOwnLogs(msgArr)
 		s.enhanceLogs(msgArr)
+		msgArr = s.filterSchedule(msgArr)
+		s.scanSecrets(msgArr)
+		s.enrich(ctx, msgArr)
+		msgArr = s.appendEndOfStream(msgArr)
 
 		// converting back to chunks of string
 		chunks, err := s.createChunks(msgArr)
@@ -265,70 +600,145 @@ func (s *sumoLogicClient) SendLogs(ctx context.Context, rawmsg []byte) error {
 			return fmt.Errorf("SendLogs - createChunks failed: %v", err)
 		}
 		var errorCount int = 0
-		for _, strobj := range chunks {
-			err := s.postToSumo(ctx, &strobj)
+		allPosted := true
+		for _, chunk := range chunks {
+			posted, err := s.postToSumo(withLogType(ctx, chunk.logType), &chunk.payload)
 			if err != nil {
 				errorCount++
 			}
+			allPosted = allPosted && posted
 		}
 		if errorCount > 0 {
 			err = fmt.Errorf("SendLogs - errors during postToSumo: %d", errorCount)
 			return err
 		}
+		if allPosted {
+			s.dedup.add(hash)
+		}
 	}
 	return nil
 }
 
-func (s *sumoLogicClient) postToSumo(ctx context.Context, logStringToSend *string) error {
+// newBodyFactory returns a function creating a fresh gzipped body for every attempt. Payloads larger than
+// StreamingThreshold are compressed on the fly while being sent with chunked transfer encoding.
+func (s *sumoLogicClient) newBodyFactory(logStringToSend *string) func() io.Reader {
+	if len(*logStringToSend) > s.config.StreamingThreshold {
+		return func() io.Reader {
+			return utils.CompressStream(func(w io.Writer) error {
+				_, err := io.WriteString(w, *logStringToSend)
+				return err
+			}, s.compressionLevel())
+		}
+	}
+	// compressing here because Sumo recommends payload size of 1MB before compression
+	bytedata := utils.CompressWithLevel(logStringToSend, s.compressionLevel())
+	return func() io.Reader {
+		return bytes.NewReader(bytedata)
+	}
+}
+
+// postToSumo posts a chunk and returns whether the collector accepted it, a chunk failed over or dropped
+// is not posted.
+func (s *sumoLogicClient) postToSumo(ctx context.Context, logStringToSend *string) (bool, error) {
 	s.logger.Debug("Attempting to send to Sumo Endpoint")
 
-	// compressing here because Sumo recommends payload size of 1MB before compression
-	bytedata := utils.Compress(logStringToSend)
-	createBuffer := func() *bytes.Buffer {
-		dest := make([]byte, len(bytedata))
-		copy(dest, bytedata)
-		return bytes.NewBuffer(dest)
+	createBuffer := s.newBodyFactory(logStringToSend)
+	if skipCompression(ctx) {
+		createBuffer = newUncompressedBodyFactory(logStringToSend)
+	}
+	signature := s.sign([]byte(*logStringToSend))
+	outcome := s.liveOutcome()
+	allowed, probe := s.breaker.allow()
+	if !allowed {
+		telemetry.Add(telemetry.BreakerSkips, 1)
+		s.logger.Debug("Not posting as the circuit breaker is open")
+		return false, s.failover(ctx, createBuffer, logStringToSend)
 	}
+	requestCtx, cancel := s.withRetryDeadline(ctx)
+	defer cancel()
 	buf := createBuffer()
-	response, err := s.makeRequest(ctx, buf)
+	response, err := s.makeRequest(requestCtx, buf, signature, outcome)
 	if response != nil {
 		defer response.Body.Close()
 	}
-	if (err != nil) || (response.StatusCode != 200 && response.StatusCode != 302 && response.StatusCode < 500) {
+	if errors.Is(err, errInvalidMetadata) {
+		// the collector was not reached, the breaker and the retries are left to its failures
+		s.breaker.release(probe)
+		telemetry.Add(telemetry.PostsFailed, 1)
+		s.logger.Error("Not posting: ", err)
+		return false, s.failover(ctx, createBuffer, logStringToSend)
+	}
+	if isFailedResponse(err, response) {
 		s.logger.Errorf("Not able to post statuscode:  %v %v\n", err, response)
-		err := utils.Retry(func(attempt int) (bool, error) {
-			s.logger.Debugf("Waiting for %v ms for retry attempt: %v\n", s.config.RetrySleepTime, attempt)
-			time.Sleep(s.config.RetrySleepTime)
-			buf := createBuffer()
-			retryResponse, errRetry := s.makeRequest(ctx, buf)
-			if (errRetry != nil) || (retryResponse.StatusCode != 200 && retryResponse.StatusCode != 302 && retryResponse.StatusCode < 500) {
-				if errRetry == nil {
-					errRetry = fmt.Errorf("statuscode %v", retryResponse.StatusCode)
+		s.refetchEndpoint(response)
+		budget := s.newRetryBudget()
+		// the probe of an open breaker only checks whether the collector is back
+		if !probe && s.consumeRetry(budget, err) {
+			lastErr := err
+			if lastErr == nil {
+				lastErr = fmt.Errorf("statuscode %v", response.StatusCode)
+			}
+			err = utils.Retry(func(attempt int) (bool, error) {
+				if !s.retryTimeLeft(requestCtx) {
+					s.logger.Debugf("Not retrying as the retry time is spent after %v attempts\n", attempt)
+					return false, lastErr
+				}
+				telemetry.Add(telemetry.PostRetries, 1)
+				s.logger.Debugf("Waiting for %v ms for retry attempt: %v\n", s.config.RetrySleepTime, attempt)
+				time.Sleep(s.config.RetrySleepTime)
+				buf := createBuffer()
+				retryResponse, errRetry := s.makeRequest(requestCtx, buf, signature, outcome)
+				if retryResponse != nil {
+					retryResponse.Body.Close()
+				}
+				if isFailedResponse(errRetry, retryResponse) {
+					s.refetchEndpoint(retryResponse)
+					// transport errors and HTTP errors are retried with their own budgets
+					retry := s.consumeRetry(budget, errRetry)
+					if errRetry == nil {
+						errRetry = fmt.Errorf("statuscode %v", retryResponse.StatusCode)
+					}
+					s.logger.Error("Not able to post: ", errRetry)
+					lastErr = errRetry
+					return retry, errRetry
 				}
-				s.logger.Error("Not able to post: ", errRetry)
-				return attempt < s.config.MaxRetryAttempts, errRetry
-			} else if retryResponse.StatusCode == 200 {
 				s.logger.Debugf("Post of logs successful after retry %v attempts\n", attempt)
 				return true, nil
-			}
-			return attempt < s.config.MaxRetryAttempts, errRetry
-		}, s.config.NumRetry)
+			}, s.config.NumRetry+s.config.NumConnectionRetries)
+		} else if err == nil {
+			err = fmt.Errorf("statuscode %v", response.StatusCode)
+		}
+		s.breaker.record(probe, err == nil)
+		s.recordLivePost(err == nil)
 		if err != nil {
+			telemetry.Add(telemetry.PostsFailed, 1)
 			s.logger.Error("Finished retrying Error: ", err)
-			if s.config.EnableFailover {
-				buf = createBuffer()
-				err := s.failoverHandler(buf)
-				if err != nil {
-					s.logger.Errorf("Dropping messages as post to S3 failed: %v\n", err)
-					return err
-				}
-			} else {
-				s.logger.Info("Dropping messages as no failover enabled.")
-			}
+			return false, s.failover(ctx, createBuffer, logStringToSend)
 		}
-	} else if response.StatusCode == 200 {
+		telemetry.Add(telemetry.PostsSucceeded, 1)
+		s.commitBatch(ctx, "live", []byte(*logStringToSend), signature, "")
+	} else {
+		s.breaker.record(probe, true)
+		s.recordLivePost(true)
+		telemetry.Add(telemetry.PostsSucceeded, 1)
 		s.logger.Debugf("Post of logs successful")
+		s.commitBatch(ctx, "live", []byte(*logStringToSend), signature, "")
 	}
 
+	return true, nil
+}
+
+// failover writes a payload which could not be posted to the failover bucket or drops it
+func (s *sumoLogicClient) failover(ctx context.Context, createBuffer func() io.Reader, logStringToSend *string) error {
+	if !s.config.EnableFailover {
+		telemetry.Add(telemetry.PayloadsDropped, 1)
+		s.logger.Info("Dropping messages as no failover enabled.")
+		return nil
+	}
+	err := s.failoverHandler(ctx, createBuffer(), payloadRequestIDs(*logStringToSend, nil))
+	if err != nil {
+		s.logger.Errorf("Dropping messages as post to S3 failed: %v\n", err)
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,24 @@
+package sumoclient
+
+import (
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+)
+
+// timestampKey sorts before the other keys of the json lines, so it holds the first timestamp of every
+// line and is the one picked by the timestamp parsing of the HTTP source.
+const timestampKey = "@timestamp"
+
+// setTimestamp sets the timestamp Sumo Logic indexes the record with, see config.TimestampSourceRecord: the
+// time the extension received the record or the time of the record itself, records without one are left
+// unchanged.
+func setTimestamp(item map[string]interface{}, source string) {
+	if source == config.TimestampSourceReceived {
+		item[timestampKey] = time.Now().UTC().Format(time.RFC3339Nano)
+		return
+	}
+	if recordTime, ok := item["time"].(string); ok {
+		item[timestampKey] = recordTime
+	}
+}
@@ -0,0 +1,62 @@
+package sumoclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+)
+
+// withRequestTrace times the DNS lookup, the connection, the TLS handshake and the first response byte of a
+// request into the self telemetry, which tells a slow collector from a slow network path such as a VPC NAT.
+// Reused connections only report the time to the first byte.
+func withRequestTrace(ctx context.Context) context.Context {
+	// the hooks run on the goroutines of the transport, the dials of both address families concurrently
+	var mu sync.Mutex
+	var start, dnsStart, connectStart, tlsStart time.Time
+	mark := func(t *time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		*t = time.Now()
+	}
+	observe := func(name string, t *time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		telemetry.ObserveTiming(name, time.Since(*t))
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			mark(&start)
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mark(&dnsStart)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err == nil {
+				observe(telemetry.DNSTiming, &dnsStart)
+			}
+		},
+		ConnectStart: func(string, string) {
+			mark(&connectStart)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				observe(telemetry.ConnectTiming, &connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			mark(&tlsStart)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil {
+				observe(telemetry.TLSTiming, &tlsStart)
+			}
+		},
+		GotFirstResponseByte: func() {
+			observe(telemetry.TTFBTiming, &start)
+		},
+	})
+}
@@ -0,0 +1,46 @@
+package sumoclient
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// truncationMarker is appended to the truncated messages with the number of bytes omitted
+const truncationMarker = " [truncated %d bytes]"
+
+// truncateMessage shortens the message of a log line whose json b does not fit in a chunk of maxSize by
+// itself, on a rune boundary so that the line stays valid UTF-8. Lines without a message, as the platform
+// records, are returned as they are.
+func (s *sumoLogicClient) truncateMessage(item map[string]interface{}, b []byte, maxSize int) []byte {
+	message, ok := item["message"].(string)
+	if !ok || len(b)+1 < maxSize {
+		return b
+	}
+	truncated := make(map[string]interface{}, len(item))
+	for key, value := range item {
+		truncated[key] = value
+	}
+	// the escaping of the json makes the line shorter by at least the bytes cut from the message, the next
+	// passes cover the length of the marker
+	cut := len(b) + 2 - maxSize
+	for i := 0; i < 3 && cut > 0; i++ {
+		kept, omitted := utils.TruncateUTF8(message, len(message)-cut-len(fmt.Sprintf(truncationMarker, cut)))
+		truncated["message"] = kept + fmt.Sprintf(truncationMarker, omitted)
+		tb, err := json.Marshal(truncated)
+		if err != nil {
+			return b
+		}
+		b = tb
+		if over := len(b) + 2 - maxSize; over > 0 {
+			cut += over
+		} else {
+			break
+		}
+	}
+	s.logger.Warnf("Truncated a %s line of %d bytes to fit in %d bytes", item["type"], len(message), maxSize)
+	telemetry.Add(telemetry.LinesTruncated, 1)
+	return b
+}
@@ -0,0 +1,43 @@
+package sumoclient
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+)
+
+// compressedExtension ends the keys of the gzipped failover objects
+const compressedExtension = ".gz"
+
+// uncompressedTimeLeft is the time left before the deadline of the context below which the payloads are
+// sent uncompressed, as on shutdown when the deadline is close
+const uncompressedTimeLeft = 500 * time.Millisecond
+
+// uncompressedBody is a payload sent as it is, without the gzip Content-Encoding, and written to the
+// failover bucket without the .gz extension so that the catch up replays it the same way
+type uncompressedBody struct {
+	io.Reader
+}
+
+// skipCompression tells whether the deadline of ctx is too close to spend time compressing, sending the
+// payload uncompressed takes more bandwidth but does not lose it
+func skipCompression(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) < uncompressedTimeLeft
+}
+
+// newUncompressedBodyFactory returns a function creating a fresh uncompressed body for every attempt
+func newUncompressedBodyFactory(logStringToSend *string) func() io.Reader {
+	telemetry.Add(telemetry.UncompressedSent, 1)
+	return func() io.Reader {
+		return uncompressedBody{Reader: strings.NewReader(*logStringToSend)}
+	}
+}
+
+func isUncompressed(buf io.Reader) bool {
+	_, ok := buf.(uncompressedBody)
+	return ok
+}
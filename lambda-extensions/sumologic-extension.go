@@ -2,14 +2,23 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
 
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/analytics"
 	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/lambdaapi"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/sumoclient"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
 	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/workers"
 
 	cfg "github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
@@ -24,21 +33,112 @@ var (
 )
 var producer workers.TaskProducer
 var consumer workers.TaskConsumer
+var autotuner *workers.Autotuner
+var heartbeat *workers.Heartbeat
+
+const (
+	// shutdownDeadlineMargin is the time kept after flushing the dataQueue on shutdown
+	shutdownDeadlineMargin = 100 * time.Millisecond
+	// maxShutdownDuration is the longest shutdown phase Lambda gives to extensions
+	maxShutdownDuration = 2000 * time.Millisecond
+	// initTimeout bounds the registration, the config resolution and the subscription together, below the
+	// 10s Lambda gives to the INIT phase so that the failure is logged
+	initTimeout = 9 * time.Second
+	// faultDrainRetrySleep is the wait for a running drain to end before draining a fault
+	faultDrainRetrySleep = 10 * time.Millisecond
+)
+
+// draining is set while a drain of the dataQueue is running
+var draining int32
+
+// drainPending is set when a drain is requested, the running drain then drains the queue again once done
+var drainPending int32
+
+// reloadPending is set when a change of the dynamic config sources waits for a drain to end to be reloaded
+var reloadPending bool
+
+// disabled is set by SUMO_DISABLE or SUMO_ENABLED=false, the extension then only waits for the shutdown
+var disabled bool
+
+// configErr is the validation error of the config last loaded, which fails the init when StrictConfig is set
+var configErr error
 var config *cfg.LambdaExtensionConfig
-var dataQueue chan []byte
+var dataQueue workers.DataQueue
+
+// registerResult is the outcome of the registration started by init
+type registerResult struct {
+	response *lambdaapi.RegisterResponse
+	err      error
+}
+
+var (
+	initCtx, cancelInit = context.WithTimeout(context.Background(), initTimeout)
+	registered          = make(chan registerResult, 1)
+	describePipeline    = flag.Bool("describe-pipeline", false, "print the pipeline resolved from the environment and exit")
+	validate            = flag.Bool("validate", false, "print the config resolved from the environment and its errors, and exit with 1 when invalid")
+	configFile          = flag.String("config", "", "config file read by -validate instead of SUMO_CONFIG_FILE")
+	simulateDir         = flag.String("simulate-shutdown", "", "flush the payloads of a spill directory as on shutdown, print what would be flushed, persisted or dropped, and exit with 1 when payloads are lost")
+	simulateLatency     = flag.Duration("simulate-latency", 100*time.Millisecond, "latency of the collector simulated by -simulate-shutdown")
+	simulateStatus      = flag.Int("simulate-status", http.StatusOK, "status of the collector simulated by -simulate-shutdown")
+)
 
 func init() {
 	logger.Logger.SetOutput(os.Stdout)
 
-	// Creating config and performing validation
+	flag.Parse()
+	if *describePipeline {
+		printPipeline()
+		os.Exit(0)
+	}
+	if *validate {
+		os.Exit(validateConfig())
+	}
+	if *simulateDir != "" {
+		os.Exit(simulateShutdown(*simulateDir, *simulateLatency, *simulateStatus))
+	}
+
+	// Registering while the config is resolved, the registration does not depend on it and resolving
+	// parameters and secrets takes a few round trips on the cold start critical path
+	go func() {
+		var events []lambdaapi.EventType
+		for _, event := range cfg.RegistrationEvents() {
+			events = append(events, lambdaapi.EventType(event))
+		}
+		response, err := extensionClient.RegisterExtensionForEvents(initCtx, events)
+		registered <- registerResult{response: response, err: err}
+	}()
+
 	var err error
-	config, err = cfg.GetConfig()
+	disabled, err = cfg.Disabled()
 	if err != nil {
-		logger.Error("Error during Fetching Env Variables: ", err.Error())
+		logger.Error("Invalid kill switch, the extension stays enabled: ", err.Error())
+	}
+	if disabled {
+		logger.Info("The extension is disabled, it does not subscribe to any logs")
+		return
 	}
 
+	// Creating config and performing validation
+	config, configErr = cfg.GetConfig()
+	if configErr != nil {
+		logger.Error("Error during Fetching Env Variables: ", configErr.Error())
+	}
+	if unknown := cfg.UnknownEnv(); len(unknown) > 0 {
+		logger.Warnf("Ignoring the env vars the extension does not read: %s", strings.Join(unknown, ", "))
+	}
+	for _, warning := range config.EndpointWarnings() {
+		logger.Warn(warning)
+	}
+	emitConfig()
+
 	logger.Logger.SetLevel(config.LogLevel)
-	dataQueue = make(chan []byte, config.MaxDataQueueLength)
+	if config.RingBufferSize > 0 {
+		dataQueue = workers.NewRingBufferQueue(config.RingBufferSize)
+	} else {
+		dataQueue = workers.NewChannelQueue(config.MaxDataQueueLength)
+	}
+	// the payloads received while the queue is full are held so that the Logs API is acknowledged right away
+	dataQueue = workers.NewOverflowQueue(dataQueue, config.OverflowBufferSize)
 
 	// Start HTTP Server before subscription in a goRoutine
 	producer = workers.NewTaskProducer(dataQueue, logger)
@@ -46,31 +146,381 @@ func init() {
 
 	// Creating SumoTaskConsumer
 	consumer = workers.NewTaskConsumer(dataQueue, config, logger)
+
+	if config.EnableAutotune {
+		autotuner = workers.NewAutotuner(config, logger, consumer)
+	}
+
+	if config.EnableHeartbeat {
+		heartbeat = workers.NewHeartbeat(dataQueue, config, logger)
+	}
+
+	if config.EnableDebugCapture {
+		cfg.StartDebugCapture(config.DebugCaptureDuration)
+	}
+
+	if config.MetricsAddress != "" {
+		go serveMetrics(config.MetricsAddress)
+	}
+
+	// the daemon address is only set when active tracing is enabled on the function
+	if config.EnableXRay && config.XRayDaemonAddress != "" {
+		if err := telemetry.EnableXRay(config.XRayDaemonAddress); err != nil {
+			logger.Error("Unable to reach the X-Ray daemon: ", err.Error())
+		}
+	}
 }
 
-func runTimeAPIInit() (int64, error) {
-	// Register early so Runtime could start in parallel
-	logger.Debug("Registering Extension to Run Time API Client..........")
-	registerResponse, err := extensionClient.RegisterExtension(nil)
+// serveMetrics exposes the telemetry counters on /metrics, for watching the pipeline live with Prometheus
+// while reproducing an issue locally, e.g. with the Lambda runtime interface emulator.
+func serveMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", telemetry.MetricsHandler)
+	logger.Infof("Serving metrics on %s/metrics", address)
+	err := http.ListenAndServe(address, mux)
 	if err != nil {
-		return 0, err
+		logger.Error("Unable to serve metrics: ", err.Error())
+	}
+}
+
+// printPipeline prints the receiver, the processors and the senders with their settings resolved from the
+// environment, which answers why a record was or was not filtered without debug logging in production
+func printPipeline() {
+	config, err := cfg.GetConfig()
+	var configErrors []string
+	if err != nil {
+		configErrors = strings.Split(err.Error(), ", ")
+	}
+	fmt.Println(utils.PrettyPrint(map[string]interface{}{
+		"extensionName": extensionName,
+		"configErrors":  configErrors,
+		"receiver": map[string]interface{}{
+			"registrationEvents":  config.RegistrationEvents,
+			"logTypes":            config.LogTypes,
+			"maxDataQueueLength":  config.MaxDataQueueLength,
+			"ringBufferBytes":     config.RingBufferSize,
+			"overflowBufferBytes": config.OverflowBufferSize,
+			"maxMemoryBytes":      config.MaxMemory,
+			"bufferedBytes":       config.BufferedBytes(),
+			"processingSleep":     config.ProcessingSleepTime.String(),
+			"flushInterval":       config.FlushInterval.String(),
+			"maxRecordAge":        config.MaxRecordAge.String(),
+			"spillTtl":            config.SpillTTL.String(),
+			"coalesceMaxAge":      config.CoalesceMaxAge.String(),
+			"coalesceMaxBytes":    config.CoalesceMaxBytes,
+		},
+		"stages": sumoclient.DescribePipeline(config),
+	}))
+}
+
+// emitConfig writes the config resolved at init with the source of every env var as an extension.config
+// record, which tells why an env var does not take effect without enabling debug logging
+func emitConfig() {
+	var configErrors []string
+	if configErr != nil {
+		configErrors = strings.Split(configErr.Error(), ", ")
+	}
+	err := telemetry.EmitRecord(os.Stdout, "extension.config", map[string]interface{}{
+		"extensionName":    extensionName,
+		"configErrors":     configErrors,
+		"unknownEnv":       cfg.UnknownEnv(),
+		"endpointWarnings": config.EndpointWarnings(),
+		"config":           config.Resolved(),
+		"sources":          config.Sources(),
+	})
+	if err != nil {
+		logger.Error("Unable to emit the config: ", err.Error())
+	}
+}
+
+// validateConfig prints the config resolved from the environment, or from the config file of -config, and
+// its errors, so that deploy pipelines can be gated on the config. It returns the exit code, 1 when invalid.
+func validateConfig() int {
+	if *configFile != "" {
+		os.Setenv("SUMO_CONFIG_FILE", *configFile)
+	}
+	config, err := cfg.GetConfig()
+	var configErrors []string
+	if err != nil {
+		configErrors = strings.Split(err.Error(), ", ")
+	}
+	fmt.Println(utils.PrettyPrint(map[string]interface{}{
+		"extensionName":    extensionName,
+		"valid":            err == nil,
+		"configErrors":     configErrors,
+		"unknownEnv":       cfg.UnknownEnv(),
+		"endpointWarnings": config.EndpointWarnings(),
+		"config":           config.Resolved(),
+		"sources":          config.Sources(),
+	}))
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+func runTimeAPIInit() error {
+	defer cancelInit()
+	// Registered early by init so Runtime could start in parallel
+	logger.Debug("Registering Extension to Run Time API Client..........")
+	var result registerResult
+	select {
+	case result = <-registered:
+	case <-initCtx.Done():
+		return fmt.Errorf("Registration did not complete within %v: %v", initTimeout, initCtx.Err())
+	}
+	if result.err != nil {
+		return result.err
+	}
+	logger.Debugf("Succcessfully Registered with Run Time API Client using the %s API: %s", extensionClient.ExtensionAPIVersion(), utils.PrettyPrint(result.response))
+
+	// Wait for sibling extensions to populate values before the config is checked, the startup file and the
+	// experiment group reload it
+	if config.StartupWaitFile != "" {
+		waitForStartupFile()
+	}
+
+	if config.ExperimentGroups != "" {
+		applyExperimentGroup(config.ExperimentGroups)
+	}
+
+	if config.ResolveAccountAlias && config.AccountAlias == "" {
+		resolveAccountAlias()
+	}
+
+	// failing the init fails the function, so that a deploy with an invalid config does not drop logs silently
+	if configErr != nil && config.StrictConfig {
+		if _, err := extensionClient.InitError(initCtx, "Extension.InvalidConfig"); err != nil {
+			logger.Error("Unable to report the init error: ", err.Error())
+		}
+		return fmt.Errorf("SUMO_CONFIG_STRICT is set and the config is invalid: %v", configErr)
+	}
+
+	if config.PreflightMode == cfg.PreflightWarn || config.PreflightMode == cfg.PreflightFail {
+		if err := sumoclient.Preflight(initCtx, config); err != nil {
+			if config.PreflightMode == cfg.PreflightFail {
+				if _, err := extensionClient.InitError(initCtx, "Extension.PreflightFailed"); err != nil {
+					logger.Error("Unable to report the init error: ", err.Error())
+				}
+				return fmt.Errorf("SUMO_PREFLIGHT_MODE is fail and the preflight failed: %v", err)
+			}
+			logger.Warn("Preflight of the endpoint failed, continuing: ", err.Error())
+		}
+	}
+
+	if config.EnableFailover {
+		if err := sumoclient.ProbeFailoverBucket(initCtx, config, utils.DefaultObjectStore()); err != nil {
+			if config.PreflightMode == cfg.PreflightFail {
+				if _, err := extensionClient.InitError(initCtx, "Extension.FailoverBucketInvalid"); err != nil {
+					logger.Error("Unable to report the init error: ", err.Error())
+				}
+				return fmt.Errorf("SUMO_PREFLIGHT_MODE is fail and the failover bucket is not writable: %v", err)
+			}
+			logger.Error("The failover bucket is not writable, the payloads which fail to be sent will be lost: ", err.Error())
+		}
 	}
-	logger.Debug("Succcessfully Registered with Run Time API Client: ", utils.PrettyPrint(registerResponse))
 
 	// Subscribe to Logs API
 	logger.Debug("Subscribing Extension to Logs API........")
-	subscribeResponse, err := extensionClient.SubscribeToLogsAPI(nil, config.LogTypes)
+	if len(config.LogTypes) == 0 {
+		logger.Info("SUMO_LOG_TYPES is empty, not subscribing to the Logs API")
+	} else if config.StrictSubscription {
+		subscribeResponse, err := extensionClient.SubscribeToLogsAPI(initCtx, config.LogTypes)
+		if err != nil {
+			return err
+		}
+		logger.Debugf("Successfully subscribed with the %s API: %s", extensionClient.LogsAPIVersion(), utils.PrettyPrint(string(subscribeResponse)))
+	} else if err := subscribeToAvailableLogTypes(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// waitForStartupFile delays readiness until the startup wait file is written and reloads the config from it.
+func waitForStartupFile() {
+	logger.Debugf("Waiting up to %v for startup file %s", config.StartupWaitTimeout, config.StartupWaitFile)
+	err := cfg.WaitForStartupFile(config.StartupWaitFile, config.StartupWaitTimeout)
+	if err != nil {
+		logger.Error("Continuing with current config: ", err.Error())
+		return
+	}
+	err = cfg.LoadEnvFile(config.StartupWaitFile)
+	if err != nil {
+		logger.Error("Unable to load startup file: ", err.Error())
+		return
+	}
+	reloadConfig()
+}
+
+// applyExperimentGroup reloads the config with the variables of the experiment group of this execution environment.
+// The registration id is unique to the environment. The dataQueue is already created so its settings are not changed.
+func applyExperimentGroup(experimentGroups string) {
+	group, err := cfg.ApplyExperimentGroup(experimentGroups, extensionClient.ExtensionID())
 	if err != nil {
-		return 0, err
+		logger.Error("Continuing without experiment group: ", err.Error())
+		return
 	}
-	logger.Debug("Successfully subscribed to Logs API: ", utils.PrettyPrint(string(subscribeResponse)))
+	reloadConfig()
+	config.ExperimentGroup = group
+	logger.Infof("Selected experiment group %s", group)
+}
 
-	// Call next to say registration is successful and get the deadtimems
-	nextResponse, err := nextEvent(nil)
+// subscribeToAvailableLogTypes keeps the log types the Logs API accepts subscribed when it rejects some of
+// them, and reports the rejected ones as an extension.subscriptionDegraded record instead of failing the INIT
+func subscribeToAvailableLogTypes() error {
+	subscribed, rejected, err := extensionClient.SubscribeToAvailableLogTypes(initCtx, config.LogTypes)
+	if err != nil {
+		return err
+	}
+	if len(rejected) == 0 {
+		logger.Debugf("Successfully subscribed with the %s API for %v", extensionClient.LogsAPIVersion(), subscribed)
+		return nil
+	}
+	reasons := make(map[string]string, len(rejected))
+	for logType, err := range rejected {
+		reasons[logType] = err.Error()
+	}
+	logger.Warnf("Subscribed to Logs API for %v only, rejected types: %v", subscribed, reasons)
+	err = telemetry.EmitRecord(os.Stdout, "extension.subscriptionDegraded", map[string]interface{}{
+		"extensionName": extensionName,
+		"requested":     config.LogTypes,
+		"subscribed":    subscribed,
+		"rejected":      reasons,
+	})
+	if err != nil {
+		logger.Error("Unable to emit subscription warning: ", err.Error())
+	}
+	return nil
+}
+
+// reportAPIUnavailable emits an extension.apiUnavailable record when the runtime serves none of the versions
+// of the Extensions or Logs API the extension knows, so that the runtimes it does not support yet stand out
+func reportAPIUnavailable(err error) {
+	unavailable, ok := err.(*lambdaapi.APIUnavailableError)
+	if !ok {
+		return
+	}
+	err = telemetry.EmitRecord(os.Stdout, "extension.apiUnavailable", map[string]interface{}{
+		"extensionName": extensionName,
+		"api":           unavailable.API,
+		"versions":      unavailable.Versions,
+		"errors":        unavailable.Errors,
+	})
+	if err != nil {
+		logger.Error("Unable to emit unavailable API warning: ", err.Error())
+	}
+}
+
+// resolveAccountAlias looks up the account alias once per environment, it is sent as a field as the
+// account ids are unreadable in the dashboards spanning many accounts
+func resolveAccountAlias() {
+	alias, err := utils.GetAccountAlias(initCtx)
 	if err != nil {
-		return 0, err
+		logger.Error("Continuing without account alias: ", err.Error())
+		return
+	}
+	config.AccountAlias = alias
+	logger.Debugf("Resolved account alias %s", alias)
+}
+
+// reloadConfig rebuilds the config in place, the drains read it concurrently so it is only called before they
+// start or through reloadBetweenBatches
+func reloadConfig() {
+	// Updating in place since the consumer holds a pointer to the same config
+	newConfig, err := cfg.GetConfig()
+	configErr = err
+	if err != nil {
+		logger.Error("Error during Fetching Env Variables: ", err.Error())
+		// an invalid config fails the init in strict mode, later it keeps the valid one
+		if config.StrictConfig || newConfig.StrictConfig {
+			logger.Error("SUMO_CONFIG_STRICT is set, keeping the current config")
+			return
+		}
+	}
+	// the experiment group and the account alias are selected once per environment
+	newConfig.ExperimentGroup = config.ExperimentGroup
+	if newConfig.AccountAlias == "" {
+		newConfig.AccountAlias = config.AccountAlias
+	}
+	*config = *newConfig
+	logger.Logger.SetLevel(config.LogLevel)
+}
+
+// refreshDynamicSources reloads the config when the parameters, secrets or AppConfig profile it was read
+// from changed since the last SUMO_CONFIG_REFRESH_INTERVAL
+func refreshDynamicSources() {
+	changed, err := config.RefreshDynamicSources()
+	if err != nil {
+		logger.Error("Unable to refresh the config: ", err.Error())
+	}
+	if changed {
+		logger.Info("Reloading the config with the refreshed parameters and secrets")
+	}
+	reloadBetweenBatches(changed)
+}
+
+// refreshEndpointSecret fetches the secret of SUMO_HTTP_ENDPOINT_SECRET_ARN again every EndpointSecretTTL,
+// the posts use the rotated endpoint right away
+func refreshEndpointSecret() {
+	if config.EndpointSecretTTL == 0 {
+		return
+	}
+	changed, err := config.RefreshEndpointSecret(config.EndpointSecretTTL)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+	if changed {
+		logger.Info("Fetched a rotated endpoint from SUMO_HTTP_ENDPOINT_SECRET_ARN")
 	}
-	return nextResponse.DeadlineMs, nil
+}
+
+// pollAppConfig reloads the config when a new version of the AppConfig profile changed it
+func pollAppConfig() {
+	changed, err := config.PollAppConfig()
+	if err != nil {
+		logger.Error("Unable to poll SUMO_APPCONFIG_PROFILE: ", err.Error())
+	}
+	if changed {
+		logger.Info("Reloading the config from the AppConfig profile")
+	}
+	reloadBetweenBatches(changed)
+}
+
+// reloadBetweenBatches reloads the config when it changed or a reload is pending. The reload takes the
+// drain flag so that no batch is sent with a half updated config, and waits for the next invocation when a
+// drain is running.
+func reloadBetweenBatches(changed bool) {
+	if !changed && !reloadPending {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&draining, 0, 1) {
+		reloadPending = true
+		return
+	}
+	defer atomic.StoreInt32(&draining, 0)
+	reloadPending = false
+	reloadConfig()
+}
+
+// checkConfigDrift reports the config env vars changed since the config was loaded as an extension.configDrift
+// record, instead of silently using stale values for the lifetime of the environment, and reloads the config
+// when ReloadOnDrift is set. The settings used to create the dataQueue and the clients are not reloaded.
+func checkConfigDrift() {
+	changed := config.DetectDrift()
+	if len(changed) == 0 {
+		return
+	}
+	reload := config.ReloadOnDrift
+	logger.Warnf("Config env vars changed: %v", changed)
+	err := telemetry.EmitRecord(os.Stdout, "extension.configDrift", map[string]interface{}{
+		"extensionName": extensionName,
+		"changed":       changed,
+		"reloaded":      reload,
+	})
+	if err != nil {
+		logger.Error("Unable to emit config drift: ", err.Error())
+	}
+	reloadBetweenBatches(reload)
 }
 
 func nextEvent(ctx context.Context) (*lambdaapi.NextEventResponse, error) {
@@ -82,21 +532,211 @@ func nextEvent(ctx context.Context) (*lambdaapi.NextEventResponse, error) {
 	return nextResponse, nil
 }
 
+// updateDebugCapture logs everything at debug level while a debug capture is running
+func updateDebugCapture() {
+	level := config.LogLevel
+	if config.UpdateDebugCapture() && level < logrus.DebugLevel {
+		level = logrus.DebugLevel
+	}
+	if logger.Logger.GetLevel() != level {
+		logger.Logger.SetLevel(level)
+		if level == config.LogLevel {
+			logger.Info("Debug capture ended")
+		} else {
+			logger.Info("Debug capture started")
+		}
+	}
+}
+
+// emitTelemetry writes the extension counters to stdout, where the Logs API picks them up as extension records
+func emitTelemetry() {
+	if !config.EnableSelfTelemetry {
+		return
+	}
+	telemetry.SampleRuntime()
+	err := telemetry.Emit(os.Stdout, extensionName)
+	if err != nil {
+		logger.Error("Unable to emit self telemetry: ", err.Error())
+	}
+}
+
+// emitAnalytics writes the summary of the records shipped by this container, for teams looking for
+// what to cut to reduce their log volume. It is emitted once, when the container shuts down.
+func emitAnalytics() {
+	if !config.EnableAnalytics {
+		return
+	}
+	summary := analytics.Snapshot()
+	err := telemetry.EmitRecord(os.Stdout, "extension.analytics", map[string]interface{}{
+		"extensionName": extensionName,
+		"summary":       summary,
+	})
+	if err != nil {
+		logger.Error("Unable to emit analytics: ", err.Error())
+	}
+}
+
+// drainQueue waits sleep so that more records get batched before draining the queue
+func drainQueue(ctx context.Context, sleep time.Duration) {
+	if sleep > 0 {
+		time.Sleep(sleep)
+	}
+	drainOnce(ctx)
+}
+
+// drainOnce drains the queue, or has the drain already running drain it again once done so that the records
+// received meanwhile are not left until the next trigger. It returns the number of payloads sent and false
+// when the running drain was left to send them.
+func drainOnce(ctx context.Context) (int, bool) {
+	atomic.StoreInt32(&drainPending, 1)
+	sent, ran := 0, false
+	// checking drainPending again once draining is released, a drain may have been requested in between
+	for atomic.LoadInt32(&drainPending) == 1 && atomic.CompareAndSwapInt32(&draining, 0, 1) {
+		ran = true
+		for atomic.SwapInt32(&drainPending, 0) == 1 && ctx.Err() == nil {
+			sent += consumer.DrainQueue(ctx)
+		}
+		atomic.StoreInt32(&draining, 0)
+	}
+	return sent, ran
+}
+
+// drainOnFault drains the whole queue as soon as a platform.fault is received, oldest first so the
+// function lines leading to the crash go with it. The environment is reset after a crash and these
+// are the records which must not be lost, so they do not wait for the next invocation.
+func drainOnFault(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-producer.Faults():
+			logger.Debug("Received platform.fault, draining the queue")
+			// held is set until a drain sent payloads, the payloads coalesced across invocations may be held
+			// while the queue is empty, the config is not read here as it may be reloaded meanwhile
+			held := true
+			for (held || dataQueue.Len() > 0) && ctx.Err() == nil {
+				sent, ran := drainOnce(workers.WithoutCoalescing(ctx))
+				if !ran {
+					time.Sleep(faultDrainRetrySleep)
+				} else if sent == 0 {
+					break
+				} else {
+					held = false
+				}
+			}
+		}
+	}
+}
+
+// flushPeriodically drains the queue every FlushInterval, so that logs of long running invocations
+// reach Sumo Logic while the invocation runs instead of all at once when it ends.
+func flushPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			drainOnce(ctx)
+		}
+	}
+}
+
+// shutdown flushes the dataQueue within the deadline of the shutdown event and emits the last telemetry
+func shutdown(ctx context.Context, nextResponse *lambdaapi.NextEventResponse) {
+	flushCtx, cancelFlush := ctx, context.CancelFunc(func() {})
+	if nextResponse.DeadlineMs > 0 {
+		// leaving time to emit the telemetry before Lambda kills the extension at the deadline, converted
+		// to a timeout right away as the wall clock may have jumped while the environment was frozen
+		deadline := time.Unix(0, nextResponse.DeadlineMs*int64(time.Millisecond))
+		timeout := utils.UntilWallClock(deadline, maxShutdownDuration) - shutdownDeadlineMargin
+		flushCtx, cancelFlush = context.WithTimeout(ctx, timeout)
+	}
+	consumer.FlushDataQueue(flushCtx)
+	cancelFlush()
+	emitTelemetry()
+	emitAnalytics()
+}
+
+// waitForShutdown completes the registration and blocks until the shutdown event without subscribing, the
+// extension is registered for SHUTDOWN only when disabled
+func waitForShutdown(ctx context.Context) {
+	defer cancelInit()
+	select {
+	case result := <-registered:
+		if result.err != nil {
+			logger.Error("Error during Registration: ", result.err.Error())
+			reportAPIUnavailable(result.err)
+			return
+		}
+	case <-initCtx.Done():
+		logger.Errorf("Registration did not complete within %v: %v", initTimeout, initCtx.Err())
+		return
+	}
+	for {
+		nextResponse, err := nextEvent(ctx)
+		if err != nil {
+			logger.Error("Error during Next Event call: ", err.Error())
+			return
+		}
+		if nextResponse.EventType == lambdaapi.Shutdown {
+			return
+		}
+	}
+}
+
 // processEvents is - Will block until shutdown event is received or cancelled via the context..
 func processEvents(ctx context.Context) {
-	_, err := runTimeAPIInit()
+	err := runTimeAPIInit()
 	if err != nil {
 		logger.Error("Error during Registration: ", err.Error())
+		reportAPIUnavailable(err)
 		return
 	}
+	flushCtx, stopFlushing := context.WithCancel(ctx)
+	defer stopFlushing()
+	if config.FlushInterval > 0 {
+		go flushPeriodically(flushCtx, config.FlushInterval)
+	}
+	go drainOnFault(flushCtx)
+
+	// Call next to say registration is successful, when registered for SHUTDOWN only it returns on shutdown
+	// and the logs of all the invocations are sent by flushPeriodically meanwhile
+	nextResponse, err := nextEvent(nil)
+	if err != nil {
+		logger.Error("Error during Next Event call: ", err.Error())
+		return
+	}
+	if nextResponse.EventType == lambdaapi.Shutdown {
+		stopFlushing()
+		shutdown(ctx, nextResponse)
+		return
+	}
+	clockWatch := utils.NewClockWatch()
+	// requestID is the invocation the extension is working on, until it calls /event/next
+	requestID := nextResponse.RequestID
 	// The For loop will continue till we recieve a shutdown event.
 	for {
 		select {
 		case <-ctx.Done():
+			stopFlushing()
 			consumer.FlushDataQueue(ctx)
+			emitTelemetry()
+			emitAnalytics()
 			return
 		default:
-			go consumer.DrainQueue(ctx)
+			if autotuner != nil {
+				autotuner.Tune()
+			}
+			updateDebugCapture()
+			refreshDynamicSources()
+			refreshEndpointSecret()
+			pollAppConfig()
+			checkConfigDrift()
+			// the batch age is read before the drain, which runs while the next reload may happen
+			go drainQueue(ctx, consumer.ProcessingSleepTime())
+			sumoclient.RecordNextCall(requestID, time.Now())
 			// This statement will freeze lambda
 			nextResponse, err := nextEvent(ctx)
 			if err != nil {
@@ -105,10 +745,29 @@ func processEvents(ctx context.Context) {
 			}
 			// Next invoke will start from here
 			logger.Infof("Received Next Event as %s", nextResponse.EventType)
+			requestID = nextResponse.RequestID
+			if skew := clockWatch.Check(); skew != 0 {
+				telemetry.Add(telemetry.ClockJumps, 1)
+				logger.Warnf("Wall clock jumped by %v while waiting for the next event", skew)
+			}
+			if nextResponse.EventType == lambdaapi.Invoke && len(config.AliasEndpoints) > 0 {
+				cfg.SetInvokedFunctionArn(nextResponse.InvokedFunctionArn)
+				if config.Endpoint() == "" {
+					logger.Warnf("No endpoint in SUMO_ALIAS_ENDPOINT_MAP for %s and SUMO_HTTP_ENDPOINT is not set", nextResponse.InvokedFunctionArn)
+				}
+			}
+			if nextResponse.EventType == lambdaapi.Invoke && config.EnableXRay {
+				telemetry.SetTrace(nextResponse.Tracing.Value)
+			}
+			if nextResponse.EventType == lambdaapi.Invoke && heartbeat != nil {
+				heartbeat.Beat(nextResponse.RequestID)
+			}
 			if nextResponse.EventType == lambdaapi.Shutdown {
-				consumer.FlushDataQueue(ctx)
+				stopFlushing()
+				shutdown(ctx, nextResponse)
 				return
 			}
+			emitTelemetry()
 		}
 	}
 }
@@ -131,6 +790,10 @@ func main() {
 		}
 	}()
 	// Will block until shutdown event is received or cancelled via the context.
-	processEvents(ctx)
+	if disabled {
+		waitForShutdown(ctx)
+	} else {
+		processEvents(ctx)
+	}
 	logger.Info("Stopping the Sumo Logic Extension................")
 }
@@ -0,0 +1,69 @@
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// metricPrefix namespaces the exposed metrics
+	metricPrefix           = "sumo_extension_"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// WriteOpenMetrics writes the counters and the gauges in the OpenMetrics text format
+func WriteOpenMetrics(w io.Writer) error {
+	metrics := Snapshot()
+	mu.Lock()
+	isGauge := make(map[string]bool, len(gauges))
+	for name := range gauges {
+		isGauge[name] = true
+	}
+	mu.Unlock()
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		metricName := metricPrefix + snakeCase(name)
+		var err error
+		if isGauge[name] {
+			_, err = fmt.Fprintf(w, "# TYPE %s gauge\n%s %d\n", metricName, metricName, metrics[name])
+		} else {
+			_, err = fmt.Fprintf(w, "# TYPE %s counter\n%s_total %d\n", metricName, metricName, metrics[name])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "# EOF\n")
+	return err
+}
+
+// MetricsHandler serves the metrics to Prometheus compatible scrapers, sampling the runtime gauges on every scrape
+func MetricsHandler(writer http.ResponseWriter, request *http.Request) {
+	SampleRuntime()
+	writer.Header().Set("Content-Type", openMetricsContentType)
+	WriteOpenMetrics(writer)
+}
+
+// snakeCase converts the camelCase counter names, e.g. payloadsReceived to payloads_received
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,27 @@
+package telemetry
+
+import (
+	"io/ioutil"
+	"runtime"
+)
+
+// Gauge names for the resources of the extension process, sampled to detect leaks in warm containers
+const (
+	Goroutines  = "goroutines"
+	OpenFDs     = "openFds"
+	HeapInUse   = "heapInUseBytes"
+	procSelfFDs = "/proc/self/fd"
+)
+
+// SampleRuntime sets the goroutine, open file descriptor and heap gauges. It is called once per
+// invocation as reading the memory stats stops the world.
+func SampleRuntime() {
+	Set(Goroutines, int64(runtime.NumGoroutine()))
+	// only available on Linux, which is what Lambda runs
+	if fds, err := ioutil.ReadDir(procSelfFDs); err == nil {
+		Set(OpenFDs, int64(len(fds)))
+	}
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	Set(HeapInUse, int64(memStats.HeapInuse))
+}
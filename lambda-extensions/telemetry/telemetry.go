@@ -0,0 +1,179 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Counter names tracked by the extension
+const (
+	PayloadsReceived = "payloadsReceived"
+	BytesReceived    = "bytesReceived"
+	RecordsReceived  = "recordsReceived"
+	PayloadsRequeued = "payloadsRequeued"
+	PostsSucceeded   = "postsSucceeded"
+	PostsFailed      = "postsFailed"
+	PostRetries      = "postRetries"
+	FailoverUploads  = "failoverUploads"
+	FailoverErrors   = "failoverErrors"
+	PayloadsDropped  = "payloadsDropped"
+	LagBreaches      = "lagBreaches"
+	CatchUpObjects   = "catchUpObjects"
+	CatchUpBytes     = "catchUpBytes"
+	OwnLogsDropped   = "ownLogsDropped"
+	OverflowPayloads = "overflowPayloads"
+	CommitHookErrors = "commitHookErrors"
+	FaultsReceived   = "faultsReceived"
+	ClockJumps       = "clockJumps"
+	BreakerOpens     = "breakerOpens"
+	BreakerSkips     = "breakerSkips"
+	PayloadsExpired  = "payloadsExpired"
+	BatchesDeduped   = "batchesDeduped"
+	LinesTruncated   = "linesTruncated"
+	EndpointRotated  = "endpointRotated"
+	UncompressedSent = "uncompressedSent"
+	EnricherErrors   = "enricherErrors"
+	ScheduleDropped  = "scheduleDropped"
+	SecretsDetected  = "secretsDetected"
+	PayloadsMerged   = "payloadsMerged"
+	SlowInvocations  = "slowInvocations"
+)
+
+// Gauge names for the values chosen by the autotuner
+const (
+	AutotuneConcurrency      = "autotuneConcurrency"
+	AutotuneCompressionLevel = "autotuneCompressionLevel"
+	AutotuneBatchAgeMs       = "autotuneBatchAgeMs"
+)
+
+const (
+	// recordType is the type of the records emitted on stdout
+	recordType = "extension.telemetry"
+	// maxSpans bounds the spans kept between two emits
+	maxSpans = 100
+	// timeFormat matches the timestamps used by the Telemetry API
+	timeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+// Span is a timed unit of extension work, same shape as the spans of platform.runtimeDone
+type Span struct {
+	Name       string  `json:"name"`
+	Start      string  `json:"start"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+type telemetryRecord struct {
+	Time   string       `json:"time"`
+	Type   string       `json:"type"`
+	Record recordFields `json:"record"`
+}
+
+type recordFields struct {
+	ExtensionName string            `json:"extensionName"`
+	Metrics       map[string]int64  `json:"metrics"`
+	Spans         []Span            `json:"spans"`
+	Timings       map[string]Timing `json:"timings"`
+}
+
+var (
+	mu       sync.Mutex
+	counters = map[string]int64{}
+	// gauges are the names set with Set
+	gauges = map[string]bool{}
+	spans  []Span
+)
+
+// Add increments the named counter by delta
+func Add(name string, delta int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	counters[name] += delta
+}
+
+// Set overwrites the named counter, used for gauges
+func Set(name string, value int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	counters[name] = value
+	gauges[name] = true
+}
+
+// Snapshot returns a copy of all the counters
+func Snapshot() map[string]int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	snapshot := make(map[string]int64, len(counters))
+	for name, value := range counters {
+		snapshot[name] = value
+	}
+	return snapshot
+}
+
+// StartSpan starts timing a span and returns the function ending it
+func StartSpan(name string) func() {
+	traceID, parentID := currentTrace()
+	start := time.Now()
+	return func() {
+		end := time.Now()
+		mu.Lock()
+		defer mu.Unlock()
+		sendSubsegment(name, traceID, parentID, start, end)
+		if len(spans) >= maxSpans {
+			return
+		}
+		spans = append(spans, Span{
+			Name:       name,
+			Start:      start.UTC().Format(timeFormat),
+			DurationMs: float64(end.Sub(start).Microseconds()) / 1000,
+		})
+	}
+}
+
+// EmitRecord writes a record of recordType in the same format as the telemetry records
+func EmitRecord(w io.Writer, recordType string, record interface{}) error {
+	b, err := json.Marshal(map[string]interface{}{
+		"time":   time.Now().UTC().Format(timeFormat),
+		"type":   recordType,
+		"record": record,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// Emit writes the counters and the spans ended since the last Emit as a single json line.
+// The extension stdout is captured by the Lambda Logs/Telemetry API as "extension" records,
+// so every tool subscribed to it receives the extension health, not only Sumo Logic.
+func Emit(w io.Writer, extensionName string) error {
+	metrics := Snapshot()
+	mu.Lock()
+	endedSpans := spans
+	spans = nil
+	endedTimings := takeTimings()
+	mu.Unlock()
+
+	record := telemetryRecord{
+		Time: time.Now().UTC().Format(timeFormat),
+		Type: recordType,
+		Record: recordFields{
+			ExtensionName: extensionName,
+			Metrics:       metrics,
+			Spans:         endedSpans,
+			Timings:       endedTimings,
+		},
+	}
+	if record.Record.Spans == nil {
+		record.Record.Spans = []Span{}
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
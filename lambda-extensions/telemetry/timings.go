@@ -0,0 +1,51 @@
+package telemetry
+
+import (
+	"time"
+)
+
+// Timing names of the phases of the requests to the collector
+const (
+	DNSTiming     = "dnsMs"
+	ConnectTiming = "connectMs"
+	TLSTiming     = "tlsMs"
+	TTFBTiming    = "ttfbMs"
+)
+
+// Timing aggregates the durations observed since the last Emit
+type Timing struct {
+	Count int64   `json:"count"`
+	AvgMs float64 `json:"avgMs"`
+	MaxMs float64 `json:"maxMs"`
+	sumMs float64
+}
+
+var timings = map[string]*Timing{}
+
+// ObserveTiming adds a duration to the named timing
+func ObserveTiming(name string, d time.Duration) {
+	ms := float64(d.Microseconds()) / 1000
+	mu.Lock()
+	defer mu.Unlock()
+	timing, found := timings[name]
+	if !found {
+		timing = &Timing{}
+		timings[name] = timing
+	}
+	timing.Count++
+	timing.sumMs += ms
+	if ms > timing.MaxMs {
+		timing.MaxMs = ms
+	}
+}
+
+// takeTimings returns the timings observed since the last call and resets them, mu has to be held
+func takeTimings() map[string]Timing {
+	taken := make(map[string]Timing, len(timings))
+	for name, timing := range timings {
+		timing.AvgMs = timing.sumMs / float64(timing.Count)
+		taken[name] = *timing
+	}
+	timings = map[string]*Timing{}
+	return taken
+}
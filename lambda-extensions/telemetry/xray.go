@@ -0,0 +1,106 @@
+package telemetry
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+)
+
+// xrayHeader precedes every document sent to the X-Ray daemon
+const xrayHeader = "{\"format\": \"json\", \"version\": 1}\n"
+
+// xray is the X-Ray daemon the spans are sent to and the sampled invocation they are attached to, guarded by mu
+var xray struct {
+	conn     net.Conn
+	traceID  string
+	parentID string
+}
+
+// subsegment is the X-Ray document of a span
+type subsegment struct {
+	Name      string  `json:"name"`
+	ID        string  `json:"id"`
+	TraceID   string  `json:"trace_id"`
+	ParentID  string  `json:"parent_id"`
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Type      string  `json:"type"`
+}
+
+// EnableXRay sends the spans of the sampled invocations to the X-Ray daemon at address as subsegments of
+// the function segment, so that the extension work shows up in the traces of the function
+func EnableXRay(address string) error {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	xray.conn = conn
+	return nil
+}
+
+// SetTrace attaches the next spans to the invocation of an X-Amzn-Trace-Id header, they are not sent to
+// X-Ray when it is not sampled
+func SetTrace(header string) {
+	var traceID, parentID string
+	sampled := false
+	for _, part := range strings.Split(header, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "Root":
+			traceID = kv[1]
+		case "Parent":
+			parentID = kv[1]
+		case "Sampled":
+			sampled = kv[1] == "1"
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !sampled || traceID == "" || parentID == "" {
+		traceID, parentID = "", ""
+	}
+	xray.traceID, xray.parentID = traceID, parentID
+}
+
+// currentTrace returns the sampled invocation the spans started now belong to, empty when none
+func currentTrace() (string, string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if xray.conn == nil {
+		return "", ""
+	}
+	return xray.traceID, xray.parentID
+}
+
+// sendSubsegment sends a span to the X-Ray daemon, mu has to be held. The daemon is reached over UDP on
+// the same host, errors are ignored as for any X-Ray SDK.
+func sendSubsegment(name, traceID, parentID string, start, end time.Time) {
+	if xray.conn == nil || traceID == "" {
+		return
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return
+	}
+	b, err := json.Marshal(subsegment{
+		Name:      name,
+		ID:        hex.EncodeToString(id),
+		TraceID:   traceID,
+		ParentID:  parentID,
+		StartTime: float64(start.UnixNano()) / float64(time.Second),
+		EndTime:   float64(end.UnixNano()) / float64(time.Second),
+		Type:      "subsegment",
+	})
+	if err != nil {
+		return
+	}
+	xray.conn.Write(append([]byte(xrayHeader), b...))
+}
@@ -1,16 +1,54 @@
 package utils
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/appconfig"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
 )
 
-var uploader *s3manager.Uploader
-var sess *session.Session
+// ObjectStore is the storage of the failover payloads, an interface so that it can be replaced in tests
+type ObjectStore interface {
+	Upload(bucketName, keyName string, data io.Reader) error
+	Download(bucketName, keyName string) ([]byte, error)
+	Delete(bucketName, keyName string) error
+}
+
+// MetadataUploader is implemented by the ObjectStores which can attach user metadata to the objects uploaded
+type MetadataUploader interface {
+	UploadWithMetadata(bucketName, keyName string, data io.Reader, metadata map[string]string) error
+}
+
+// BucketProber is implemented by the ObjectStores which can check that the payloads can be written to a bucket
+type BucketProber interface {
+	ProbeBucket(ctx context.Context, bucketName, keyName string) error
+}
+
+// s3ObjectStore is the ObjectStore backed by S3
+type s3ObjectStore struct {
+	uploader   s3manageriface.UploaderAPI
+	downloader s3manageriface.DownloaderAPI
+	client     s3iface.S3API
+}
+
+var defaultObjectStore ObjectStore
 
 func init() {
 
@@ -20,23 +58,227 @@ func init() {
 		awsRegion = os.Getenv("AWS_REGION")
 	}
 
-	sess = session.Must(session.NewSession(&aws.Config{
+	sess := session.Must(session.NewSession(&aws.Config{
 		Region: aws.String(awsRegion)}))
 
-	// Create an uploader with the session and default options
-	uploader = s3manager.NewUploader(sess)
+	defaultObjectStore = NewS3ObjectStore(sess)
+}
 
+// NewS3ObjectStore returns an ObjectStore using the S3 clients of the session
+func NewS3ObjectStore(sess *session.Session) ObjectStore {
+	return &s3ObjectStore{
+		uploader:   s3manager.NewUploader(sess),
+		downloader: s3manager.NewDownloader(sess),
+		client:     s3.New(sess),
+	}
 }
 
-// UploadToS3 send data to S3
-func UploadToS3(bucketName *string, keyName *string, data io.Reader) error {
+// DefaultObjectStore returns the ObjectStore in the region of SUMO_S3_BUCKET_REGION or AWS_REGION
+func DefaultObjectStore() ObjectStore {
+	return defaultObjectStore
+}
+
+func (store *s3ObjectStore) Upload(bucketName, keyName string, data io.Reader) error {
+	return store.UploadWithMetadata(bucketName, keyName, data, nil)
+}
 
+func (store *s3ObjectStore) UploadWithMetadata(bucketName, keyName string, data io.Reader, metadata map[string]string) error {
 	upParams := &s3manager.UploadInput{
-		Bucket: bucketName,
-		Key:    keyName,
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(keyName),
 		Body:   data,
 	}
-	_, err := uploader.Upload(upParams)
+	if len(metadata) > 0 {
+		upParams.Metadata = aws.StringMap(metadata)
+	}
+	_, err := store.uploader.Upload(upParams)
 
 	return err
 }
+
+func (store *s3ObjectStore) Download(bucketName, keyName string) ([]byte, error) {
+	buf := aws.NewWriteAtBuffer([]byte{})
+	_, err := store.downloader.Download(buf, &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(keyName),
+	})
+	return buf.Bytes(), err
+}
+
+func (store *s3ObjectStore) Delete(bucketName, keyName string) error {
+	_, err := store.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(keyName),
+	})
+	return err
+}
+
+// ProbeBucket checks that the bucket exists in the region of the store and writes and removes an empty object
+// at keyName. HeadBucket needs s3:ListBucket, which the failover does not, so a denied HeadBucket is left to
+// the write. The empty object is left in the bucket when the role is not allowed s3:DeleteObject.
+func (store *s3ObjectStore) ProbeBucket(ctx context.Context, bucketName, keyName string) error {
+	_, err := store.client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucketName)})
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		switch reqErr.StatusCode() {
+		case http.StatusNotFound:
+			return fmt.Errorf("the bucket %s does not exist", bucketName)
+		case http.StatusMovedPermanently:
+			return fmt.Errorf("the bucket %s is not in the region of SUMO_S3_BUCKET_REGION or AWS_REGION", bucketName)
+		}
+	}
+	_, err = store.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(keyName),
+		Body:   bytes.NewReader(nil),
+	})
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusForbidden {
+		return fmt.Errorf("the function role is not allowed s3:PutObject on the bucket %s: %v", bucketName, reqErr.Message())
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write to the bucket %s: %v", bucketName, err)
+	}
+	store.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(keyName),
+	})
+	return nil
+}
+
+// UploadToS3 send data to S3
+func UploadToS3(bucketName *string, keyName *string, data io.Reader) error {
+	return defaultObjectStore.Upload(*bucketName, *keyName, data)
+}
+
+// DownloadFromS3 returns the content of an object from S3
+func DownloadFromS3(bucketName *string, keyName *string) ([]byte, error) {
+	return defaultObjectStore.Download(*bucketName, *keyName)
+}
+
+// DeleteFromS3 removes an object from S3
+func DeleteFromS3(bucketName *string, keyName *string) error {
+	return defaultObjectStore.Delete(*bucketName, *keyName)
+}
+
+// GetAccountAlias returns the alias of the account the function runs in, empty when the account has none.
+// It needs the iam:ListAccountAliases permission in the function role.
+func GetAccountAlias(ctx context.Context) (string, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION"))})
+	if err != nil {
+		return "", err
+	}
+	output, err := iam.New(sess).ListAccountAliasesWithContext(ctx, &iam.ListAccountAliasesInput{})
+	if err != nil {
+		return "", err
+	}
+	// an account has at most one alias
+	if len(output.AccountAliases) == 0 {
+		return "", nil
+	}
+	return aws.StringValue(output.AccountAliases[0]), nil
+}
+
+// GetSecretString returns the string value of a Secrets Manager secret, in the region of its ARN. The SDK
+// retries throttled and failed calls numRetry times. It needs the secretsmanager:GetSecretValue permission
+// in the function role.
+func GetSecretString(ctx context.Context, secretARN string, numRetry int) (string, error) {
+	region := os.Getenv("AWS_REGION")
+	if parsed, err := arn.Parse(secretARN); err == nil {
+		region = parsed.Region
+	}
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(region), MaxRetries: aws.Int(numRetry)})
+	if err != nil {
+		return "", err
+	}
+	output, err := secretsmanager.New(sess).GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretARN),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+		return "", fmt.Errorf("secret %s does not exist", secretARN)
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.SecretString), nil
+}
+
+// GetParameter returns the value of an SSM parameter, decrypting SecureString parameters, in the region of
+// its ARN when it is one. The SDK retries throttled and failed calls numRetry times. It needs the
+// ssm:GetParameter permission in the function role, and kms:Decrypt for SecureString parameters encrypted
+// with a customer managed key.
+func GetParameter(ctx context.Context, name string, numRetry int) (string, error) {
+	region := os.Getenv("AWS_REGION")
+	if parsed, err := arn.Parse(name); err == nil {
+		region = parsed.Region
+	}
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(region), MaxRetries: aws.Int(numRetry)})
+	if err != nil {
+		return "", err
+	}
+	output, err := ssm.New(sess).GetParameterWithContext(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ssm.ErrCodeParameterNotFound {
+		return "", fmt.Errorf("parameter %s does not exist", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.Parameter.Value), nil
+}
+
+// GetAppConfiguration returns the content and the version of an AppConfig configuration profile, the content
+// is empty when clientVersion is the latest version. It needs the appconfig:GetConfiguration permission in
+// the function role.
+func GetAppConfiguration(ctx context.Context, application, environment, profile, clientID, clientVersion string, numRetry int) ([]byte, string, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION")), MaxRetries: aws.Int(numRetry)})
+	if err != nil {
+		return nil, "", err
+	}
+	input := &appconfig.GetConfigurationInput{
+		Application:   aws.String(application),
+		Environment:   aws.String(environment),
+		Configuration: aws.String(profile),
+		ClientId:      aws.String(clientID),
+	}
+	if clientVersion != "" {
+		input.ClientConfigurationVersion = aws.String(clientVersion)
+	}
+	output, err := appconfig.New(sess).GetConfigurationWithContext(ctx, input)
+	if err != nil {
+		return nil, "", err
+	}
+	return output.Content, aws.StringValue(output.ConfigurationVersion), nil
+}
+
+// Decrypt returns the plaintext of a KMS ciphertext. The ciphertext is decrypted with the encryption context
+// first, as done by the encryption helpers of the Lambda console, and then without it. It needs the
+// kms:Decrypt permission on the key in the function role.
+func Decrypt(ctx context.Context, ciphertext []byte, encryptionContext map[string]string, numRetry int) ([]byte, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION")), MaxRetries: aws.Int(numRetry)})
+	if err != nil {
+		return nil, err
+	}
+	client := kms.New(sess)
+	output, err := client.DecryptWithContext(ctx, &kms.DecryptInput{
+		CiphertextBlob:    ciphertext,
+		EncryptionContext: aws.StringMap(encryptionContext),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == kms.ErrCodeInvalidCiphertextException && len(encryptionContext) > 0 {
+		output, err = client.DecryptWithContext(ctx, &kms.DecryptInput{CiphertextBlob: ciphertext})
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case kms.ErrCodeInvalidCiphertextException:
+			return nil, errors.New("the ciphertext is invalid or was encrypted with another encryption context")
+		case "AccessDeniedException":
+			return nil, fmt.Errorf("the function role is not allowed kms:Decrypt on the key: %v", aerr.Message())
+		case kms.ErrCodeDisabledException, kms.ErrCodeNotFoundException:
+			return nil, fmt.Errorf("the key is disabled or does not exist: %v", aerr.Message())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return output.Plaintext, nil
+}
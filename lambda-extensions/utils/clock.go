@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"time"
+)
+
+// maxClockSkew is the drift between the wall clock and the monotonic clock reported as a jump
+const maxClockSkew = time.Second
+
+// ClockWatch detects jumps of the wall clock, e.g. the NTP corrections after the execution environment thaws.
+// Durations in the extension are measured on the monotonic clock, the wall clock only matters for the
+// timestamps received from Lambda.
+type ClockWatch struct {
+	last time.Time
+}
+
+// NewClockWatch returns a ClockWatch starting now
+func NewClockWatch() *ClockWatch {
+	return &ClockWatch{last: time.Now()}
+}
+
+// Check returns how far the wall clock jumped since the last Check, 0 when it moved with the monotonic clock
+func (c *ClockWatch) Check() time.Duration {
+	now := time.Now()
+	elapsed := now.Sub(c.last)
+	// Round(0) strips the monotonic reading so that Sub uses the wall clock
+	wallElapsed := now.Round(0).Sub(c.last.Round(0))
+	c.last = now
+	if skew := wallElapsed - elapsed; skew >= maxClockSkew || skew <= -maxClockSkew {
+		return skew
+	}
+	return 0
+}
+
+// Since returns the time elapsed since t, which is never negative even for times without monotonic reading
+func Since(t time.Time) time.Duration {
+	if elapsed := time.Since(t); elapsed > 0 {
+		return elapsed
+	}
+	return 0
+}
+
+// UntilWallClock converts a wall clock deadline received from Lambda to a duration on the monotonic clock.
+// A deadline already passed or further than max away is the result of a skewed clock and max is returned.
+func UntilWallClock(deadline time.Time, max time.Duration) time.Duration {
+	remaining := time.Until(deadline)
+	if remaining <= 0 || remaining > max {
+		return max
+	}
+	return remaining
+}
@@ -5,6 +5,9 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"errors"
+	"io"
+	"io/ioutil"
+	"unicode/utf8"
 )
 
 //------------------Retry Logic Code-------------------------------
@@ -43,11 +46,35 @@ func StringInSlice(a string, list []string) bool {
 	return false
 }
 
+// TruncateUTF8 cuts s to at most maxBytes on a rune boundary, so that no multi-byte character is split, and
+// returns the number of bytes omitted
+func TruncateUTF8(s string, maxBytes int) (string, int) {
+	if len(s) <= maxBytes {
+		return s, 0
+	}
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut], len(s) - cut
+}
+
 // Compress compresses string and returns byte array
 func Compress(logStringToSend *string) []byte {
+	return CompressWithLevel(logStringToSend, gzip.DefaultCompression)
+}
+
+// CompressWithLevel compresses string with the given gzip level and returns byte array
+func CompressWithLevel(logStringToSend *string, level int) []byte {
 
 	var buf bytes.Buffer
-	g := gzip.NewWriter(&buf)
+	g, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		g = gzip.NewWriter(&buf)
+	}
 	g.Write([]byte(*logStringToSend))
 	g.Close()
 	return buf.Bytes()
@@ -63,6 +90,50 @@ func CompressBuffer(inputbuf *bytes.Buffer) *bytes.Buffer {
 	return &outputbuf
 }
 
+// Decompress returns the content of gzipped data
+func Decompress(data []byte) ([]byte, error) {
+	g, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer g.Close()
+	return ioutil.ReadAll(g)
+}
+
+// compressedStream is the reader side of CompressStream
+type compressedStream struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+// Close stops the producer and waits for it to return
+func (cs *compressedStream) Close() error {
+	err := cs.PipeReader.Close()
+	<-cs.done
+	return err
+}
+
+// CompressStream returns a reader of the gzipped output of write, compressed on the fly while being read
+// so that neither the raw nor the compressed payload has to be materialized in memory.
+func CompressStream(write func(io.Writer) error, level int) io.ReadCloser {
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g, err := gzip.NewWriterLevel(writer, level)
+		if err != nil {
+			g = gzip.NewWriter(writer)
+		}
+		err = write(g)
+		if err == nil {
+			err = g.Close()
+		}
+		// a nil error is seen as EOF by the reader
+		writer.CloseWithError(err)
+	}()
+	return &compressedStream{PipeReader: reader, done: done}
+}
+
 // PrettyPrint is to print the object
 func PrettyPrint(v interface{}) string {
 	data, err := json.MarshalIndent(v, "", "\t")
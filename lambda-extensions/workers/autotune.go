@@ -0,0 +1,108 @@
+package workers
+
+import (
+	"compress/gzip"
+	"time"
+
+	cfg "github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// highVolumeBytesPerSec is the rate above which compression favours speed over ratio
+	highVolumeBytesPerSec = 1024 * 1024
+	// lowVolumeRecordsPerSec is the rate below which draining waits for records to accumulate
+	lowVolumeRecordsPerSec = 10
+)
+
+// tuning is the settings chosen by the Autotuner. The settings the user set explicitly are not tuned, a zero
+// concurrency or an unset tuneBatchAge keeps the configured value.
+type tuning struct {
+	concurrency      int
+	compressionLevel int
+	batchAge         time.Duration
+	tuneBatchAge     bool
+}
+
+// tunable is implemented by the consumers applying the settings chosen by the Autotuner. They keep them
+// apart from the config, which the drains read while the Autotuner runs.
+type tunable interface {
+	applyTuning(tuning)
+}
+
+// Autotuner adjusts concurrency, compression and batch age from the log volume observed over the container lifetime
+type Autotuner struct {
+	config *cfg.LambdaExtensionConfig
+	logger *logrus.Entry
+	target tunable
+	start  time.Time
+	// tuneConcurrency and tuneBatchAge are false for the settings set in SUMO_MAX_CONCURRENT_REQUESTS and
+	// SUMO_PROCESSING_SLEEP_TIME_MS
+	tuneConcurrency bool
+	tuneBatchAge    bool
+}
+
+// NewAutotuner returns an Autotuner observing from now and tuning consumer
+func NewAutotuner(config *cfg.LambdaExtensionConfig, logger *logrus.Entry, consumer TaskConsumer) *Autotuner {
+	sources := config.Sources()
+	_, concurrencySet := sources["SUMO_MAX_CONCURRENT_REQUESTS"]
+	_, batchAgeSet := sources["SUMO_PROCESSING_SLEEP_TIME_MS"]
+	target, _ := consumer.(tunable)
+	return &Autotuner{
+		config:          config,
+		logger:          logger,
+		target:          target,
+		start:           time.Now(),
+		tuneConcurrency: !concurrencySet,
+		tuneBatchAge:    !batchAgeSet,
+	}
+}
+
+// Tune applies the settings chosen from the observed records/s and bytes/s to the consumer and reports them
+func (a *Autotuner) Tune() {
+	elapsed := time.Since(a.start).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	counters := telemetry.Snapshot()
+	bytesPerSec := float64(counters[telemetry.BytesReceived]) / elapsed
+	recordsPerSec := float64(counters[telemetry.RecordsReceived]) / elapsed
+
+	chosen := a.choose(bytesPerSec, recordsPerSec)
+	if a.target != nil {
+		a.target.applyTuning(chosen)
+	}
+	a.logger.Debugf("Autotune - records/s: %.2f bytes/s: %.2f concurrency: %d compression: %d batchAge: %v",
+		recordsPerSec, bytesPerSec, chosen.concurrency, chosen.compressionLevel, chosen.batchAge)
+
+	telemetry.Set(telemetry.AutotuneConcurrency, int64(chosen.concurrency))
+	telemetry.Set(telemetry.AutotuneCompressionLevel, int64(chosen.compressionLevel))
+	telemetry.Set(telemetry.AutotuneBatchAgeMs, chosen.batchAge.Milliseconds())
+}
+
+// choose returns the settings for the observed rates
+func (a *Autotuner) choose(bytesPerSec, recordsPerSec float64) tuning {
+	chosen := tuning{compressionLevel: gzip.DefaultCompression, tuneBatchAge: a.tuneBatchAge}
+
+	if a.tuneConcurrency {
+		// one request per payload worth of data received each second, within bounds
+		chosen.concurrency = int(bytesPerSec/float64(a.config.MaxDataPayloadSize)) + 1
+		if chosen.concurrency > a.config.AutotuneMaxConcurrency {
+			chosen.concurrency = a.config.AutotuneMaxConcurrency
+		}
+		if chosen.concurrency < 1 {
+			chosen.concurrency = 1
+		}
+	}
+
+	if bytesPerSec > highVolumeBytesPerSec {
+		chosen.compressionLevel = gzip.BestSpeed
+	}
+
+	if a.tuneBatchAge && recordsPerSec < lowVolumeRecordsPerSec {
+		chosen.batchAge = a.config.AutotuneMaxBatchAge
+	}
+	return chosen
+}
@@ -0,0 +1,83 @@
+package workers
+
+import (
+	"compress/gzip"
+	"fmt"
+	"testing"
+	"time"
+
+	cfg "github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+func assertEqual(t *testing.T, a interface{}, b interface{}, message string) {
+	if a == b {
+		return
+	}
+	if len(message) == 0 {
+		message = fmt.Sprintf("%v != %v", a, b)
+	}
+	t.Error(message)
+}
+
+func newTestConfig(t *testing.T, values map[string]string) *cfg.LambdaExtensionConfig {
+	config, err := cfg.New(cfg.WithoutProcessEnv(), cfg.WithEndpoint("https://localhost/receiver"), cfg.WithEnv(values))
+	if err != nil {
+		t.Fatalf("Unable to build the config: %v", err)
+	}
+	return config
+}
+
+func TestAutotuneConvergence(t *testing.T) {
+	logger := logrus.New().WithField("Name", "sumologic-extension")
+	config := newTestConfig(t, map[string]string{"SUMO_AUTOTUNE_MAX_CONCURRENT_REQUESTS": "4"})
+	tuner := NewAutotuner(config, logger, nil)
+	payload := float64(config.MaxDataPayloadSize)
+
+	tests := []struct {
+		name             string
+		bytesPerSec      float64
+		recordsPerSec    float64
+		concurrency      int
+		compressionLevel int
+		batchAge         time.Duration
+	}{
+		{"idle", 0, 0, 1, gzip.DefaultCompression, config.AutotuneMaxBatchAge},
+		{"low volume", payload / 2, 5, 1, gzip.DefaultCompression, config.AutotuneMaxBatchAge},
+		{"steady", 2 * payload, 100, 3, gzip.BestSpeed, 0},
+		{"bounded", 100 * payload, 10000, 4, gzip.BestSpeed, 0},
+	}
+	previous := 0
+	for _, test := range tests {
+		chosen := tuner.choose(test.bytesPerSec, test.recordsPerSec)
+		assertEqual(t, chosen.concurrency, test.concurrency, fmt.Sprintf("%s: concurrency %d != %d", test.name, chosen.concurrency, test.concurrency))
+		assertEqual(t, chosen.compressionLevel, test.compressionLevel, fmt.Sprintf("%s: compression %d != %d", test.name, chosen.compressionLevel, test.compressionLevel))
+		assertEqual(t, chosen.batchAge, test.batchAge, fmt.Sprintf("%s: batch age %v != %v", test.name, chosen.batchAge, test.batchAge))
+		assertEqual(t, chosen.concurrency >= previous, true, fmt.Sprintf("%s: concurrency should grow with the volume", test.name))
+		previous = chosen.concurrency
+	}
+}
+
+func TestAutotuneKeepsUserSettings(t *testing.T) {
+	logger := logrus.New().WithField("Name", "sumologic-extension")
+	config := newTestConfig(t, map[string]string{
+		"SUMO_MAX_CONCURRENT_REQUESTS":  "2",
+		"SUMO_PROCESSING_SLEEP_TIME_MS": "50",
+	})
+	consumer := NewTaskConsumerWithSender(NewChannelQueue(1), config, logger, nil).(*sumoConsumer)
+	tuner := NewAutotuner(config, logger, consumer)
+
+	consumer.applyTuning(tuner.choose(float64(100*config.MaxDataPayloadSize), 0))
+	assertEqual(t, consumer.maxConcurrentRequests(), 2, "concurrency set by the user should not be tuned")
+	assertEqual(t, consumer.ProcessingSleepTime(), 50*time.Millisecond, "batch age set by the user should not be tuned")
+	assertEqual(t, config.MaxConcurrentRequests, 2, "config should not be changed by the tuning")
+
+	config = newTestConfig(t, nil)
+	consumer = NewTaskConsumerWithSender(NewChannelQueue(1), config, logger, nil).(*sumoConsumer)
+	tuner = NewAutotuner(config, logger, consumer)
+	consumer.applyTuning(tuner.choose(float64(100*config.MaxDataPayloadSize), 0))
+	assertEqual(t, consumer.maxConcurrentRequests(), config.AutotuneMaxConcurrency, "unset concurrency should be tuned")
+	assertEqual(t, consumer.ProcessingSleepTime(), config.AutotuneMaxBatchAge, "unset batch age should be tuned")
+	assertEqual(t, config.ProcessingSleepTime, time.Duration(0), "config should not be changed by the tuning")
+}
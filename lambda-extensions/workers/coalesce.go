@@ -0,0 +1,108 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// coalescedPayloads are the payloads held across invocations while they are fewer than CoalesceMaxBytes and
+// younger than CoalesceMaxAge, so that a function logging a few lines every few minutes does not post a
+// near empty batch per invocation
+type coalescedPayloads struct {
+	mu    sync.Mutex
+	items []QueueItem
+	bytes int
+}
+
+type noCoalescingKey struct{}
+
+// WithoutCoalescing drains the held payloads with the queue whatever their size and age, as when the
+// environment is about to be reset after a platform.fault
+func WithoutCoalescing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCoalescingKey{}, true)
+}
+
+func coalescingDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noCoalescingKey{}).(bool)
+	return disabled
+}
+
+// coalesce moves the queued payloads to the held ones until CoalesceMaxBytes are held. Once enough bytes are
+// held or the oldest one is CoalesceMaxAge old, it returns them merged and true.
+func (sc *sumoConsumer) coalesce(ctx context.Context) ([]QueueItem, bool) {
+	held := &sc.coalesced
+	held.mu.Lock()
+	defer held.mu.Unlock()
+	for held.bytes < sc.config.CoalesceMaxBytes {
+		item, ok := sc.dataQueue.Pop()
+		if !ok {
+			break
+		}
+		held.items = append(held.items, item)
+		held.bytes += len(item.Payload)
+	}
+	if len(held.items) == 0 {
+		return nil, false
+	}
+	if held.bytes < sc.config.CoalesceMaxBytes && utils.Since(held.items[0].EnqueuedAt) < sc.config.CoalesceMaxAge && !coalescingDisabled(ctx) {
+		sc.logger.Debugf("Holding %d payloads of %d bytes until more logs are received", len(held.items), held.bytes)
+		return nil, false
+	}
+	return sc.takeCoalesced(), true
+}
+
+// takeCoalesced returns the held payloads merged and empties them, the caller holds the lock
+func (sc *sumoConsumer) takeCoalesced() []QueueItem {
+	held := &sc.coalesced
+	if len(held.items) == 0 {
+		return nil
+	}
+	merged := mergePayloads(held.items)
+	telemetry.Add(telemetry.PayloadsMerged, int64(len(held.items)-len(merged)))
+	held.items, held.bytes = nil, 0
+	return merged
+}
+
+// mergePayloads joins the json arrays of the Logs API payloads received for the same alias into one payload
+// with the enqueue time of the oldest, the payloads which are not arrays are kept as they are
+func mergePayloads(items []QueueItem) []QueueItem {
+	var kept []QueueItem
+	var aliases []string
+	merged := make(map[string]*QueueItem)
+	bodies := make(map[string]*bytes.Buffer)
+	for _, item := range items {
+		payload := bytes.TrimSpace(item.Payload)
+		if len(payload) < 2 || payload[0] != '[' || payload[len(payload)-1] != ']' {
+			kept = append(kept, item)
+			continue
+		}
+		records := bytes.TrimSpace(payload[1 : len(payload)-1])
+		if len(records) == 0 {
+			continue
+		}
+		body, ok := bodies[item.Alias]
+		if !ok {
+			aliases = append(aliases, item.Alias)
+			body = bytes.NewBufferString("[")
+			bodies[item.Alias] = body
+			merged[item.Alias] = &QueueItem{Alias: item.Alias, EnqueuedAt: item.EnqueuedAt}
+		} else {
+			body.WriteByte(',')
+		}
+		body.Write(records)
+		if item.EnqueuedAt.Before(merged[item.Alias].EnqueuedAt) {
+			merged[item.Alias].EnqueuedAt = item.EnqueuedAt
+		}
+	}
+	result := make([]QueueItem, 0, len(aliases)+len(kept))
+	for _, alias := range aliases {
+		bodies[alias].WriteByte(']')
+		merged[alias].Payload = bodies[alias].Bytes()
+		result = append(result, *merged[alias])
+	}
+	return append(result, kept...)
+}
@@ -2,10 +2,15 @@ package workers
 
 import (
 	"context"
+	"encoding/json"
+	"sort"
 	"sync"
+	"time"
 
 	cfg "github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
 	sumocli "github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/sumoclient"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
 
 	"github.com/sirupsen/logrus"
 )
@@ -14,90 +19,275 @@ import (
 type TaskConsumer interface {
 	FlushDataQueue(context.Context)
 	DrainQueue(context.Context) int
+	ProcessingSleepTime() time.Duration
 }
 
 // sumoConsumer to drain log from dataQueue
 type sumoConsumer struct {
-	dataQueue  chan []byte
+	dataQueue  DataQueue
 	logger     *logrus.Entry
 	config     *cfg.LambdaExtensionConfig
 	sumoclient sumocli.LogSender
+	pool       *workerPool
+	coalesced  coalescedPayloads
+	// tuned holds the settings chosen by the Autotuner, guarded by tunedMu as the drains read them while it tunes
+	tunedMu sync.Mutex
+	tuned   tuning
 }
 
 // NewTaskConsumer returns a new consumer
-func NewTaskConsumer(consumerQueue chan []byte, config *cfg.LambdaExtensionConfig, logger *logrus.Entry) TaskConsumer {
-	return &sumoConsumer{
+func NewTaskConsumer(consumerQueue DataQueue, config *cfg.LambdaExtensionConfig, logger *logrus.Entry) TaskConsumer {
+	return NewTaskConsumerWithSender(consumerQueue, config, logger, sumocli.NewLogSenderClient(logger, config))
+}
+
+// NewTaskConsumerWithSender returns a new consumer sending the payloads with logSender
+func NewTaskConsumerWithSender(consumerQueue DataQueue, config *cfg.LambdaExtensionConfig, logger *logrus.Entry, logSender sumocli.LogSender) TaskConsumer {
+	sc := &sumoConsumer{
 		dataQueue:  consumerQueue,
 		logger:     logger,
-		sumoclient: sumocli.NewLogSenderClient(logger, config),
+		sumoclient: logSender,
 		config:     config,
 	}
+	sc.pool = newWorkerPool(sc.consumeTask)
+	return sc
 }
 
-// FlushDataQueue drains the dataqueue commpletely
+// applyTuning keeps the settings chosen by the Autotuner, the compression level goes to the senders supporting it
+func (sc *sumoConsumer) applyTuning(chosen tuning) {
+	sc.tunedMu.Lock()
+	sc.tuned = chosen
+	sc.tunedMu.Unlock()
+	if tuner, ok := sc.sumoclient.(sumocli.CompressionTuner); ok {
+		tuner.SetCompressionLevel(chosen.compressionLevel)
+	}
+}
+
+// maxConcurrentRequests returns the concurrency chosen by the Autotuner or MaxConcurrentRequests
+func (sc *sumoConsumer) maxConcurrentRequests() int {
+	sc.tunedMu.Lock()
+	defer sc.tunedMu.Unlock()
+	if sc.tuned.concurrency > 0 {
+		return sc.tuned.concurrency
+	}
+	return sc.config.MaxConcurrentRequests
+}
+
+// ProcessingSleepTime returns the batch age chosen by the Autotuner or ProcessingSleepTime
+func (sc *sumoConsumer) ProcessingSleepTime() time.Duration {
+	sc.tunedMu.Lock()
+	defer sc.tunedMu.Unlock()
+	if sc.tuned.tuneBatchAge {
+		return sc.tuned.batchAge
+	}
+	return sc.config.ProcessingSleepTime
+}
+
+// FlushDataQueue drains the dataqueue commpletely, oldest payloads first. Requeued payloads keep their
+// original age, so they are sent before the ones received after them. Without failover, payloads are
+// sent until ctx is done, which happens at the shutdown deadline, and the newest ones left are dropped.
 func (sc *sumoConsumer) FlushDataQueue(ctx context.Context) {
+	defer telemetry.StartSpan("flushDataQueue")()
+	var items []QueueItem
+	// Pop returns false when the queue is empty.
+	for item, ok := sc.dataQueue.Pop(); ok; item, ok = sc.dataQueue.Pop() {
+		items = append(items, item)
+	}
+	// the payloads held across invocations are always sent on shutdown
+	sc.coalesced.mu.Lock()
+	items = append(items, sc.takeCoalesced()...)
+	sc.coalesced.mu.Unlock()
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].EnqueuedAt.Before(items[j].EnqueuedAt)
+	})
+	items, expired := sc.dropExpired(items)
+	if len(expired) > 0 {
+		items = append(items, QueueItem{Payload: sc.spillExpiredEvent(expired), EnqueuedAt: time.Now()})
+	}
 	if sc.config.EnableFailover {
-		var rawMsgArr [][]byte
-	Loop:
-		for {
-			//Receives block when the buffer is empty.
-			select {
-			case rawmsg := <-sc.dataQueue:
-				rawMsgArr = append(rawMsgArr, rawmsg)
-			default:
-				err := sc.sumoclient.FlushAll(rawMsgArr)
-				if err != nil {
-					sc.logger.Errorln("Unable to flush DataQueue", err.Error())
-					// putting back all the msg to the queue in case of failure
-					for _, msg := range rawMsgArr {
-						sc.dataQueue <- msg
-					}
-					// TODO: raise alert if flush fails
-				}
-				close(sc.dataQueue)
-				sc.logger.Debugf("DataQueue completely drained")
-				break Loop
-			}
-		}
+		sc.flushFailover(ctx, items)
+		sc.dataQueue.Close()
+		sc.logger.Debugf("DataQueue completely drained")
 	} else {
-		// calling drainqueue (during shutdown) if failover is not enabled
-		maxCallsNeededForCompleteDraining := (len(sc.dataQueue) / sc.config.MaxConcurrentRequests) + 1
-		for i := 0; i < maxCallsNeededForCompleteDraining; i++ {
-			sc.DrainQueue(ctx)
+		// sending MaxConcurrentRequests payloads at a time (during shutdown) if failover is not enabled
+		concurrency := sc.maxConcurrentRequests()
+		for sent := 0; sent < len(items); sent += concurrency {
+			if ctx.Err() != nil {
+				telemetry.Add(telemetry.PayloadsDropped, int64(len(items)-sent))
+				sc.logger.Errorf("Dropping the %d newest payloads, no time left to send them: %v", len(items)-sent, ctx.Err())
+				break
+			}
+			end := sent + concurrency
+			if end > len(items) {
+				end = len(items)
+			}
+			wg := new(sync.WaitGroup)
+			for _, item := range items[sent:end] {
+				sc.submit(ctx, wg, item, concurrency)
+			}
+			wg.Wait()
 		}
 	}
 
 }
 
-func (sc *sumoConsumer) consumeTask(ctx context.Context, wg *sync.WaitGroup, rawmsg []byte) {
-	defer wg.Done()
-	err := sc.sumoclient.SendLogs(ctx, rawmsg)
+// lagBreachEvent returns a record in the Logs API format reporting that queued records waited longer than MaxRecordAge.
+// It is sent like any other record so shipping lag can be alerted on directly from Sumo Logic.
+func (sc *sumoConsumer) lagBreachEvent(oldestAge time.Duration) []byte {
+	telemetry.Add(telemetry.LagBreaches, 1)
+	counters := telemetry.Snapshot()
+	event, err := json.Marshal([]map[string]interface{}{{
+		"time": time.Now().UTC().Format(time.RFC3339Nano),
+		"type": "extension.lagBreach",
+		"record": map[string]interface{}{
+			"oldestRecordAgeSec": oldestAge.Seconds(),
+			"maxRecordAgeSec":    sc.config.MaxRecordAge.Seconds(),
+			"queueLength":        sc.dataQueue.Len(),
+			"payloadsRequeued":   counters[telemetry.PayloadsRequeued],
+			"payloadsDropped":    counters[telemetry.PayloadsDropped],
+		},
+	}})
+	if err != nil {
+		sc.logger.Error("Unable to create lag breach event: ", err.Error())
+		return nil
+	}
+	sc.logger.Warnf("Records waited %v in the queue, more than the maximum of %v", oldestAge, sc.config.MaxRecordAge)
+	return event
+}
+
+// flushFailover writes the payloads to the failover bucket in one object per alias, so that catch-up replays
+// them to the endpoint of their alias. Items are sorted by the time they were received, the object of an alias
+// keeps the age of its oldest payload.
+func (sc *sumoConsumer) flushFailover(ctx context.Context, items []QueueItem) {
+	var aliases []string
+	groups := make(map[string][]QueueItem)
+	for _, item := range items {
+		alias := item.Alias
+		if alias == "" {
+			alias = cfg.InvokedQualifier()
+		}
+		if _, ok := groups[alias]; !ok {
+			aliases = append(aliases, alias)
+		}
+		groups[alias] = append(groups[alias], item)
+	}
+	for _, alias := range aliases {
+		group := groups[alias]
+		rawMsgArr := make([][]byte, 0, len(group))
+		for _, item := range group {
+			rawMsgArr = append(rawMsgArr, item.Payload)
+		}
+		flushCtx := sumocli.WithEnqueuedAt(sumocli.WithAlias(ctx, alias), group[0].EnqueuedAt)
+		err := sc.sumoclient.FlushAll(flushCtx, rawMsgArr)
+		if err != nil {
+			// the queue is closed right after, nothing is left to send the payloads
+			telemetry.Add(telemetry.PayloadsDropped, int64(len(group)))
+			sc.logger.Errorf("Unable to flush DataQueue, dropping %d payloads of the alias %q: %v", len(group), alias, err)
+			// TODO: raise alert if flush fails
+		}
+	}
+}
+
+func (sc *sumoConsumer) consumeTask(ctx context.Context, item QueueItem) {
+	// the payloads received before the first invocation and the events of the extension go to the endpoint
+	// of the last invocation
+	alias := item.Alias
+	if alias == "" {
+		alias = cfg.InvokedQualifier()
+	}
+	if sc.config.EndpointFor(alias) == "" {
+		telemetry.Add(telemetry.PayloadsDropped, 1)
+		sc.logger.Errorf("Dropping payload of %d bytes, no endpoint for the alias %q", len(item.Payload), alias)
+		return
+	}
+	// the failover object of a payload which can not be posted keeps its age
+	ctx = sumocli.WithEnqueuedAt(sumocli.WithAlias(ctx, alias), item.EnqueuedAt)
+	err := sc.sumoclient.SendLogs(ctx, item.Payload)
 	if err != nil {
 		sc.logger.Error("Error during Send Logs to Sumo Logic.", err.Error())
 		// putting back the msg to the queue in case of failure
-		sc.dataQueue <- rawmsg
+		sc.requeue(item)
 		// TODO: raise alert if send logs fails
 	}
+	// the payload is copied when requeued, its buffer can be reused by the queue
+	if queue, ok := sc.dataQueue.(releaser); ok {
+		queue.release(item.Payload)
+	}
 	return
 }
 
+// submit sends item with the worker pool, it is requeued when ctx is done before a worker is free
+func (sc *sumoConsumer) submit(ctx context.Context, wg *sync.WaitGroup, item QueueItem, concurrency int) {
+	if err := sc.pool.submit(ctx, wg, item, concurrency); err != nil {
+		sc.logger.Debugf("Requeuing payload of %d bytes, no worker was free: %v", len(item.Payload), err)
+		sc.requeue(item)
+	}
+}
+
+// requeue pushes back a payload which was not sent, it is dropped when the queue has no room left for it
+func (sc *sumoConsumer) requeue(item QueueItem) {
+	if err := sc.dataQueue.Requeue(item); err != nil {
+		telemetry.Add(telemetry.PayloadsDropped, 1)
+		sc.logger.Error("Unable to requeue payload: ", err.Error())
+		return
+	}
+	telemetry.Add(telemetry.PayloadsRequeued, 1)
+}
+
 func (sc *sumoConsumer) DrainQueue(ctx context.Context) int {
+	defer telemetry.StartSpan("drainQueue")()
+	if sc.config.Endpoint() == "" {
+		// keeping the payloads until an invocation selects the endpoint of its alias
+		sc.logger.Debug("No endpoint for the alias of the function yet, skipping drain")
+		return 0
+	}
+	if sc.config.EnableCatchUp {
+		// replaying failover objects first so live traffic resumes after them
+		err := sc.sumoclient.CatchUp(ctx)
+		if err != nil {
+			sc.logger.Debug("Collector still unavailable: ", err.Error())
+		}
+	}
+	concurrency := sc.maxConcurrentRequests()
 	wg := new(sync.WaitGroup)
 	//sc.logger.Debug("Consuming data from dataQueue")
 	counter := 0
-Loop:
-	for i := 0; i < sc.config.MaxConcurrentRequests && len(sc.dataQueue) != 0; i++ {
-		//Receives block when the buffer is empty.
-		select {
-		case rawmsg := <-sc.dataQueue:
+	var oldestAge time.Duration
+	var expired []QueueItem
+	if sc.config.CoalesceMaxAge > 0 {
+		coalesced, ready := sc.coalesce(ctx)
+		if !ready {
+			return 0
+		}
+		for _, item := range coalesced {
+			if age := utils.Since(item.EnqueuedAt); age > oldestAge {
+				oldestAge = age
+			}
 			counter++
-			wg.Add(1)
-			go sc.consumeTask(ctx, wg, rawmsg)
-		default:
+			sc.submit(ctx, wg, item, concurrency)
+		}
+	}
+	for counter < concurrency && sc.dataQueue.Len() != 0 {
+		// Pop returns false when the queue is empty.
+		item, ok := sc.dataQueue.Pop()
+		if !ok {
 			sc.logger.Debugf("DataQueue completely drained")
-			break Loop
+			break
 		}
-
+		if sc.isExpired(item) {
+			expired = append(expired, item)
+			continue
+		}
+		if age := utils.Since(item.EnqueuedAt); age > oldestAge {
+			oldestAge = age
+		}
+		counter++
+		sc.submit(ctx, wg, item, concurrency)
+	}
+	if len(expired) > 0 {
+		sc.submit(ctx, wg, QueueItem{Payload: sc.spillExpiredEvent(expired), EnqueuedAt: time.Now()}, concurrency)
+	}
+	if sc.config.MaxRecordAge > 0 && oldestAge > sc.config.MaxRecordAge {
+		sc.submit(ctx, wg, QueueItem{Payload: sc.lagBreachEvent(oldestAge), EnqueuedAt: time.Now()}, concurrency)
 	}
 	//sc.logger.Debugf("Waiting for %d consumer to finish their tasks", counter)
 	wg.Wait()
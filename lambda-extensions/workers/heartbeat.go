@@ -0,0 +1,61 @@
+package workers
+
+import (
+	"encoding/json"
+	"time"
+
+	cfg "github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+
+	uuid "github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Heartbeat ships a small synthetic record with known content, so that the delivery latency and the loss
+// can be monitored end to end by a scheduled search: sentAt against the receipt time gives the latency and
+// the gaps in the sequence of a container give the records lost.
+type Heartbeat struct {
+	config      *cfg.LambdaExtensionConfig
+	dataQueue   DataQueue
+	logger      *logrus.Entry
+	containerID string
+	sequence    int64
+	last        time.Time
+}
+
+// NewHeartbeat returns a Heartbeat pushing its records to dataQueue
+func NewHeartbeat(dataQueue DataQueue, config *cfg.LambdaExtensionConfig, logger *logrus.Entry) *Heartbeat {
+	return &Heartbeat{
+		config:      config,
+		dataQueue:   dataQueue,
+		logger:      logger,
+		containerID: uuid.New().String(),
+	}
+}
+
+// Beat pushes a heartbeat record for the invocation requestID when HeartbeatInterval elapsed since the last
+// one, or on every invocation when it is 0. It is called from the event loop only.
+func (h *Heartbeat) Beat(requestID string) {
+	if !h.last.IsZero() && time.Since(h.last) < h.config.HeartbeatInterval {
+		return
+	}
+	h.last = time.Now()
+	h.sequence++
+	event, err := json.Marshal([]map[string]interface{}{{
+		"time": time.Now().UTC().Format(time.RFC3339Nano),
+		"type": "extension.heartbeat",
+		"record": map[string]interface{}{
+			"containerId": h.containerID,
+			"sequence":    h.sequence,
+			"sentAt":      time.Now().UTC().Format(time.RFC3339Nano),
+			"requestId":   requestID,
+		},
+	}})
+	if err != nil {
+		h.logger.Error("Unable to create heartbeat: ", err.Error())
+		return
+	}
+	// the gap in the sequence shows a heartbeat dropped here like any lost record
+	if !h.dataQueue.TryPush(event) {
+		h.logger.Debug("Dropping heartbeat as the queue is full")
+	}
+}
@@ -0,0 +1,146 @@
+package workers
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+)
+
+// tryRequeuer is implemented by the queues which can take an item without blocking while keeping its age
+type tryRequeuer interface {
+	tryRequeue(QueueItem) bool
+}
+
+// releaser is implemented by the queues reusing the payloads popped once they are sent
+type releaser interface {
+	release([]byte)
+}
+
+// overflowQueue is a DataQueue holding the payloads received while the wrapped queue is full, so the receiver
+// acknowledges the Logs API without waiting. Payloads are popped in the order received: while payloads
+// overflow, the newer ones are held behind them, and they are moved to the wrapped queue as it makes room.
+// Popping drains both, so that the payloads still overflowing are flushed on shutdown.
+type overflowQueue struct {
+	DataQueue
+	mu        sync.Mutex
+	items     []QueueItem
+	usedBytes int
+	maxBytes  int
+	closed    bool
+}
+
+// NewOverflowQueue returns dataQueue with an overflow buffer of at most maxBytes, dataQueue when maxBytes is 0
+func NewOverflowQueue(dataQueue DataQueue, maxBytes int) DataQueue {
+	if maxBytes <= 0 {
+		return dataQueue
+	}
+	return &overflowQueue{DataQueue: dataQueue, maxBytes: maxBytes}
+}
+
+// TryPush returns false when neither the queue nor the overflow buffer has room, the newest payloads are the
+// ones dropped
+func (oq *overflowQueue) TryPush(payload []byte) bool {
+	oq.mu.Lock()
+	defer oq.mu.Unlock()
+	if oq.closed {
+		return false
+	}
+	// the queue only takes the payload when none received before it is held
+	if len(oq.items) == 0 && oq.DataQueue.TryPush(payload) {
+		return true
+	}
+	if oq.usedBytes+len(payload) > oq.maxBytes {
+		return false
+	}
+	telemetry.Add(telemetry.OverflowPayloads, 1)
+	oq.items = append(oq.items, newQueueItem(payload))
+	oq.usedBytes += len(payload)
+	return true
+}
+
+// Requeue pushes back an item which failed to send without blocking while payloads are held: it goes to the
+// queue when it has room and otherwise to the front of the overflow buffer, as it was received before the
+// payloads held. It only blocks as the queue does when nothing is held and the overflow buffer is full.
+func (oq *overflowQueue) Requeue(item QueueItem) error {
+	oq.mu.Lock()
+	if oq.closed {
+		oq.mu.Unlock()
+		return fmt.Errorf("Queue is closed, dropping payload of %d bytes", len(item.Payload))
+	}
+	if queue, ok := oq.DataQueue.(tryRequeuer); ok && queue.tryRequeue(item) {
+		oq.mu.Unlock()
+		return nil
+	}
+	if oq.usedBytes+len(item.Payload) <= oq.maxBytes {
+		// the payload is released to the queue once requeued, the buffer keeps its own copy
+		item.Payload = append([]byte(nil), item.Payload...)
+		oq.items = append(oq.items, QueueItem{})
+		copy(oq.items[1:], oq.items)
+		oq.items[0] = item
+		oq.usedBytes += len(item.Payload)
+		telemetry.Add(telemetry.OverflowPayloads, 1)
+		oq.mu.Unlock()
+		return nil
+	}
+	held := len(oq.items) > 0
+	oq.mu.Unlock()
+	if held {
+		return fmt.Errorf("Overflow buffer is full, dropping payload of %d bytes", len(item.Payload))
+	}
+	return oq.DataQueue.Requeue(item)
+}
+
+// Pop returns the oldest payload, from the queue and then from the overflow buffer, and moves the payloads
+// overflowing to the room made in the queue
+func (oq *overflowQueue) Pop() (QueueItem, bool) {
+	oq.mu.Lock()
+	defer oq.mu.Unlock()
+	item, ok := oq.DataQueue.Pop()
+	if !ok && len(oq.items) > 0 {
+		item, ok = oq.shift(), true
+	}
+	oq.move()
+	return item, ok
+}
+
+func (oq *overflowQueue) Len() int {
+	oq.mu.Lock()
+	defer oq.mu.Unlock()
+	return oq.DataQueue.Len() + len(oq.items)
+}
+
+func (oq *overflowQueue) Close() {
+	oq.mu.Lock()
+	oq.closed = true
+	oq.mu.Unlock()
+	oq.DataQueue.Close()
+}
+
+// release gives back the payloads popped to the queue when it reuses them, the ones which overflowed included
+func (oq *overflowQueue) release(payload []byte) {
+	if queue, ok := oq.DataQueue.(releaser); ok {
+		queue.release(payload)
+	}
+}
+
+// move pushes the payloads overflowing to the queue in the order received while it has room, keeping the
+// time they were received at. oq.mu has to be held.
+func (oq *overflowQueue) move() {
+	queue, ok := oq.DataQueue.(tryRequeuer)
+	if !ok {
+		return
+	}
+	for len(oq.items) > 0 && queue.tryRequeue(oq.items[0]) {
+		oq.shift()
+	}
+}
+
+// shift removes and returns the oldest payload overflowing, oq.mu has to be held
+func (oq *overflowQueue) shift() QueueItem {
+	item := oq.items[0]
+	oq.items[0] = QueueItem{}
+	oq.items = oq.items[1:]
+	oq.usedBytes -= len(item.Payload)
+	return item
+}
@@ -0,0 +1,131 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// recordingSender is a LogSender keeping the payloads it sends and the ones it flushes, joined per flush
+type recordingSender struct {
+	mu       sync.Mutex
+	payloads []string
+	flushes  []string
+}
+
+func (rs *recordingSender) SendLogs(ctx context.Context, payload []byte) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.payloads = append(rs.payloads, string(payload))
+	return nil
+}
+
+func (rs *recordingSender) FlushAll(ctx context.Context, payloads [][]byte) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.flushes = append(rs.flushes, string(bytes.Join(payloads, []byte(","))))
+	return nil
+}
+
+func (rs *recordingSender) CatchUp(ctx context.Context) error {
+	return nil
+}
+
+// flushFailingSender is a LogSender whose failover fails on shutdown
+type flushFailingSender struct {
+	recordingSender
+}
+
+func (fs *flushFailingSender) FlushAll(ctx context.Context, payloads [][]byte) error {
+	return errors.New("failover bucket unavailable")
+}
+
+func popAll(queue DataQueue) string {
+	var payloads []string
+	for item, ok := queue.Pop(); ok; item, ok = queue.Pop() {
+		payloads = append(payloads, string(item.Payload))
+	}
+	return strings.Join(payloads, ",")
+}
+
+func TestOverflowQueueOrder(t *testing.T) {
+	for name, inner := range map[string]DataQueue{
+		"channel":    NewChannelQueue(1),
+		"ringBuffer": NewRingBufferQueue(ringBufferHeaderSize + 1),
+	} {
+		queue := NewOverflowQueue(inner, 1024)
+		for _, payload := range []string{"a", "b", "c"} {
+			assertEqual(t, queue.TryPush([]byte(payload)), true, name+": payload should be held in the overflow buffer")
+		}
+		assertEqual(t, queue.Len(), 3, name+": overflowing payloads should be counted")
+		item, _ := queue.Pop()
+		assertEqual(t, string(item.Payload), "a", name+": oldest payload should be popped first")
+		// the queue has room again but the payloads overflowing were received before
+		assertEqual(t, queue.TryPush([]byte("d")), true, name+": payload should be pushed")
+		assertEqual(t, popAll(queue), "b,c,d", name+": payloads should be popped in the order received")
+	}
+
+	queue := NewOverflowQueue(NewChannelQueue(1), 1)
+	assertEqual(t, queue.TryPush([]byte("a")), true, "payload should be pushed")
+	assertEqual(t, queue.TryPush([]byte("b")), true, "payload should be held in the overflow buffer")
+	assertEqual(t, queue.TryPush([]byte("c")), false, "payload should be dropped when the overflow buffer is full")
+}
+
+func TestFlushDrainsOverflow(t *testing.T) {
+	logger := logrus.New().WithField("Name", "sumologic-extension")
+	config := newTestConfig(t, map[string]string{"SUMO_MAX_CONCURRENT_REQUESTS": "1"})
+	queue := NewOverflowQueue(NewChannelQueue(1), 1024)
+	for _, payload := range []string{"a", "b", "c"} {
+		queue.TryPush([]byte(payload))
+	}
+	sender := &recordingSender{}
+	consumer := NewTaskConsumerWithSender(queue, config, logger, sender)
+
+	consumer.FlushDataQueue(context.Background())
+	assertEqual(t, strings.Join(sender.payloads, ","), "a,b,c", "overflowing payloads should be flushed on shutdown in order")
+	assertEqual(t, queue.Len(), 0, "queue should be drained")
+}
+
+func TestOverflowQueueRequeue(t *testing.T) {
+	queue := NewOverflowQueue(NewRingBufferQueue(ringBufferHeaderSize+1), 2)
+	queue.TryPush([]byte("a"))
+	queue.TryPush([]byte("b"))
+	item, _ := queue.Pop()
+	assertEqual(t, string(item.Payload), "a", "oldest payload should be popped first")
+	assertEqual(t, queue.TryPush([]byte("c")), true, "payload should be held in the overflow buffer")
+
+	// the queue holds b and the overflow buffer c, a goes in front of c without blocking
+	assertEqual(t, queue.Requeue(item), nil, "payload should be requeued to the overflow buffer")
+	// the payload is released for reuse once requeued
+	item.Payload[0] = 'x'
+	assertEqual(t, queue.Requeue(QueueItem{Payload: []byte("d")}) != nil, true, "payload should be dropped when the overflow buffer is full")
+	assertEqual(t, popAll(queue), "b,a,c", "requeued payload should be popped before the payloads received after it")
+}
+
+func TestFlushFailureDoesNotBlock(t *testing.T) {
+	logger := logrus.New().WithField("Name", "sumologic-extension")
+	config := newTestConfig(t, map[string]string{"SUMO_ENABLE_FAILOVER": "true", "SUMO_S3_BUCKET_NAME": "bucket", "SUMO_S3_BUCKET_REGION": "us-east-1"})
+	queue := NewOverflowQueue(NewChannelQueue(1), 1024)
+	for _, payload := range []string{"a", "b", "c"} {
+		queue.TryPush([]byte(payload))
+	}
+	consumer := NewTaskConsumerWithSender(queue, config, logger, &flushFailingSender{})
+
+	done := make(chan struct{})
+	go func() {
+		consumer.FlushDataQueue(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("failed flush should not block the shutdown")
+	}
+	assertEqual(t, queue.TryPush([]byte("d")), false, "queue should be closed after the flush")
+}
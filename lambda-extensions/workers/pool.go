@@ -0,0 +1,118 @@
+package workers
+
+import (
+	"context"
+	"sync"
+)
+
+// maxPoolWorkers bounds the goroutines sending the payloads whatever MaxConcurrentRequests is
+const maxPoolWorkers = 128
+
+// sendJob is a payload to send, done is signaled once it is sent or requeued
+type sendJob struct {
+	ctx  context.Context
+	item QueueItem
+	done *sync.WaitGroup
+}
+
+// workerPool sends the payloads with long lived workers, so that a slow collector does not pile up a
+// goroutine per payload. The workers follow MaxConcurrentRequests as it changes, e.g. after a config reload
+// or autotuning: they are started as it grows and stop once idle as it shrinks. At most MaxConcurrentRequests
+// payloads are in flight, the other ones wait in submit.
+type workerPool struct {
+	jobs chan sendJob
+	send func(context.Context, QueueItem)
+	mu   sync.Mutex
+	// workers are the running workers, target the ones to keep, the extra ones stop once idle
+	workers int
+	target  int
+	// inFlight are the jobs submitted and not sent yet
+	inFlight int
+	// released is closed when a job is sent, wake when workers have to stop, both are replaced then
+	released chan struct{}
+	wake     chan struct{}
+}
+
+func newWorkerPool(send func(context.Context, QueueItem)) *workerPool {
+	return &workerPool{
+		jobs:     make(chan sendJob, maxPoolWorkers),
+		send:     send,
+		released: make(chan struct{}),
+		wake:     make(chan struct{}),
+	}
+}
+
+// submit queues item to be sent by one of concurrency workers, it blocks while concurrency jobs are in flight
+// and returns the error of ctx when it is done before. done is incremented once item is queued.
+func (p *workerPool) submit(ctx context.Context, done *sync.WaitGroup, item QueueItem, concurrency int) error {
+	concurrency = p.resize(concurrency)
+	for {
+		p.mu.Lock()
+		if p.inFlight < concurrency {
+			p.inFlight++
+			p.mu.Unlock()
+			break
+		}
+		released := p.released
+		p.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	done.Add(1)
+	// the job queue holds maxPoolWorkers jobs, as many as can be in flight, so this does not block
+	p.jobs <- sendJob{ctx: ctx, item: item, done: done}
+	return nil
+}
+
+// resize starts or stops workers until concurrency of them run, within maxPoolWorkers, and returns it
+func (p *workerPool) resize(concurrency int) int {
+	if concurrency > maxPoolWorkers {
+		concurrency = maxPoolWorkers
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.target = concurrency
+	for ; p.workers < concurrency; p.workers++ {
+		go p.work()
+	}
+	if p.workers > concurrency {
+		close(p.wake)
+		p.wake = make(chan struct{})
+	}
+	return concurrency
+}
+
+func (p *workerPool) work() {
+	for {
+		p.mu.Lock()
+		if p.workers > p.target {
+			p.workers--
+			p.mu.Unlock()
+			return
+		}
+		wake := p.wake
+		p.mu.Unlock()
+		select {
+		case job := <-p.jobs:
+			p.send(job.ctx, job.item)
+			p.release()
+			job.done.Done()
+		case <-wake:
+		}
+	}
+}
+
+// release frees the slot of a job sent for the next one
+func (p *workerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inFlight--
+	close(p.released)
+	p.released = make(chan struct{})
+}
@@ -0,0 +1,64 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// poolWorkers returns the workers of pool once they are as many as expected, or after a second
+func poolWorkers(pool *workerPool, expected int) int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		pool.mu.Lock()
+		workers := pool.workers
+		pool.mu.Unlock()
+		if workers == expected || time.Now().After(deadline) {
+			return workers
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorkerPool(t *testing.T) {
+	var mu sync.Mutex
+	var active, maxActive int
+	unblock := make(chan struct{})
+	pool := newWorkerPool(func(ctx context.Context, item QueueItem) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		<-unblock
+		mu.Lock()
+		active--
+		mu.Unlock()
+	})
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 2; i++ {
+		assertEqual(t, pool.submit(context.Background(), wg, QueueItem{}, 2), nil, "payload should be submitted")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assertEqual(t, pool.submit(ctx, wg, QueueItem{}, 2), context.DeadlineExceeded, "submit should stop when ctx is done")
+	close(unblock)
+	wg.Wait()
+
+	// the payloads above the concurrency wait for a worker to be free
+	for i := 0; i < 20; i++ {
+		assertEqual(t, pool.submit(context.Background(), wg, QueueItem{}, 3), nil, "payload should be submitted")
+	}
+	wg.Wait()
+	assertEqual(t, maxActive <= 3, true, "at most concurrency payloads should be in flight")
+	assertEqual(t, poolWorkers(pool, 3), 3, "workers should grow to the concurrency")
+
+	pool.resize(1)
+	assertEqual(t, poolWorkers(pool, 1), 1, "idle workers should stop as the concurrency shrinks")
+	assertEqual(t, pool.submit(context.Background(), wg, QueueItem{}, 4), nil, "payload should be submitted")
+	wg.Wait()
+	assertEqual(t, poolWorkers(pool, 4), 4, "workers should grow again")
+}
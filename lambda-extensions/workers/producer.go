@@ -1,10 +1,13 @@
 package workers
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,16 +21,30 @@ const (
 // TaskProducer exposes methods for producing tasks
 type TaskProducer interface {
 	Start() error
+	// Faults signals the payloads containing a platform.fault, which are received when the runtime crashed
+	Faults() <-chan struct{}
 }
 
 type httpServer struct {
-	dataQueue chan []byte
+	dataQueue DataQueue
+	faults    chan struct{}
 	logger    *logrus.Entry
 }
 
-// NewTaskProducer is to return a new object
-func NewTaskProducer(consumerQueue chan []byte, logger *logrus.Entry) TaskProducer {
-	return &httpServer{dataQueue: consumerQueue, logger: logger}
+var faultType = []byte(`"platform.fault"`)
+
+// NewTaskProducer is to return a new object, the payloads are dropped when consumerQueue is full, see
+// NewOverflowQueue for holding bursts
+func NewTaskProducer(consumerQueue DataQueue, logger *logrus.Entry) TaskProducer {
+	return &httpServer{
+		dataQueue: consumerQueue,
+		faults:    make(chan struct{}, 1),
+		logger:    logger,
+	}
+}
+
+func (httpServer *httpServer) Faults() <-chan struct{} {
+	return httpServer.faults
 }
 
 // Start is to start the HTTP Server
@@ -55,7 +72,21 @@ func (httpServer *httpServer) logsHandler(writer http.ResponseWriter, request *h
 		}
 		httpServer.logger.Debug("Producing data into dataQueue")
 		payload := []byte(reqBody)
-		// Sends to a buffered channel block only when the buffer is full
-		httpServer.dataQueue <- payload
+		telemetry.Add(telemetry.PayloadsReceived, 1)
+		telemetry.Add(telemetry.BytesReceived, int64(len(payload)))
+		// never blocking the Logs API, which drops the payloads of slow or failing subscribers
+		if !httpServer.dataQueue.TryPush(payload) {
+			httpServer.logger.Errorf("Dropping payload of %d bytes, dataQueue and overflow buffer are full", len(payload))
+			telemetry.Add(telemetry.PayloadsDropped, 1)
+		}
+		writer.WriteHeader(http.StatusOK)
+		// looking for the type without parsing the payload, the consumer parses it anyway
+		if bytes.Contains(payload, faultType) {
+			telemetry.Add(telemetry.FaultsReceived, 1)
+			select {
+			case httpServer.faults <- struct{}{}:
+			default:
+			}
+		}
 	}
 }
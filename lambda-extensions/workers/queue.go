@@ -0,0 +1,286 @@
+package workers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	cfg "github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+)
+
+// maxAliasLength is the longest alias kept with a payload, the aliases of Lambda are at most 128 characters
+const maxAliasLength = 255
+
+// QueueItem is a payload along with the time it was pushed to the queue and the alias of the invocation it
+// was received during, which selects its endpoint in SUMO_ALIAS_ENDPOINT_MAP
+type QueueItem struct {
+	Payload    []byte
+	EnqueuedAt time.Time
+	Alias      string
+}
+
+// newQueueItem returns the item of a payload received now, during the last invocation
+func newQueueItem(payload []byte) QueueItem {
+	alias := cfg.InvokedQualifier()
+	if len(alias) > maxAliasLength {
+		alias = alias[:maxAliasLength]
+	}
+	return QueueItem{Payload: payload, EnqueuedAt: time.Now(), Alias: alias}
+}
+
+// DataQueue is the buffer between the Logs API receiver and the consumer
+type DataQueue interface {
+	// Push blocks while the queue is full
+	Push([]byte) error
+	// Requeue pushes back an item that failed to send, keeping its enqueue time so that it keeps its age
+	Requeue(QueueItem) error
+	// TryPush returns false instead of blocking when the queue is full
+	TryPush([]byte) bool
+	// Pop returns false when the queue is empty
+	Pop() (QueueItem, bool)
+	Len() int
+	Close()
+}
+
+// channelQueue is a DataQueue bounded by number of payloads
+type channelQueue struct {
+	queue chan QueueItem
+	// closed stops the pushes, the queue itself is never closed as pushes may be blocked on it
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewChannelQueue returns a DataQueue holding at most maxLength payloads
+func NewChannelQueue(maxLength int) DataQueue {
+	return &channelQueue{queue: make(chan QueueItem, maxLength), closed: make(chan struct{})}
+}
+
+func (cq *channelQueue) Push(payload []byte) error {
+	return cq.Requeue(newQueueItem(payload))
+}
+
+func (cq *channelQueue) Requeue(item QueueItem) error {
+	select {
+	case <-cq.closed:
+		return fmt.Errorf("Queue is closed, dropping payload of %d bytes", len(item.Payload))
+	default:
+	}
+	// Sends to a buffered channel block only when the buffer is full
+	select {
+	case cq.queue <- item:
+		return nil
+	case <-cq.closed:
+		return fmt.Errorf("Queue is closed, dropping payload of %d bytes", len(item.Payload))
+	}
+}
+
+func (cq *channelQueue) TryPush(payload []byte) bool {
+	return cq.tryRequeue(newQueueItem(payload))
+}
+
+func (cq *channelQueue) tryRequeue(item QueueItem) bool {
+	select {
+	case <-cq.closed:
+		return false
+	default:
+	}
+	select {
+	case cq.queue <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+func (cq *channelQueue) Pop() (QueueItem, bool) {
+	select {
+	case item := <-cq.queue:
+		return item, true
+	default:
+		return QueueItem{}, false
+	}
+}
+
+func (cq *channelQueue) Len() int {
+	return len(cq.queue)
+}
+
+func (cq *channelQueue) Close() {
+	cq.closeOnce.Do(func() {
+		close(cq.closed)
+	})
+}
+
+// ringBufferHeaderSize is the length, the enqueue offset and the alias length stored before the alias and
+// the payload of every entry in the arena
+const ringBufferHeaderSize = 13
+
+// ringBuffer is a DataQueue backed by a preallocated byte arena bounded by total bytes.
+// Payloads are copied into the arena so memory stays constant and Push does not allocate.
+type ringBuffer struct {
+	mu      sync.Mutex
+	notFull *sync.Cond
+	arena   []byte
+	head    int // read offset
+	tail    int // write offset
+	used    int
+	count   int
+	closed  bool
+	header  [ringBufferHeaderSize]byte
+	alias   [maxAliasLength]byte
+	// lastAlias is the alias last popped, which is the one of most payloads, so that popping it does not allocate
+	lastAlias string
+	// free are the payloads released once sent, reused by Pop while they hold at most the size of the arena
+	free      [][]byte
+	freeBytes int
+	// epoch is the reference for the enqueue offsets, which keeps them on the monotonic clock
+	epoch time.Time
+}
+
+// NewRingBufferQueue returns a DataQueue backed by an arena of sizeBytes
+func NewRingBufferQueue(sizeBytes int) DataQueue {
+	rb := &ringBuffer{arena: make([]byte, sizeBytes), epoch: time.Now()}
+	rb.notFull = sync.NewCond(&rb.mu)
+	return rb
+}
+
+func (rb *ringBuffer) Push(payload []byte) error {
+	return rb.Requeue(newQueueItem(payload))
+}
+
+func (rb *ringBuffer) TryPush(payload []byte) bool {
+	return rb.tryRequeue(newQueueItem(payload))
+}
+
+func (rb *ringBuffer) tryRequeue(item QueueItem) bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.closed || len(rb.arena)-rb.used < entrySize(item) {
+		return false
+	}
+	rb.append(item)
+	return true
+}
+
+func (rb *ringBuffer) Requeue(item QueueItem) error {
+	if entrySize(item) > len(rb.arena) {
+		return fmt.Errorf("Payload of %d bytes exceeds ring buffer size of %d bytes", len(item.Payload), len(rb.arena))
+	}
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	for !rb.closed && len(rb.arena)-rb.used < entrySize(item) {
+		rb.notFull.Wait()
+	}
+	if rb.closed {
+		return fmt.Errorf("Ring buffer is closed, dropping payload of %d bytes", len(item.Payload))
+	}
+	rb.append(item)
+	return nil
+}
+
+// entrySize returns the bytes item takes in the arena
+func entrySize(item QueueItem) int {
+	return ringBufferHeaderSize + len(item.Alias) + len(item.Payload)
+}
+
+// append writes an entry, rb.mu has to be held, the entry has to fit and its alias to be at most
+// maxAliasLength as newQueueItem makes it
+func (rb *ringBuffer) append(item QueueItem) {
+	binary.BigEndian.PutUint32(rb.header[:4], uint32(len(item.Payload)))
+	binary.BigEndian.PutUint64(rb.header[4:12], uint64(item.EnqueuedAt.Sub(rb.epoch)))
+	rb.header[12] = byte(len(item.Alias))
+	rb.write(rb.header[:])
+	rb.writeString(item.Alias)
+	rb.write(item.Payload)
+	rb.used += entrySize(item)
+	rb.count++
+}
+
+func (rb *ringBuffer) Pop() (QueueItem, bool) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.count == 0 {
+		return QueueItem{}, false
+	}
+	rb.read(rb.header[:])
+	payload := rb.payloadBuffer(int(binary.BigEndian.Uint32(rb.header[:4])))
+	enqueuedAt := rb.epoch.Add(time.Duration(binary.BigEndian.Uint64(rb.header[4:12])))
+	alias := rb.alias[:rb.header[12]]
+	rb.read(alias)
+	rb.read(payload)
+	if string(alias) != rb.lastAlias {
+		rb.lastAlias = string(alias)
+	}
+	rb.used -= ringBufferHeaderSize + len(alias) + len(payload)
+	rb.count--
+	rb.notFull.Broadcast()
+	return QueueItem{Payload: payload, EnqueuedAt: enqueuedAt, Alias: rb.lastAlias}, true
+}
+
+// release gives back the payload of a popped item once it is sent or requeued, for Pop to reuse
+func (rb *ringBuffer) release(payload []byte) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if payload == nil || rb.freeBytes+cap(payload) > len(rb.arena) {
+		return
+	}
+	rb.free = append(rb.free, payload)
+	rb.freeBytes += cap(payload)
+}
+
+// payloadBuffer returns a released payload of at least size bytes, the most recent first, or a new one when
+// none is large enough. rb.mu has to be held.
+func (rb *ringBuffer) payloadBuffer(size int) []byte {
+	for i := len(rb.free) - 1; i >= 0; i-- {
+		if buffer := rb.free[i]; cap(buffer) >= size {
+			last := len(rb.free) - 1
+			rb.free[i] = rb.free[last]
+			rb.free[last] = nil
+			rb.free = rb.free[:last]
+			rb.freeBytes -= cap(buffer)
+			return buffer[:size]
+		}
+	}
+	return make([]byte, size)
+}
+
+func (rb *ringBuffer) Len() int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.count
+}
+
+func (rb *ringBuffer) Close() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.closed = true
+	rb.notFull.Broadcast()
+}
+
+// write copies data at the tail, wrapping around the end of the arena
+func (rb *ringBuffer) write(data []byte) {
+	n := copy(rb.arena[rb.tail:], data)
+	if n < len(data) {
+		copy(rb.arena, data[n:])
+	}
+	rb.tail = (rb.tail + len(data)) % len(rb.arena)
+}
+
+// writeString copies data at the tail as write does
+func (rb *ringBuffer) writeString(data string) {
+	n := copy(rb.arena[rb.tail:], data)
+	if n < len(data) {
+		copy(rb.arena, data[n:])
+	}
+	rb.tail = (rb.tail + len(data)) % len(rb.arena)
+}
+
+// read copies data from the head, wrapping around the end of the arena
+func (rb *ringBuffer) read(data []byte) {
+	n := copy(data, rb.arena[rb.head:])
+	if n < len(data) {
+		copy(data[n:], rb.arena)
+	}
+	rb.head = (rb.head + len(data)) % len(rb.arena)
+}
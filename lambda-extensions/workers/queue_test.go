@@ -0,0 +1,174 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestQueueKeepsAlias(t *testing.T) {
+	defer cfg.SetInvokedFunctionArn("")
+	for name, queue := range map[string]DataQueue{
+		"channel":    NewChannelQueue(4),
+		"ringBuffer": NewRingBufferQueue(1024),
+	} {
+		cfg.SetInvokedFunctionArn("arn:aws:lambda:us-east-1:123456789012:function:name:prod")
+		queue.Push([]byte("a"))
+		cfg.SetInvokedFunctionArn("arn:aws:lambda:us-east-1:123456789012:function:name:staging")
+		queue.TryPush([]byte("b"))
+
+		item, _ := queue.Pop()
+		assertEqual(t, item.Alias, "prod", name+": payload should keep the alias it was received for")
+		assertEqual(t, queue.Requeue(item), nil, name+": payload should be requeued")
+		item, _ = queue.Pop()
+		assertEqual(t, item.Alias, "staging", name+": payload should keep the alias it was received for")
+		item, _ = queue.Pop()
+		assertEqual(t, string(item.Payload), "a", name+": requeued payload should be popped")
+		assertEqual(t, item.Alias, "prod", name+": requeued payload should keep its alias")
+	}
+}
+
+func TestFlushPerAlias(t *testing.T) {
+	defer cfg.SetInvokedFunctionArn("")
+	logger := logrus.New().WithField("Name", "sumologic-extension")
+	config := newTestConfig(t, map[string]string{"SUMO_ENABLE_FAILOVER": "true", "SUMO_S3_BUCKET_NAME": "bucket", "SUMO_S3_BUCKET_REGION": "us-east-1"})
+	queue := NewChannelQueue(4)
+	for _, alias := range []string{"prod", "staging", "prod"} {
+		cfg.SetInvokedFunctionArn("arn:aws:lambda:us-east-1:123456789012:function:name:" + alias)
+		queue.Push([]byte(alias))
+	}
+	sender := &recordingSender{}
+	NewTaskConsumerWithSender(queue, config, logger, sender).FlushDataQueue(context.Background())
+	assertEqual(t, strings.Join(sender.flushes, ";"), "prod,prod;staging", "payloads should be flushed in one object per alias")
+}
+
+// failingSender is a LogSender failing every payload, as when the collector and the failover are unavailable
+type failingSender struct {
+	recordingSender
+}
+
+func (fs *failingSender) SendLogs(ctx context.Context, payload []byte) error {
+	return errors.New("collector unavailable")
+}
+
+func TestRequeueKeepsEnqueuedAt(t *testing.T) {
+	enqueuedAt := time.Now().Add(-time.Hour)
+	for name, queue := range map[string]DataQueue{
+		"channel":    NewChannelQueue(4),
+		"ringBuffer": NewRingBufferQueue(1024),
+		"overflow":   NewOverflowQueue(NewRingBufferQueue(1024), 1024),
+	} {
+		assertEqual(t, queue.Requeue(QueueItem{Payload: []byte("a"), EnqueuedAt: enqueuedAt}), nil, name+": payload should be requeued")
+		item, _ := queue.Pop()
+		assertEqual(t, item.EnqueuedAt.Equal(enqueuedAt), true, name+": requeued payload should keep its enqueue time")
+
+		consumer := NewTaskConsumerWithSender(queue, newTestConfig(t, nil), logrus.New().WithField("Name", "sumologic-extension"), &failingSender{}).(*sumoConsumer)
+		consumer.consumeTask(context.Background(), item)
+		item, _ = queue.Pop()
+		assertEqual(t, string(item.Payload), "a", name+": payload failing to send should be requeued")
+		assertEqual(t, item.EnqueuedAt.Equal(enqueuedAt), true, name+": payload failing to send should keep its enqueue time")
+	}
+}
+
+func TestMergePayloadsPerAlias(t *testing.T) {
+	now := time.Now()
+	merged := mergePayloads([]QueueItem{
+		{Payload: []byte(`[{"record": "a"}]`), EnqueuedAt: now, Alias: "prod"},
+		{Payload: []byte(`[{"record": "b"}]`), EnqueuedAt: now, Alias: "staging"},
+		{Payload: []byte(`[{"record": "c"}]`), EnqueuedAt: now, Alias: "prod"},
+	})
+	assertEqual(t, len(merged), 2, "payloads of different aliases should not be merged")
+	assertEqual(t, merged[0].Alias, "prod", "merged payload should keep its alias")
+	assertEqual(t, string(merged[0].Payload), `[{"record": "a"},{"record": "c"}]`, "payloads of the same alias should be merged")
+	assertEqual(t, merged[1].Alias, "staging", "merged payload should keep its alias")
+	assertEqual(t, string(merged[1].Payload), `[{"record": "b"}]`, "payload of another alias should be kept apart")
+}
+
+func TestRingBuffer(t *testing.T) {
+	entry := func(payload string) int { return ringBufferHeaderSize + len(payload) }
+	tests := []struct {
+		name   string
+		size   int
+		pushes []string
+		// pops are done after the pushes, then the rest are pushed
+		pops    int
+		rest    []string
+		pushed  int
+		popped  string
+		used    int
+		pending int
+	}{
+		{"empty", entry("abc"), nil, 1, nil, 0, "", 0, 0},
+		{"exactly full", 2 * entry("abc"), []string{"abc", "def"}, 0, nil, 2, "", 2 * entry("abc"), 2},
+		{"full", 2*entry("abc") + 1, []string{"abc", "def", "g"}, 0, nil, 2, "", 2 * entry("abc"), 2},
+		{"too large", entry("abc") - 1, []string{"abc"}, 0, nil, 0, "", 0, 0},
+		{"drained", entry("abc"), []string{"abc"}, 2, []string{"def"}, 2, "abc", entry("def"), 1},
+		// the third entry is written across the end of the arena
+		{"wraparound", 2*entry("abc") + 5, []string{"abc", "def"}, 1, []string{"ghijk"}, 3, "abc", entry("def") + entry("ghijk"), 2},
+		{"wraparound header", 2*entry("abc") + 3, []string{"abc", "def"}, 1, []string{"ghi"}, 3, "abc", 2 * entry("abc"), 2},
+	}
+	for _, test := range tests {
+		rb := NewRingBufferQueue(test.size).(*ringBuffer)
+		pushed := 0
+		for _, payload := range test.pushes {
+			if rb.TryPush([]byte(payload)) {
+				pushed++
+			}
+		}
+		var popped []string
+		for i := 0; i < test.pops; i++ {
+			if item, ok := rb.Pop(); ok {
+				popped = append(popped, string(item.Payload))
+			}
+		}
+		for _, payload := range test.rest {
+			if rb.TryPush([]byte(payload)) {
+				pushed++
+			}
+		}
+		assertEqual(t, pushed, test.pushed, fmt.Sprintf("%s: %d payloads pushed instead of %d", test.name, pushed, test.pushed))
+		assertEqual(t, strings.Join(popped, ","), test.popped, test.name+": payloads should be popped in the order pushed")
+		assertEqual(t, rb.used, test.used, fmt.Sprintf("%s: %d bytes used instead of %d", test.name, rb.used, test.used))
+		assertEqual(t, rb.Len(), test.pending, fmt.Sprintf("%s: %d payloads left instead of %d", test.name, rb.Len(), test.pending))
+
+		for item, ok := rb.Pop(); ok; item, ok = rb.Pop() {
+			popped = append(popped, string(item.Payload))
+		}
+		expected := append(append([]string{}, test.pushes...), test.rest...)[:test.pushed]
+		assertEqual(t, strings.Join(popped, ","), strings.Join(expected, ","), test.name+": payloads should be intact")
+		assertEqual(t, rb.used, 0, test.name+": no bytes should be used once drained")
+	}
+}
+
+func TestRingBufferReusesPayloads(t *testing.T) {
+	rb := NewRingBufferQueue(1024).(*ringBuffer)
+	payload := []byte(`[{"type":"function","record":"line"}]`)
+	allocs := testing.AllocsPerRun(100, func() {
+		rb.TryPush(payload)
+		item, _ := rb.Pop()
+		rb.release(item.Payload)
+	})
+	assertEqual(t, allocs, float64(0), fmt.Sprintf("pushing and popping should not allocate once payloads are released, %v allocations", allocs))
+
+	rb.TryPush(payload)
+	first, _ := rb.Pop()
+	rb.TryPush(payload)
+	second, _ := rb.Pop()
+	assertEqual(t, &first.Payload[0] != &second.Payload[0], true, "payloads not released should not be reused")
+	assertEqual(t, string(first.Payload), string(payload), "payload should be intact")
+	rb.release(first.Payload)
+	rb.release(second.Payload)
+	assertEqual(t, rb.freeBytes, cap(first.Payload)+cap(second.Payload), "released payloads should be accounted")
+
+	small := NewRingBufferQueue(ringBufferHeaderSize + len(payload)).(*ringBuffer)
+	small.release(make([]byte, len(payload)))
+	small.release(make([]byte, len(payload)))
+	assertEqual(t, len(small.free), 1, "released payloads should be bounded by the size of the arena")
+}
@@ -0,0 +1,93 @@
+//go:build soak
+// +build soak
+
+package workers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cfg "github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/config"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestSoak runs invocations against a local collector for SOAK_DURATION (default 1m) and fails when the
+// goroutines, open file descriptors or heap keep growing after warming up, like in long lived containers.
+//
+//	SOAK_DURATION=30m go test -tags soak -run TestSoak -timeout 0 ./lambda-extensions/workers/
+func TestSoak(t *testing.T) {
+	duration := time.Minute
+	if value := os.Getenv("SOAK_DURATION"); value != "" {
+		var err error
+		duration, err = time.ParseDuration(value)
+		if err != nil {
+			t.Fatalf("Unable to parse SOAK_DURATION: %v", err)
+		}
+	}
+
+	var requests int64
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// failing some of the requests to exercise the requeue path as well
+		if atomic.AddInt64(&requests, 1)%10 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	logger := logrus.New().WithField("Name", "sumologic-extension")
+	logger.Logger.SetLevel(logrus.ErrorLevel)
+	config := &cfg.LambdaExtensionConfig{
+		SumoHTTPEndpoint:      collector.URL,
+		NumRetry:              1,
+		MaxConcurrentRequests: 3,
+		RetrySleepTime:        time.Millisecond,
+		ResponseTimeout:       time.Second,
+		MaxDataPayloadSize:    1024 * 1024,
+		StreamingThreshold:    1024 * 1024,
+		CompressionLevel:      -1,
+		LogTypes:              []string{"platform", "function", "extension"},
+	}
+	queue := NewRingBufferQueue(4 * 1024 * 1024)
+	consumer := NewTaskConsumer(queue, config, logger)
+
+	invocations := 0
+	var baseline map[string]int64
+	deadline := time.Now().Add(duration)
+	warmup := time.Now().Add(duration / 10)
+	for ; time.Now().Before(deadline); invocations++ {
+		requestID := fmt.Sprintf("7313c951-e0bc-4818-879f-%012d", invocations)
+		queue.Push([]byte(fmt.Sprintf(`[{"time":"2020-10-27T15:36:14.133Z","type":"platform.start","record":{"requestId":"%s","version":"$LATEST"}},{"time":"2020-10-27T15:36:14.283Z","type":"function","record":"invocation %d\n"}]`, requestID, invocations)))
+		consumer.DrainQueue(context.Background())
+
+		telemetry.SampleRuntime()
+		if baseline == nil && time.Now().After(warmup) {
+			baseline = telemetry.Snapshot()
+		}
+	}
+	consumer.FlushDataQueue(context.Background())
+
+	final := telemetry.Snapshot()
+	t.Logf("%d invocations, baseline %v, final %v", invocations, baseline, final)
+	for _, gauge := range []struct {
+		name  string
+		slack int64
+	}{
+		{telemetry.Goroutines, 10},
+		{telemetry.OpenFDs, 10},
+		{telemetry.HeapInUse, 16 * 1024 * 1024},
+	} {
+		if final[gauge.name] > baseline[gauge.name]+gauge.slack {
+			t.Errorf("%s grew from %d to %d", gauge.name, baseline[gauge.name], final[gauge.name])
+		}
+	}
+}
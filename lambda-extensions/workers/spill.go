@@ -0,0 +1,57 @@
+package workers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/telemetry"
+	"github.com/SumoLogic/sumologic-lambda-extensions/lambda-extensions/utils"
+)
+
+// isExpired returns true for the payloads kept longer than SpillTTL, which are dropped instead of flooding
+// the ingestion with days old records when a long dormant container warms up
+func (sc *sumoConsumer) isExpired(item QueueItem) bool {
+	return sc.config.SpillTTL > 0 && utils.Since(item.EnqueuedAt) > sc.config.SpillTTL
+}
+
+// dropExpired removes the expired payloads of items
+func (sc *sumoConsumer) dropExpired(items []QueueItem) (kept []QueueItem, expired []QueueItem) {
+	for _, item := range items {
+		if sc.isExpired(item) {
+			expired = append(expired, item)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+	return kept, expired
+}
+
+// spillExpiredEvent returns a record in the Logs API format auditing the payloads dropped after SpillTTL
+func (sc *sumoConsumer) spillExpiredEvent(expired []QueueItem) []byte {
+	var droppedBytes int
+	var oldestAge time.Duration
+	for _, item := range expired {
+		droppedBytes += len(item.Payload)
+		if age := utils.Since(item.EnqueuedAt); age > oldestAge {
+			oldestAge = age
+		}
+	}
+	telemetry.Add(telemetry.PayloadsDropped, int64(len(expired)))
+	telemetry.Add(telemetry.PayloadsExpired, int64(len(expired)))
+	event, err := json.Marshal([]map[string]interface{}{{
+		"time": time.Now().UTC().Format(time.RFC3339Nano),
+		"type": "extension.spillExpired",
+		"record": map[string]interface{}{
+			"payloadsDropped":     len(expired),
+			"bytesDropped":        droppedBytes,
+			"oldestPayloadAgeSec": oldestAge.Seconds(),
+			"spillTtlSec":         sc.config.SpillTTL.Seconds(),
+		},
+	}})
+	if err != nil {
+		sc.logger.Error("Unable to create spill expired event: ", err.Error())
+		return nil
+	}
+	sc.logger.Warnf("Dropping %d payloads of %d bytes kept longer than %v", len(expired), droppedBytes, sc.config.SpillTTL)
+	return event
+}